@@ -0,0 +1,324 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package skycfg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// coverageBuiltin is the predeclared function called by instrumented code
+// before each statement. It records into the Coverage of the calling thread,
+// if any.
+const coverageBuiltin = "_skycfg_coverage"
+
+// A Coverage records which lines of Starlark code were executed. Coverage
+// is collected by passing WithCoverage to Load, and again to each Config.Main()
+// or Test.Run() call that should be recorded.
+//
+// A Coverage may be shared between concurrent executions.
+type Coverage struct {
+	mu      sync.Mutex
+	modules map[string]map[int32]*lineCoverage
+}
+
+type lineCoverage struct {
+	endCol     int32
+	statements int
+	count      uint64
+}
+
+// NewCoverage returns an empty coverage record.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		modules: make(map[string]map[int32]*lineCoverage),
+	}
+}
+
+// WithCoverage records executed lines of Starlark code into cov.
+//
+// When passed to Load, modules are instrumented for coverage and any lines
+// executed while loading are recorded. Configs loaded without WithCoverage
+// cannot record coverage during Config.Main() or Test.Run().
+func WithCoverage(cov *Coverage) CommonOption {
+	if cov == nil {
+		panic("WithCoverage: nil coverage")
+	}
+	return fnCommonOption(func(opts *commonOptions) {
+		opts.coverage = cov
+	})
+}
+
+// Modules returns the paths of all instrumented modules, sorted.
+func (c *Coverage) Modules() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	modules := make([]string, 0, len(c.modules))
+	for module := range c.modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// Lines returns the execution count of each instrumented line of a module.
+func (c *Coverage) Lines(module string) map[int]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines := make(map[int]uint64, len(c.modules[module]))
+	for line, cov := range c.modules[module] {
+		lines[int(line)] = cov.count
+	}
+	return lines
+}
+
+// WriteGoProfile writes the coverage record in the format of Go coverage
+// profiles, as produced by `go test -coverprofile`.
+func (c *Coverage) WriteGoProfile(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "mode: count")
+	c.eachLine(func(module string, line int32, cov *lineCoverage) {
+		fmt.Fprintf(bw, "%s:%d.1,%d.%d %d %d\n", module, line, line, cov.endCol, cov.statements, cov.count)
+	})
+	return bw.Flush()
+}
+
+// WriteLCOV writes the coverage record in the LCOV tracefile format.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var found, hit int
+	lastModule := ""
+	endRecord := func() {
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", found, hit)
+	}
+	c.eachLine(func(module string, line int32, cov *lineCoverage) {
+		if module != lastModule {
+			if lastModule != "" {
+				endRecord()
+			}
+			fmt.Fprintf(bw, "TN:\nSF:%s\n", module)
+			lastModule, found, hit = module, 0, 0
+		}
+		fmt.Fprintf(bw, "DA:%d,%d\n", line, cov.count)
+		found++
+		if cov.count > 0 {
+			hit++
+		}
+	})
+	if lastModule != "" {
+		endRecord()
+	}
+	return bw.Flush()
+}
+
+// eachLine calls fn for every instrumented line, ordered by module and line.
+func (c *Coverage) eachLine(fn func(module string, line int32, cov *lineCoverage)) {
+	for _, module := range c.Modules() {
+		c.mu.Lock()
+		lines := make([]int32, 0, len(c.modules[module]))
+		for line := range c.modules[module] {
+			lines = append(lines, line)
+		}
+		sort.Slice(lines, func(i, j int) bool { return lines[i] < lines[j] })
+		for _, line := range lines {
+			fn(module, line, c.modules[module][line])
+		}
+		c.mu.Unlock()
+	}
+}
+
+// addModule adds the instrumented lines of a module with an execution
+// count of zero, so that lines never executed are reported.
+func (c *Coverage) addModule(module *instrumentedModule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines, ok := c.modules[module.path]
+	if !ok {
+		lines = make(map[int32]*lineCoverage, len(module.lines))
+		c.modules[module.path] = lines
+	}
+	for line, cov := range module.lines {
+		if _, ok := lines[line]; !ok {
+			lines[line] = &lineCoverage{
+				endCol:     cov.endCol,
+				statements: cov.statements,
+			}
+		}
+	}
+}
+
+func (c *Coverage) record(module string, line int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cov, ok := c.modules[module][line]; ok {
+		cov.count++
+	}
+}
+
+// coverageRecorder is the value of coverageBuiltin.
+var coverageRecorder = starlark.NewBuiltin(coverageBuiltin, func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	cov, _ := t.Local(coverageKey).(*Coverage)
+	if cov == nil {
+		return starlark.None, nil
+	}
+	var line int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &line); err != nil {
+		return nil, err
+	}
+	cov.record(t.CallFrame(1).Pos.Filename(), int32(line))
+	return starlark.None, nil
+})
+
+// An instrumentedModule is the set of lines of a module that record coverage.
+type instrumentedModule struct {
+	path  string
+	lines map[int32]*lineCoverage
+}
+
+// instrumentedModules is shared by every module executed for a config.
+type instrumentedModules struct {
+	mu      sync.Mutex
+	modules map[string]*instrumentedModule
+}
+
+func (m *instrumentedModules) add(module *instrumentedModule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.modules[module.path] = module
+}
+
+// startCoverage prepares cov to record coverage of the instrumented modules.
+// Lines are recorded by threads with cov set as their coverageKey local.
+func (m *instrumentedModules) startCoverage(cov *Coverage) error {
+	if m == nil {
+		return fmt.Errorf("WithCoverage: config was loaded without coverage enabled")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, module := range m.modules {
+		cov.addModule(module)
+	}
+	return nil
+}
+
+// execInstrumented is equivalent to starlark.ExecFile, but inserts a call to
+// coverageBuiltin before each statement of the module. The instrumented lines
+// are passed to register before the module is executed.
+func execInstrumented(
+	thread *starlark.Thread,
+	path string,
+	src []byte,
+	predeclared starlark.StringDict,
+	register func(*instrumentedModule),
+) (starlark.StringDict, error) {
+	f, err := syntax.Parse(path, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	module := &instrumentedModule{
+		path:  path,
+		lines: make(map[int32]*lineCoverage),
+	}
+	lineLengths := bytes.Split(src, []byte("\n"))
+	f.Stmts = instrumentStmts(f.Stmts, true, func(pos syntax.Position) {
+		cov, ok := module.lines[pos.Line]
+		if !ok {
+			cov = &lineCoverage{endCol: 1}
+			if int(pos.Line) <= len(lineLengths) {
+				cov.endCol = int32(len(lineLengths[pos.Line-1]) + 1)
+			}
+			module.lines[pos.Line] = cov
+		}
+		cov.statements++
+	})
+
+	prog, err := starlark.FileProgram(f, predeclared.Has)
+	if err != nil {
+		return nil, err
+	}
+	register(module)
+	globals, err := prog.Init(thread, predeclared)
+	globals.Freeze()
+	return globals, err
+}
+
+// instrumentStmts returns stmts with a call to coverageBuiltin inserted
+// before each statement, recursing into statement bodies. The position of
+// each instrumented statement is passed to visit.
+func instrumentStmts(stmts []syntax.Stmt, docstring bool, visit func(syntax.Position)) []syntax.Stmt {
+	if len(stmts) == 0 {
+		return stmts
+	}
+	out := make([]syntax.Stmt, 0, 2*len(stmts))
+	for ii, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *syntax.DefStmt:
+			stmt.Body = instrumentStmts(stmt.Body, true, visit)
+		case *syntax.ForStmt:
+			stmt.Body = instrumentStmts(stmt.Body, false, visit)
+		case *syntax.WhileStmt:
+			stmt.Body = instrumentStmts(stmt.Body, false, visit)
+		case *syntax.IfStmt:
+			stmt.True = instrumentStmts(stmt.True, false, visit)
+			stmt.False = instrumentStmts(stmt.False, false, visit)
+		}
+
+		// Docstrings must remain the first statement of a module or function.
+		if ii == 0 && docstring && isDocstring(stmt) {
+			out = append(out, stmt)
+			continue
+		}
+
+		pos, _ := stmt.Span()
+		visit(pos)
+		out = append(out, &syntax.ExprStmt{X: &syntax.CallExpr{
+			Fn:     &syntax.Ident{NamePos: pos, Name: coverageBuiltin},
+			Lparen: pos,
+			Args: []syntax.Expr{&syntax.Literal{
+				Token:    syntax.INT,
+				TokenPos: pos,
+				Raw:      strconv.Itoa(int(pos.Line)),
+				Value:    int64(pos.Line),
+			}},
+			Rparen: pos,
+		}}, stmt)
+	}
+	return out
+}
+
+func isDocstring(stmt syntax.Stmt) bool {
+	if expr, ok := stmt.(*syntax.ExprStmt); ok {
+		if lit, ok := expr.X.(*syntax.Literal); ok && lit.Token == syntax.STRING {
+			return true
+		}
+	}
+	return false
+}
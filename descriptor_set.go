@@ -0,0 +1,104 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package skycfg
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/stripe/skycfg/go/protomodule"
+)
+
+// NewDescriptorSetRegistry returns a Protobuf registry containing the types
+// of serialized FileDescriptorSets, such as those written by
+// `protoc --include_imports --descriptor_set_out`, in addition to the compiled
+// types of protoregistry.GlobalTypes.
+//
+// Types that aren't linked into the binary are implemented with dynamicpb,
+// so they can be used with proto.package() without regenerating Go code.
+func NewDescriptorSetRegistry(descriptorSets ...[]byte) (unstableProtoRegistryV2, error) {
+	registry := copyProtoTypes(protoregistry.GlobalTypes)
+	for ii, data := range descriptorSets {
+		if err := registerDescriptorSet(registry, data); err != nil {
+			return nil, fmt.Errorf("NewDescriptorSetRegistry: descriptor set %d: %w", ii, err)
+		}
+	}
+	return NewUnstableProtobufRegistryV2(registry), nil
+}
+
+// WithProtoDescriptorSetFiles adds the types of serialized FileDescriptorSet
+// files to the Protobuf registry used when loading a Skycfg config. Types are
+// added to the registry set by WithProtoRegistry, or protoregistry.GlobalTypes
+// if no registry was set.
+//
+// Errors reading or parsing the files are returned by Load.
+func WithProtoDescriptorSetFiles(paths ...string) LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.descriptorSetFiles = append(opts.descriptorSetFiles, paths...)
+	})
+}
+
+// loadDescriptorSetFiles returns a copy of base, with the types of each
+// descriptor set file added.
+func loadDescriptorSetFiles(base unstableProtoRegistryV2, paths []string) (unstableProtoRegistryV2, error) {
+	baseTypes := protoregistry.GlobalTypes
+	if base != nil {
+		baseTypes = base.UnstableProtobufTypes()
+	}
+	registry := copyProtoTypes(baseTypes)
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := registerDescriptorSet(registry, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return NewUnstableProtobufRegistryV2(registry), nil
+}
+
+func registerDescriptorSet(registry *protoregistry.Types, data []byte) error {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("invalid FileDescriptorSet: %w", err)
+	}
+	return protomodule.RegisterDescriptorSet(registry, set)
+}
+
+func copyProtoTypes(src *protoregistry.Types) *protoregistry.Types {
+	dst := &protoregistry.Types{}
+	// Registration can't fail, because src has no conflicting names.
+	src.RangeEnums(func(t protoreflect.EnumType) bool {
+		_ = dst.RegisterEnum(t)
+		return true
+	})
+	src.RangeMessages(func(t protoreflect.MessageType) bool {
+		_ = dst.RegisterMessage(t)
+		return true
+	})
+	src.RangeExtensions(func(t protoreflect.ExtensionType) bool {
+		_ = dst.RegisterExtension(t)
+		return true
+	})
+	return dst
+}
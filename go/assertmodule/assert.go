@@ -17,6 +17,7 @@
 package assertmodule
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 
@@ -43,6 +44,9 @@ func AssertModule() *TestContext {
 
 	ctx.Attrs["fails"] = starlark.NewBuiltin("assert.fails", ctx.AssertFails)
 
+	ctx.expect = newExpectContext(ctx)
+	ctx.check = newCheckContext(ctx)
+
 	return ctx
 }
 
@@ -87,6 +91,9 @@ func (err assertionError) Error() string {
 type TestContext struct {
 	Attrs    starlark.StringDict
 	Failures []error
+
+	expect *expectContext
+	check  *checkContext
 }
 
 var _ starlark.HasAttrs = (*TestContext)(nil)
@@ -127,8 +134,7 @@ func (t *TestContext) CallInternal(thread *starlark.Thread, args starlark.Tuple,
 		err := assertionError{
 			callStack: thread.CallStack(),
 		}
-		t.Failures = append(t.Failures, err)
-		return nil, err
+		return t.fail(err, true)
 	}
 
 	return starlark.None, nil
@@ -136,6 +142,12 @@ func (t *TestContext) CallInternal(thread *starlark.Thread, args starlark.Tuple,
 
 // AssertBinaryImpl returns a function that implements comparing binary values in an assertion (i.e. assert_eq(1, 2))
 func (t *TestContext) AssertBinaryImpl(op syntax.Token) func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return t.binaryImpl(op, true)
+}
+
+// binaryImpl implements a binary comparison assertion. Failures are always
+// recorded, but only halt execution if fatal is true.
+func (t *TestContext) binaryImpl(op syntax.Token, fatal bool) func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	return func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		var val1 starlark.Value
 		var val2 starlark.Value
@@ -155,8 +167,7 @@ func (t *TestContext) AssertBinaryImpl(op syntax.Token) func(thread *starlark.Th
 				val2:      val2,
 				callStack: thread.CallStack(),
 			}
-			t.Failures = append(t.Failures, err)
-			return nil, err
+			return t.fail(err, fatal)
 		}
 
 		return starlark.None, nil
@@ -164,8 +175,12 @@ func (t *TestContext) AssertBinaryImpl(op syntax.Token) func(thread *starlark.Th
 }
 
 func (t *TestContext) AssertFails(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return t.failsImpl(thread, fn, args, kwargs, true)
+}
+
+func (t *TestContext) failsImpl(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, fatal bool) (starlark.Value, error) {
 	if len(args) < 1 {
-		return nil, fmt.Errorf("assert.fails: missing argument for fn")
+		return nil, fmt.Errorf("%s: missing argument for fn", fn.Name())
 	}
 
 	failFn := args[0]
@@ -190,8 +205,22 @@ func (t *TestContext) AssertFails(thread *starlark.Thread, fn *starlark.Builtin,
 		msg:       fmt.Sprintf("function %s should have failed", failFn.(starlark.Callable).Name()),
 		callStack: thread.CallStack(),
 	}
+	return t.fail(err, fatal)
+}
+
+// fail records an assertion failure. Fatal failures are also returned as an
+// error to halt execution of the test.
+func (t *TestContext) fail(err error, fatal bool) (starlark.Value, error) {
 	t.Failures = append(t.Failures, err)
-	return nil, err
+	if fatal {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+// IsFailure reports whether err was caused by a failed assertion.
+func IsFailure(err error) bool {
+	return errors.As(err, new(assertionError))
 }
 
 var tokenToString = map[syntax.Token]string{
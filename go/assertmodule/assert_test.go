@@ -334,6 +334,139 @@ func TestMultipleAssertionErrors(t *testing.T) {
 	}
 }
 
+func TestExpectDoesNotHalt(t *testing.T) {
+	thread := new(starlark.Thread)
+	assertModule := AssertModule()
+
+	env := starlark.StringDict{
+		"expect": assertModule.Expect(),
+		"fail":   Fail,
+	}
+
+	_, err := starlark.ExecFile(thread, "<expr>", `
+expect(1 == 2)
+expect.equal(1, 2)
+expect.lesser(1, 2)
+expect.fails(print, "this should have failed")
+expect.fails(fail, "this is an expected failure")
+`, env)
+	if err != nil {
+		t.Fatalf("Failing an expectation should not return an error, got: %s", err)
+	}
+
+	wantFailures := []string{
+		"[<expr>:2:7] assertion failed\n",
+		"[<expr>:3:13] assertion failed: 1 (type: int) == 2 (type: int)",
+		"[<expr>:5:13] assertion failed: function print should have failed",
+	}
+	if len(assertModule.Failures) != len(wantFailures) {
+		t.Fatalf("Expected %d expectation failures, but found %d: %v", len(wantFailures), len(assertModule.Failures), assertModule.Failures)
+	}
+	for ii, want := range wantFailures {
+		if got := assertModule.Failures[ii].Error(); !strings.HasPrefix(got, want) {
+			t.Errorf("Expected failure %d to start with %q, got %q", ii, want, got)
+		}
+	}
+
+	_, err = starlark.ExecFile(thread, "<expr>", `expect.equal(1)`, env)
+	if err == nil || !strings.Contains(err.Error(), "expect.equal: got 1 arguments, want 2") {
+		t.Errorf("Expected argument error from expect.equal, got: %v", err)
+	}
+}
+
+func TestCheckShrinksCounterexample(t *testing.T) {
+	thread := new(starlark.Thread)
+	assertModule := AssertModule()
+
+	env := starlark.StringDict{
+		"check":  assertModule.Check(),
+		"assert": assertModule,
+	}
+
+	_, err := starlark.ExecFile(thread, "<expr>", `
+def commutative(x, y):
+	return x + y == y + x
+
+def concat_len(x, y):
+	return len(x + y) == len(x) + len(y)
+
+def short(items):
+	return len(items) < 3
+
+check(commutative, check.int(), check.int(), seed = 1)
+check(concat_len, check.string(), check.string(chars = "xyz"), runs = 20)
+check(short, check.list(check.string(max_len = 4)), seed = 3)
+`, env)
+	if err == nil {
+		t.Fatalf("Expected falsified property to fail the check")
+	}
+	if !IsFailure(err) {
+		t.Fatalf("Expected an assertion failure, got: %v", err)
+	}
+	want := `property short falsified after`
+	if got := err.Error(); !strings.Contains(got, want) || !strings.Contains(got, `(["", "", ""],): property returned False`) {
+		t.Errorf("Expected failure to report shrunk counterexample, got %q", got)
+	}
+	if len(assertModule.Failures) != 1 {
+		t.Fatalf("Expected exactly one failure, found %d: %v", len(assertModule.Failures), assertModule.Failures)
+	}
+
+	_, err = starlark.ExecFile(thread, "<expr>", `
+def small(x):
+	assert.lesser(x, 10)
+
+check(small, check.int(min = -50, max = 50), seed = 7)
+`, env)
+	if err == nil || !strings.Contains(err.Error(), "property small falsified") || !strings.Contains(err.Error(), "by (10,): ") {
+		t.Errorf("Expected int counterexample to shrink to 10, got: %v", err)
+	}
+	if len(assertModule.Failures) != 2 {
+		t.Errorf("Expected assertions made by the property to be replaced by the check failure, found %d: %v", len(assertModule.Failures), assertModule.Failures)
+	}
+
+	_, err = starlark.ExecFile(thread, "<expr>", `check(print, check.int(min = 2, max = 1))`, env)
+	if err == nil || !strings.Contains(err.Error(), "check.int: min 2 is greater than max 1") {
+		t.Errorf("Expected argument error from check.int, got: %v", err)
+	}
+
+	_, err = starlark.ExecFile(thread, "<expr>", `check(print, check.int(max = 1 << 63))`, env)
+	if err == nil || !strings.Contains(err.Error(), "check.int: for parameter max: 9223372036854775808 out of range") {
+		t.Errorf("Expected range error from check.int, got: %v", err)
+	}
+}
+
+func TestCheckIntFullRange(t *testing.T) {
+	thread := new(starlark.Thread)
+	assertModule := AssertModule()
+
+	env := starlark.StringDict{
+		"check":  assertModule.Check(),
+		"assert": assertModule,
+	}
+
+	// The range spans more values than an int64 can count.
+	_, err := starlark.ExecFile(thread, "<expr>", `
+MIN = -(1 << 63)
+MAX = (1 << 63) - 1
+
+def in_range(x):
+	return x >= MIN and x <= MAX
+
+def positive(x):
+	return x > 0
+
+check(in_range, check.int(min = MIN, max = MAX), runs = 200)
+check(in_range, check.int(min = -1, max = MAX), runs = 200)
+check(positive, check.int(min = MIN, max = MAX), seed = 1)
+`, env)
+	if err == nil || !strings.Contains(err.Error(), "property positive falsified") || !strings.Contains(err.Error(), "by (0,): ") {
+		t.Errorf("Expected counterexample to shrink to 0, got: %v", err)
+	}
+	if len(assertModule.Failures) != 1 {
+		t.Errorf("Expected exactly one failure, found %d: %v", len(assertModule.Failures), assertModule.Failures)
+	}
+}
+
 func evalAndReportResults(t *testing.T, cmd string, testCase assertTestCase) {
 	thread := new(starlark.Thread)
 	assertModule := AssertModule()
@@ -0,0 +1,677 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package assertmodule
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/stripe/skycfg/go/protomodule"
+)
+
+const (
+	defaultCheckRuns = 100
+
+	// Upper bound on the number of property calls made while shrinking.
+	maxShrinkCalls = 1000
+
+	defaultChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// checkContext implements property-based tests. Calling it runs a property
+// function against randomly generated inputs, and its attributes construct
+// the generators of those inputs.
+//
+//	ctx.check(property, *generators, runs = 100, seed = 0)
+//
+// A property fails if it returns False or returns an error, such as a
+// failed assertion. Failing inputs are shrunk to a minimal example before
+// being reported as an assertion failure.
+type checkContext struct {
+	parent *TestContext
+	attrs  starlark.StringDict
+}
+
+var _ starlark.HasAttrs = (*checkContext)(nil)
+var _ starlark.Value = (*checkContext)(nil)
+var _ starlark.Callable = (*checkContext)(nil)
+
+func newCheckContext(parent *TestContext) *checkContext {
+	return &checkContext{
+		parent: parent,
+		attrs: starlark.StringDict{
+			"bool":    starlark.NewBuiltin("check.bool", genBool),
+			"dict":    starlark.NewBuiltin("check.dict", genDict),
+			"int":     starlark.NewBuiltin("check.int", genInt),
+			"list":    starlark.NewBuiltin("check.list", genList),
+			"message": starlark.NewBuiltin("check.message", genMessage),
+			"one_of":  starlark.NewBuiltin("check.one_of", genOneOf),
+			"string":  starlark.NewBuiltin("check.string", genString),
+		},
+	}
+}
+
+// Check returns the property-based testing module, for use as `ctx.check`
+// in test functions.
+func (t *TestContext) Check() starlark.Value {
+	return t.check
+}
+
+func (c *checkContext) Name() string          { return "check" }
+func (c *checkContext) String() string        { return "<check_context>" }
+func (c *checkContext) Type() string          { return "check_context" }
+func (c *checkContext) Freeze()               { c.attrs.Freeze() }
+func (c *checkContext) Truth() starlark.Bool  { return starlark.True }
+func (c *checkContext) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", c.Type()) }
+
+func (c *checkContext) Attr(name string) (starlark.Value, error) {
+	if val, ok := c.attrs[name]; ok {
+		return val, nil
+	}
+	return nil, nil
+}
+
+func (c *checkContext) AttrNames() []string {
+	var names []string
+	for name := range c.attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *checkContext) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("check: missing argument for property")
+	}
+	property, ok := args[0].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("check: for parameter 1: got %s, want callable", args[0].Type())
+	}
+	gens := make([]*generator, 0, len(args)-1)
+	for ii, arg := range args[1:] {
+		gen, ok := arg.(*generator)
+		if !ok {
+			return nil, fmt.Errorf("check: for parameter %d: got %s, want check.generator", ii+2, arg.Type())
+		}
+		gens = append(gens, gen)
+	}
+
+	runs := defaultCheckRuns
+	var seed int
+	if err := starlark.UnpackArgs("check", nil, kwargs, "runs?", &runs, "seed?", &seed); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(int64(seed)))
+	for run := 1; run <= runs; run++ {
+		inputs := make(starlark.Tuple, len(gens))
+		for ii, gen := range gens {
+			v, err := gen.generate(rng)
+			if err != nil {
+				return nil, err
+			}
+			inputs[ii] = v
+		}
+		failure := c.try(thread, property, inputs)
+		if failure == "" {
+			continue
+		}
+
+		inputs, failure = c.shrink(thread, property, gens, inputs, failure)
+		return c.parent.fail(assertionError{
+			msg: fmt.Sprintf(
+				"property %s falsified after %d runs (seed %d) by %s: %s",
+				property.Name(), run, seed, inputs.String(), failure,
+			),
+			callStack: thread.CallStack(),
+		}, true)
+	}
+
+	return starlark.None, nil
+}
+
+// try calls property with the given inputs, returning a description of the
+// failure or "" if the property holds. Assertion failures recorded by the
+// property are discarded, since they are reported by the check itself.
+func (c *checkContext) try(thread *starlark.Thread, property starlark.Callable, inputs starlark.Tuple) string {
+	inputs.Freeze()
+	numFailures := len(c.parent.Failures)
+	defer func() { c.parent.Failures = c.parent.Failures[:numFailures] }()
+
+	result, err := starlark.Call(thread, property, inputs, nil)
+	if err != nil {
+		return strings.SplitN(err.Error(), "\n", 2)[0]
+	}
+	if result == starlark.False {
+		return "property returned False"
+	}
+	return ""
+}
+
+// shrink greedily replaces inputs with smaller values that still falsify the
+// property, until no smaller candidate fails.
+func (c *checkContext) shrink(
+	thread *starlark.Thread,
+	property starlark.Callable,
+	gens []*generator,
+	inputs starlark.Tuple,
+	failure string,
+) (starlark.Tuple, string) {
+	calls := 0
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for ii, gen := range gens {
+			for _, candidate := range gen.shrink(inputs[ii]) {
+				if calls >= maxShrinkCalls {
+					return inputs, failure
+				}
+				calls++
+
+				trial := append(starlark.Tuple(nil), inputs...)
+				trial[ii] = candidate
+				if trialFailure := c.try(thread, property, trial); trialFailure != "" {
+					inputs, failure, shrunk = trial, trialFailure, true
+					break
+				}
+			}
+		}
+	}
+	return inputs, failure
+}
+
+// A generator produces random values for property-based tests, and smaller
+// variants of a value for shrinking.
+type generator struct {
+	name     string
+	generate func(rng *rand.Rand) (starlark.Value, error)
+	shrink   func(v starlark.Value) []starlark.Value
+}
+
+var _ starlark.Value = (*generator)(nil)
+
+func (g *generator) String() string        { return fmt.Sprintf("<check.generator %s>", g.name) }
+func (g *generator) Type() string          { return "check.generator" }
+func (g *generator) Freeze()               {}
+func (g *generator) Truth() starlark.Bool  { return starlark.True }
+func (g *generator) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", g.Type()) }
+
+func genBool(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return &generator{
+		name: "bool",
+		generate: func(rng *rand.Rand) (starlark.Value, error) {
+			return starlark.Bool(rng.Intn(2) == 1), nil
+		},
+		shrink: func(v starlark.Value) []starlark.Value {
+			if v == starlark.True {
+				return []starlark.Value{starlark.False}
+			}
+			return nil
+		},
+	}, nil
+}
+
+func genInt(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var minVal, maxVal starlark.Value = starlark.MakeInt(-1000), starlark.MakeInt(1000)
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "min?", &minVal, "max?", &maxVal); err != nil {
+		return nil, err
+	}
+	min, err := int64Arg(fn, "min", minVal)
+	if err != nil {
+		return nil, err
+	}
+	max, err := int64Arg(fn, "max", maxVal)
+	if err != nil {
+		return nil, err
+	}
+	if min > max {
+		return nil, fmt.Errorf("%s: min %d is greater than max %d", fn.Name(), min, max)
+	}
+
+	// Shrink towards the value in range closest to zero.
+	var target int64
+	if target < min {
+		target = min
+	} else if target > max {
+		target = max
+	}
+
+	// The number of values in range, minus one. Computed in unsigned
+	// arithmetic, which can't overflow.
+	span := uint64(max) - uint64(min)
+
+	return &generator{
+		name: fmt.Sprintf("int[%d, %d]", min, max),
+		generate: func(rng *rand.Rand) (starlark.Value, error) {
+			// Favor boundary values, which are likely to find bugs.
+			switch rng.Intn(8) {
+			case 0:
+				return starlark.MakeInt64(min), nil
+			case 1:
+				return starlark.MakeInt64(max), nil
+			case 2:
+				return starlark.MakeInt64(target), nil
+			}
+			return starlark.MakeInt64(int64(uint64(min) + randUint64(rng, span))), nil
+		},
+		shrink: func(v starlark.Value) []starlark.Value {
+			i, ok := v.(starlark.Int)
+			if !ok {
+				return nil
+			}
+			// x and target are on the same side of zero, or target is
+			// zero, so the distance between them fits in an int64.
+			x, ok := i.Int64()
+			if !ok || x == target {
+				return nil
+			}
+			var step int64 = 1
+			if x > target {
+				step = -1
+			}
+			candidates := []starlark.Value{starlark.MakeInt64(target)}
+			if half := target + (x-target)/2; half != target && half != x {
+				candidates = append(candidates, starlark.MakeInt64(half))
+			}
+			if next := x + step; next != target {
+				candidates = append(candidates, starlark.MakeInt64(next))
+			}
+			return candidates
+		},
+	}, nil
+}
+
+// int64Arg returns the value of an int argument of fn, which must fit in an
+// int64.
+func int64Arg(fn *starlark.Builtin, param string, v starlark.Value) (int64, error) {
+	i, ok := v.(starlark.Int)
+	if !ok {
+		return 0, fmt.Errorf("%s: for parameter %s: got %s, want int", fn.Name(), param, v.Type())
+	}
+	x, ok := i.Int64()
+	if !ok {
+		return 0, fmt.Errorf("%s: for parameter %s: %s out of range", fn.Name(), param, i)
+	}
+	return x, nil
+}
+
+// randUint64 returns a uniformly distributed random number in [0, max].
+func randUint64(rng *rand.Rand, max uint64) uint64 {
+	if max < math.MaxInt64 {
+		return uint64(rng.Int63n(int64(max) + 1))
+	}
+	if max == math.MaxUint64 {
+		return rng.Uint64()
+	}
+	// At least half of all values are in range, so few are rejected.
+	for {
+		if x := rng.Uint64(); x <= max {
+			return x
+		}
+	}
+}
+
+func genString(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	minLen, maxLen := 0, 16
+	chars := defaultChars
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "min_len?", &minLen, "max_len?", &maxLen, "chars?", &chars); err != nil {
+		return nil, err
+	}
+	if err := checkLenRange(fn, minLen, maxLen); err != nil {
+		return nil, err
+	}
+	runes := []rune(chars)
+	if len(runes) == 0 {
+		return nil, fmt.Errorf("%s: chars must not be empty", fn.Name())
+	}
+
+	return &generator{
+		name: "string",
+		generate: func(rng *rand.Rand) (starlark.Value, error) {
+			out := make([]rune, minLen+rng.Intn(maxLen-minLen+1))
+			for ii := range out {
+				out[ii] = runes[rng.Intn(len(runes))]
+			}
+			return starlark.String(out), nil
+		},
+		shrink: func(v starlark.Value) []starlark.Value {
+			s := []rune(string(v.(starlark.String)))
+			var candidates []starlark.Value
+			for _, n := range shorterLengths(len(s), minLen) {
+				candidates = append(candidates, starlark.String(s[:n]))
+			}
+			// Replace characters with the first allowed character.
+			for ii, r := range s {
+				if r != runes[0] {
+					simpler := append([]rune(nil), s...)
+					simpler[ii] = runes[0]
+					candidates = append(candidates, starlark.String(simpler))
+				}
+			}
+			return candidates
+		},
+	}, nil
+}
+
+func genOneOf(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: at least one value is required", fn.Name())
+	}
+	values := append(starlark.Tuple(nil), args...)
+	return &generator{
+		name: "one_of",
+		generate: func(rng *rand.Rand) (starlark.Value, error) {
+			return values[rng.Intn(len(values))], nil
+		},
+		shrink: func(v starlark.Value) []starlark.Value {
+			// Earlier values are considered simpler.
+			for ii, value := range values {
+				if eq, err := starlark.Equal(v, value); err == nil && eq {
+					return values[:ii]
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+func genList(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var elements *generator
+	minLen, maxLen := 0, 8
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "elements", &elements, "min_len?", &minLen, "max_len?", &maxLen); err != nil {
+		return nil, err
+	}
+	if err := checkLenRange(fn, minLen, maxLen); err != nil {
+		return nil, err
+	}
+
+	return &generator{
+		name: fmt.Sprintf("list[%s]", elements.name),
+		generate: func(rng *rand.Rand) (starlark.Value, error) {
+			out := make([]starlark.Value, minLen+rng.Intn(maxLen-minLen+1))
+			for ii := range out {
+				v, err := elements.generate(rng)
+				if err != nil {
+					return nil, err
+				}
+				out[ii] = v
+			}
+			return starlark.NewList(out), nil
+		},
+		shrink: func(v starlark.Value) []starlark.Value {
+			list := v.(*starlark.List)
+			items := make([]starlark.Value, list.Len())
+			for ii := range items {
+				items[ii] = list.Index(ii)
+			}
+
+			var candidates []starlark.Value
+			for _, n := range shorterLengths(len(items), minLen) {
+				candidates = append(candidates, starlark.NewList(append([]starlark.Value(nil), items[:n]...)))
+			}
+			if len(items) > minLen {
+				for ii := range items {
+					removed := append(append([]starlark.Value(nil), items[:ii]...), items[ii+1:]...)
+					candidates = append(candidates, starlark.NewList(removed))
+				}
+			}
+			for ii, item := range items {
+				for _, smaller := range elements.shrink(item) {
+					replaced := append([]starlark.Value(nil), items...)
+					replaced[ii] = smaller
+					candidates = append(candidates, starlark.NewList(replaced))
+				}
+			}
+			return candidates
+		},
+	}, nil
+}
+
+func genDict(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var keys, values *generator
+	maxLen := 8
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "keys", &keys, "values", &values, "max_len?", &maxLen); err != nil {
+		return nil, err
+	}
+	if err := checkLenRange(fn, 0, maxLen); err != nil {
+		return nil, err
+	}
+
+	return &generator{
+		name: fmt.Sprintf("dict[%s, %s]", keys.name, values.name),
+		generate: func(rng *rand.Rand) (starlark.Value, error) {
+			n := rng.Intn(maxLen + 1)
+			out := starlark.NewDict(n)
+			// Duplicate keys are merged, so the dict may be smaller than n.
+			for ii := 0; ii < n; ii++ {
+				k, err := keys.generate(rng)
+				if err != nil {
+					return nil, err
+				}
+				v, err := values.generate(rng)
+				if err != nil {
+					return nil, err
+				}
+				if err := out.SetKey(k, v); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		},
+		shrink: func(v starlark.Value) []starlark.Value {
+			items := v.(*starlark.Dict).Items()
+			var candidates []starlark.Value
+			if len(items) > 0 {
+				candidates = append(candidates, starlark.NewDict(0))
+			}
+			for ii := range items {
+				removed := starlark.NewDict(len(items) - 1)
+				for jj, item := range items {
+					if ii != jj {
+						removed.SetKey(item[0], item[1])
+					}
+				}
+				candidates = append(candidates, removed)
+			}
+			for ii, item := range items {
+				for _, smaller := range values.shrink(item[1]) {
+					replaced := starlark.NewDict(len(items))
+					for jj, item := range items {
+						if ii == jj {
+							replaced.SetKey(item[0], smaller)
+						} else {
+							replaced.SetKey(item[0], item[1])
+						}
+					}
+					candidates = append(candidates, replaced)
+				}
+			}
+			return candidates
+		},
+	}, nil
+}
+
+func genMessage(t *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msgType starlark.Callable
+	maxDepth := 2
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "type", &msgType, "max_depth?", &maxDepth); err != nil {
+		return nil, err
+	}
+	if msgType.Type() != "proto.MessageType" {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.MessageType", fn.Name(), msgType.Type())
+	}
+	empty, err := starlark.Call(t, msgType, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	template, ok := protomodule.AsProtoMessage(empty)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s did not construct a proto.Message", fn.Name(), msgType.Name())
+	}
+
+	return &generator{
+		name: msgType.Name(),
+		generate: func(rng *rand.Rand) (starlark.Value, error) {
+			msg := template.ProtoReflect().New()
+			randomMessage(rng, msg, maxDepth)
+			return protomodule.NewMessage(msg.Interface())
+		},
+		shrink: func(v starlark.Value) []starlark.Value {
+			msg, ok := protomodule.AsProtoMessage(v)
+			if !ok {
+				return nil
+			}
+			// Candidates have a single populated field cleared.
+			var candidates []starlark.Value
+			msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+				cleared := proto.Clone(msg)
+				cleared.ProtoReflect().Clear(fd)
+				if candidate, err := protomodule.NewMessage(cleared); err == nil {
+					candidates = append(candidates, candidate)
+				}
+				return true
+			})
+			return candidates
+		},
+	}, nil
+}
+
+// randomMessage populates a random subset of the fields of msg. Message
+// fields are only populated up to depth levels of nesting.
+func randomMessage(rng *rand.Rand, msg protoreflect.Message, depth int) {
+	desc := msg.Descriptor()
+
+	// At most one field of each oneof may be set.
+	oneofs := desc.Oneofs()
+	for ii := 0; ii < oneofs.Len(); ii++ {
+		oneof := oneofs.Get(ii)
+		choice := rng.Intn(oneof.Fields().Len() + 1)
+		if oneof.IsSynthetic() || choice == oneof.Fields().Len() {
+			continue
+		}
+		randomField(rng, msg, oneof.Fields().Get(choice), depth)
+	}
+
+	fields := desc.Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		fd := fields.Get(ii)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			continue
+		}
+		if rng.Intn(2) == 0 {
+			continue
+		}
+		randomField(rng, msg, fd, depth)
+	}
+}
+
+func randomField(rng *rand.Rand, msg protoreflect.Message, fd protoreflect.FieldDescriptor, depth int) {
+	if fd.Message() != nil && depth <= 0 {
+		return
+	}
+	switch {
+	case fd.IsList():
+		list := msg.Mutable(fd).List()
+		for n := rng.Intn(4); n > 0; n-- {
+			if fd.Message() != nil {
+				randomMessage(rng, list.AppendMutable().Message(), depth-1)
+			} else {
+				list.Append(randomScalar(rng, fd))
+			}
+		}
+	case fd.IsMap():
+		m := msg.Mutable(fd).Map()
+		for n := rng.Intn(4); n > 0; n-- {
+			key := randomScalar(rng, fd.MapKey()).MapKey()
+			if fd.MapValue().Message() != nil {
+				randomMessage(rng, m.Mutable(key).Message(), depth-1)
+			} else {
+				m.Set(key, randomScalar(rng, fd.MapValue()))
+			}
+		}
+	case fd.Message() != nil:
+		randomMessage(rng, msg.Mutable(fd).Message(), depth-1)
+	default:
+		msg.Set(fd, randomScalar(rng, fd))
+	}
+}
+
+func randomScalar(rng *rand.Rand, fd protoreflect.FieldDescriptor) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(rng.Intn(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(rng.Intn(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(rng.Intn(201) - 100))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(int64(rng.Intn(201) - 100))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(rng.Intn(201)))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(uint64(rng.Intn(201)))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(rng.Float64()*200 - 100))
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(rng.Float64()*200 - 100)
+	case protoreflect.StringKind:
+		out := make([]byte, rng.Intn(9))
+		for ii := range out {
+			out[ii] = defaultChars[rng.Intn(len(defaultChars))]
+		}
+		return protoreflect.ValueOfString(string(out))
+	case protoreflect.BytesKind:
+		out := make([]byte, rng.Intn(9))
+		rng.Read(out)
+		return protoreflect.ValueOfBytes(out)
+	}
+	panic(fmt.Sprintf("randomScalar: unsupported field kind %v", fd.Kind()))
+}
+
+func checkLenRange(fn *starlark.Builtin, minLen, maxLen int) error {
+	if minLen < 0 || minLen > maxLen {
+		return fmt.Errorf("%s: invalid length range [%d, %d]", fn.Name(), minLen, maxLen)
+	}
+	return nil
+}
+
+// shorterLengths returns candidate lengths for shrinking a sequence of length
+// n, down to a minimum of minLen.
+func shorterLengths(n, minLen int) []int {
+	var lengths []int
+	if n > minLen {
+		lengths = append(lengths, minLen)
+	}
+	if half := n / 2; half > minLen && half < n {
+		lengths = append(lengths, half)
+	}
+	return lengths
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package assertmodule
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/starlark"
+)
+
+// expectContext exposes the same assertions as TestContext, except that
+// failures are recorded in the parent TestContext without halting execution.
+// This lets a single test run report every failed expectation.
+type expectContext struct {
+	parent *TestContext
+	attrs  starlark.StringDict
+}
+
+var _ starlark.HasAttrs = (*expectContext)(nil)
+var _ starlark.Value = (*expectContext)(nil)
+var _ starlark.Callable = (*expectContext)(nil)
+
+func newExpectContext(parent *TestContext) *expectContext {
+	ctx := &expectContext{
+		parent: parent,
+		attrs:  starlark.StringDict{},
+	}
+	for op, str := range tokenToString {
+		ctx.attrs[str] = starlark.NewBuiltin(fmt.Sprintf("expect.%s", str), parent.binaryImpl(op, false))
+	}
+	ctx.attrs["fails"] = starlark.NewBuiltin("expect.fails", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		return parent.failsImpl(thread, fn, args, kwargs, false)
+	})
+	return ctx
+}
+
+// Expect returns the non-fatal counterpart of the assertion module, for use
+// as `ctx.expect` in test functions.
+func (t *TestContext) Expect() starlark.Value {
+	return t.expect
+}
+
+func (e *expectContext) Name() string          { return "expect" }
+func (e *expectContext) String() string        { return "<expect_context>" }
+func (e *expectContext) Type() string          { return "expect_context" }
+func (e *expectContext) Freeze()               { e.attrs.Freeze() }
+func (e *expectContext) Truth() starlark.Bool  { return starlark.True }
+func (e *expectContext) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", e.Type()) }
+
+func (e *expectContext) Attr(name string) (starlark.Value, error) {
+	if val, ok := e.attrs[name]; ok {
+		return val, nil
+	}
+	return nil, nil
+}
+
+func (e *expectContext) AttrNames() []string {
+	var names []string
+	for name := range e.attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *expectContext) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var val bool
+	if err := starlark.UnpackPositionalArgs("expect", args, kwargs, 1, &val); err != nil {
+		return nil, err
+	}
+
+	if !val {
+		return e.parent.fail(assertionError{
+			callStack: thread.CallStack(),
+		}, false)
+	}
+
+	return starlark.None, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mockmodule
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// A Function is a callable Starlark value that records its invocations and
+// returns a fixed value. It can replace builtins or loaded functions in tests.
+type Function struct {
+	name        string
+	returnValue starlark.Value
+	sideEffect  starlark.Callable
+	calls       []Call
+}
+
+var _ starlark.Callable = (*Function)(nil)
+var _ starlark.HasAttrs = (*Function)(nil)
+
+// NewFunction returns a mock function that returns returnValue when called.
+func NewFunction(name string, returnValue starlark.Value) *Function {
+	return &Function{
+		name:        name,
+		returnValue: returnValue,
+	}
+}
+
+// A Call is a single recorded invocation of a mock Function.
+type Call struct {
+	Args   starlark.Tuple
+	Kwargs []starlark.Tuple
+}
+
+// Calls returns the recorded invocations of the function, in order.
+func (fn *Function) Calls() []Call {
+	return fn.calls
+}
+
+func (fn *Function) Name() string          { return fn.name }
+func (fn *Function) String() string        { return fmt.Sprintf("<mock.function %q>", fn.name) }
+func (fn *Function) Type() string          { return "mock.function" }
+func (fn *Function) Freeze()               {}
+func (fn *Function) Truth() starlark.Bool  { return starlark.True }
+func (fn *Function) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", fn.Type()) }
+
+func (fn *Function) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "calls":
+		calls := make([]starlark.Value, 0, len(fn.calls))
+		for _, call := range fn.calls {
+			kwargs := starlark.NewDict(len(call.Kwargs))
+			for _, kwarg := range call.Kwargs {
+				kwargs.SetKey(kwarg[0], kwarg[1])
+			}
+			calls = append(calls, starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+				"args":   call.Args,
+				"kwargs": kwargs,
+			}))
+		}
+		return starlark.NewList(calls), nil
+	case "call_count":
+		return starlark.MakeInt(len(fn.calls)), nil
+	case "return_value":
+		return fn.returnValue, nil
+	}
+	return nil, nil
+}
+
+func (fn *Function) AttrNames() []string {
+	names := []string{"call_count", "calls", "return_value"}
+	sort.Strings(names)
+	return names
+}
+
+func (fn *Function) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	fn.calls = append(fn.calls, Call{
+		Args:   args,
+		Kwargs: kwargs,
+	})
+
+	if fn.sideEffect != nil {
+		return starlark.Call(thread, fn.sideEffect, args, kwargs)
+	}
+	return fn.returnValue, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package mockmodule defines a Starlark module for replacing functions and
+// loaded modules with fakes in Skycfg tests.
+package mockmodule
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// A Loader executes a module for `mock.load_module`, resolving load() calls of
+// faked modules to the given symbols instead of reading them.
+type Loader interface {
+	// Resolve parses the name passed to `mock.module` to a
+	// module path, with the same semantics as load().
+	Resolve(name string) (string, error)
+
+	// Load executes the named module and the modules it loads with a fresh
+	// module cache. load() calls of a module whose resolved path is a key of
+	// fakes return the faked symbols instead.
+	Load(thread *starlark.Thread, name string, fakes map[string]starlark.StringDict) (starlark.StringDict, error)
+}
+
+// NewModule returns a Starlark module of mocking functions, for use as
+// `ctx.mock` in test functions.
+//
+//  mock = module(
+//    function,
+//    load_module,
+//    module,
+//  )
+//
+// Fake modules registered with `mock.module` are only visible to modules
+// executed by `mock.load_module` from the same test context.
+func NewModule(loader Loader) *starlarkstruct.Module {
+	fakes := make(map[string]starlark.StringDict)
+	return &starlarkstruct.Module{
+		Name: "mock",
+		Members: starlark.StringDict{
+			"function":    starlark.NewBuiltin("mock.function", mockFunction),
+			"load_module": starlark.NewBuiltin("mock.load_module", mockLoadModule(loader, fakes)),
+			"module":      starlark.NewBuiltin("mock.module", mockModule(loader, fakes)),
+		},
+	}
+}
+
+func mockFunction(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	name := "mock"
+	var returnValue starlark.Value = starlark.None
+	var sideEffect starlark.Callable
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"name?", &name,
+		"return_value?", &returnValue,
+		"side_effect?", &sideEffect,
+	); err != nil {
+		return nil, err
+	}
+	mock := NewFunction(name, returnValue)
+	mock.sideEffect = sideEffect
+	return mock, nil
+}
+
+func mockModule(loader Loader, fakes map[string]starlark.StringDict) func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	return func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var name string
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, nil, 1, &name); err != nil {
+			return nil, err
+		}
+		path, err := loader.Resolve(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		symbols := make(starlark.StringDict, len(kwargs))
+		for _, kwarg := range kwargs {
+			symbols[string(kwarg[0].(starlark.String))] = kwarg[1]
+		}
+		fakes[path] = symbols
+		return starlark.None, nil
+	}
+}
+
+func mockLoadModule(loader Loader, fakes map[string]starlark.StringDict) func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	return func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var name string
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &name); err != nil {
+			return nil, err
+		}
+		globals, err := loader.Load(t, name, fakes)
+		if err != nil {
+			return nil, err
+		}
+		return &starlarkstruct.Module{
+			Name:    name,
+			Members: globals,
+		}, nil
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mockmodule
+
+import (
+	"fmt"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+// fakeLoader executes modules from a map of sources.
+type fakeLoader map[string]string
+
+func (l fakeLoader) Resolve(name string) (string, error) {
+	return "fake/" + name, nil
+}
+
+func (l fakeLoader) Load(thread *starlark.Thread, name string, fakes map[string]starlark.StringDict) (starlark.StringDict, error) {
+	loadThread := &starlark.Thread{
+		Load: func(thread *starlark.Thread, name string) (starlark.StringDict, error) {
+			path, _ := l.Resolve(name)
+			if fake, ok := fakes[path]; ok {
+				return fake, nil
+			}
+			return l.Load(thread, name, fakes)
+		},
+	}
+	src, ok := l[name]
+	if !ok {
+		return nil, fmt.Errorf("module %q not found", name)
+	}
+	return starlark.ExecFile(loadThread, name, src, nil)
+}
+
+func TestMockFunction(t *testing.T) {
+	thread := new(starlark.Thread)
+	env := starlark.StringDict{
+		"mock": NewModule(fakeLoader{}),
+	}
+
+	globals, err := starlark.ExecFile(thread, "<expr>", `
+fn = mock.function(return_value = 42)
+r1 = fn(1, 2, key = "value")
+r2 = fn()
+def double(x):
+	return x * 2
+side = mock.function(side_effect = double)
+r3 = side(21)
+`, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"r1", "r2", "r3"} {
+		if got := globals[name].String(); got != "42" {
+			t.Errorf("%s: expected 42, got %s", name, got)
+		}
+	}
+
+	fn := globals["fn"].(*Function)
+	calls := fn.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 recorded calls, got %d", len(calls))
+	}
+	if got := calls[0].Args.String(); got != "(1, 2)" {
+		t.Errorf("Expected args (1, 2), got %s", got)
+	}
+	if len(calls[0].Kwargs) != 1 || calls[0].Kwargs[0].String() != `("key", "value")` {
+		t.Errorf("Expected kwargs key = \"value\", got %v", calls[0].Kwargs)
+	}
+
+	for expr, want := range map[string]string{
+		"fn.call_count":         "2",
+		"fn.calls[0].args":      "(1, 2)",
+		"fn.calls[0].kwargs":    `{"key": "value"}`,
+		"fn.calls[1].args":      "()",
+		"fn.return_value":       "42",
+		"side.calls[0].args[0]": "21",
+		"mock.function()":       `<mock.function "mock">`,
+	} {
+		globals["mock"] = env["mock"]
+		v, err := starlark.Eval(thread, "<expr>", expr, globals)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if v.String() != want {
+			t.Errorf("%s: expected %s, got %s", expr, want, v)
+		}
+	}
+}
+
+func TestMockLoad(t *testing.T) {
+	thread := new(starlark.Thread)
+	loader := fakeLoader{
+		"lib.sky": `
+load("dep.sky", "dep")
+
+def helper():
+	return dep() + 1
+`,
+		"dep.sky": `
+def dep():
+	return 1
+`,
+	}
+	env := starlark.StringDict{
+		"mock": NewModule(loader),
+	}
+
+	v, err := starlark.Eval(thread, "<expr>", `mock.load_module("lib.sky").helper()`, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "2" {
+		t.Errorf("Expected real module result 2, got %s", got)
+	}
+
+	globals, err := starlark.ExecFile(thread, "<expr>", `
+dep = mock.function(return_value = 41)
+mock.module("dep.sky", dep = dep)
+result = mock.load_module("lib.sky").helper()
+`, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := globals["result"].String(); got != "42" {
+		t.Errorf("Expected faked module result 42, got %s", got)
+	}
+	if got := len(globals["dep"].(*Function).Calls()); got != 1 {
+		t.Errorf("Expected fake to be called once, got %d", got)
+	}
+
+	_, err = starlark.Eval(thread, "<expr>", `mock.load_module("missing.sky")`, env)
+	if err == nil || err.Error() != `module "missing.sky" not found` {
+		t.Errorf("Expected error for missing module, got %v", err)
+	}
+}
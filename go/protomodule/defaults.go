@@ -0,0 +1,282 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A ModuleOption adjusts the behavior of the module returned by NewModule.
+type ModuleOption func(*moduleOptions)
+
+type moduleOptions struct {
+	defaults []proto.Message
+	conv     conversionOptions
+}
+
+// WithMessageDefaults registers the set fields of each message as default
+// values for messages of its type, as if passed to proto.register_defaults.
+func WithMessageDefaults(msgs ...proto.Message) ModuleOption {
+	return func(opts *moduleOptions) {
+		opts.defaults = append(opts.defaults, msgs...)
+	}
+}
+
+// WithEnumConversion allows enum fields to be assigned the name or number
+// of an enum value, such as "FOO" or 3, in messages constructed by the
+// module's message types.
+func WithEnumConversion() ModuleOption {
+	return func(opts *moduleOptions) {
+		opts.conv.enumNames = true
+	}
+}
+
+// WithStructValues causes fields of type google.protobuf.Struct, Value, and
+// ListValue to be read as plain Starlark dicts, lists, and scalars, in
+// messages constructed by the module's message types. By default they're
+// read as messages.
+func WithStructValues() ModuleOption {
+	return func(opts *moduleOptions) {
+		opts.conv.structValues = true
+	}
+}
+
+// messageTypeOptions adjust the messages constructed by a message type.
+type messageTypeOptions struct {
+	// Whether constructed messages are frozen.
+	frozen bool
+
+	// Default values set on constructed messages before any arguments.
+	defaults *messageDefaults
+
+	// How field values of constructed messages are converted.
+	conv conversionOptions
+}
+
+// messageDefaults holds the default values registered for message types.
+// It's shared by all message types of a module, and may be modified while
+// modules are loaded.
+type messageDefaults struct {
+	mu      sync.RWMutex
+	entries map[protoreflect.FullName]defaultsEntry
+
+	// How field values of defaults given as dicts are converted.
+	conv conversionOptions
+}
+
+type defaultsEntry struct {
+	// A message whose set fields are the default values.
+	template proto.Message
+
+	// If set, called for each new message instead of copying template.
+	factory starlark.Callable
+}
+
+// Set as a thread local while calling a factory, so that messages of the
+// factory's own type are constructed without defaults.
+const defaultsFactoryKey = "protomodule.defaults_factory"
+
+// Set as a thread local by DisableDefaultsRegistration.
+const defaultsDisabledKey = "protomodule.defaults_disabled"
+
+// DisableDefaultsRegistration causes proto.register_defaults to fail on a
+// thread, even while it's loading a module. Threads that load modules after
+// the config was loaded, such as those of tests, would otherwise change the
+// defaults of every later execution of the config.
+func DisableDefaultsRegistration(thread *starlark.Thread) {
+	thread.SetLocal(defaultsDisabledKey, true)
+}
+
+func newMessageDefaults(msgs []proto.Message, conv conversionOptions) *messageDefaults {
+	d := &messageDefaults{
+		entries: make(map[protoreflect.FullName]defaultsEntry),
+		conv:    conv,
+	}
+	for _, msg := range msgs {
+		d.entries[msg.ProtoReflect().Descriptor().FullName()] = defaultsEntry{template: proto.Clone(msg)}
+	}
+	return d
+}
+
+func (d *messageDefaults) set(name protoreflect.FullName, entry *defaultsEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if entry == nil {
+		delete(d.entries, name)
+		return
+	}
+	d.entries[name] = *entry
+}
+
+// newMessage returns a new message of the same type as emptyMsg, with any
+// default values registered for its type.
+func (d *messageDefaults) newMessage(thread *starlark.Thread, emptyMsg proto.Message) (*protoMessage, error) {
+	name := emptyMsg.ProtoReflect().Descriptor().FullName()
+	var entry defaultsEntry
+	var ok bool
+	if d != nil {
+		d.mu.RLock()
+		entry, ok = d.entries[name]
+		d.mu.RUnlock()
+	}
+	// Neither emptyMsg nor registered templates are modified, so they
+	// can be shared rather than copied.
+	if !ok || (thread != nil && thread.Local(defaultsFactoryKey) == name) {
+		return newLazyMessage(emptyMsg.ProtoReflect()), nil
+	}
+	if entry.factory == nil {
+		return newLazyMessage(entry.template.ProtoReflect()), nil
+	}
+
+	prev := thread.Local(defaultsFactoryKey)
+	thread.SetLocal(defaultsFactoryKey, name)
+	val, err := starlark.Call(thread, entry.factory, nil, nil)
+	thread.SetLocal(defaultsFactoryKey, prev)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := defaultsToMessage(emptyMsg, val, d.conv)
+	if err != nil {
+		return nil, fmt.Errorf("defaults factory for %s: %v", name, err)
+	}
+	return msg, nil
+}
+
+// applyUnset sets any unset fields of msg that have registered defaults.
+func (d *messageDefaults) applyUnset(thread *starlark.Thread, msg *protoMessage) error {
+	defaults, err := d.newMessage(thread, msg.msg)
+	if err != nil {
+		return err
+	}
+	if err := defaults.load(); err != nil {
+		return err
+	}
+	if err := msg.load(); err != nil {
+		return err
+	}
+	for _, name := range fieldNames(msg.msgDesc) {
+		val, ok := defaults.fields[name]
+		if !ok {
+			continue
+		}
+		if _, ok := msg.fields[name]; ok {
+			continue
+		}
+		if err := msg.SetField(name, val); err != nil {
+			return err
+		}
+	}
+	for name, ext := range defaults.extensions {
+		if _, ok := msg.extensions[name]; ok {
+			continue
+		}
+		if err := msg.setExtension(ext.extType, ext.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultsToMessage returns a new message of the same type as emptyMsg
+// from a message of that type or a dict of field values.
+func defaultsToMessage(emptyMsg proto.Message, val starlark.Value, conv conversionOptions) (*protoMessage, error) {
+	msgName := string(emptyMsg.ProtoReflect().Descriptor().FullName())
+	switch val := val.(type) {
+	case *protoMessage:
+		if val.Type() != msgName {
+			return nil, fmt.Errorf("got %s, want %s", val.Type(), msgName)
+		}
+		return NewMessage(val.toProtoMessage())
+	case *starlark.Dict:
+		msg, err := NewMessage(emptyMsg)
+		if err != nil {
+			return nil, err
+		}
+		msg.conv = conv
+		for _, item := range val.Items() {
+			name, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("got %s key, want string", item[0].Type())
+			}
+			if err := msg.SetField(name, item[1]); err != nil {
+				return nil, err
+			}
+		}
+		return msg, nil
+	}
+	return nil, fmt.Errorf("got %s, want %s or dict", val.Type(), msgName)
+}
+
+func registerDefaults(defaults *messageDefaults) starlark.Callable {
+	return starlark.NewBuiltin("proto.register_defaults", func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var typeVal, val starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &typeVal, &val); err != nil {
+			return nil, err
+		}
+		// Defaults are shared by every later execution of the config, so
+		// they can only be changed while its modules are being loaded.
+		if t.Local(defaultsDisabledKey) == true {
+			return nil, fmt.Errorf("%s: defaults can't be registered by a module loaded after the config", fn.Name())
+		}
+		if !isLoading(t) {
+			return nil, fmt.Errorf("%s: defaults can only be registered while loading a module, not by a function called after loading", fn.Name())
+		}
+		msgType, ok := typeVal.(*protoMessageType)
+		if !ok {
+			return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.MessageType", fn.Name(), typeVal.Type())
+		}
+
+		name := msgType.descriptor.FullName()
+		switch val := val.(type) {
+		case starlark.NoneType:
+			defaults.set(name, nil)
+		case *protoMessage, *starlark.Dict:
+			template, err := defaultsToMessage(msgType.emptyMsg, val, defaults.conv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: for parameter 2: %v", fn.Name(), err)
+			}
+			defaults.set(name, &defaultsEntry{template: template.toProtoMessage()})
+		case *protoMessageType:
+			return nil, fmt.Errorf("%s: for parameter 2: got %s, want %s, dict, or function", fn.Name(), val.Type(), name)
+		case starlark.Callable:
+			defaults.set(name, &defaultsEntry{factory: val})
+		default:
+			return nil, fmt.Errorf("%s: for parameter 2: got %s, want %s, dict, or function", fn.Name(), val.Type(), name)
+		}
+		return starlark.None, nil
+	})
+}
+
+// isLoading reports whether a thread is executing the top level of a module,
+// rather than a function called after the module was loaded.
+func isLoading(thread *starlark.Thread) bool {
+	switch thread.CallFrame(thread.CallStackDepth() - 1).Name {
+	case "<toplevel>", "<expr>":
+		return true
+	}
+	return false
+}
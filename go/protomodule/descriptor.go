@@ -0,0 +1,212 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// descriptor returns the `proto.descriptor()` builtin, which describes a
+// message type, enum type, or extension as a tree of frozen structs.
+func descriptor(registry *protoregistry.Types, opts messageTypeOptions) starlark.Callable {
+	return starlark.NewBuiltin("proto.descriptor", func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var val starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &val); err != nil {
+			return nil, err
+		}
+
+		var out starlark.Value
+		var err error
+		switch val := val.(type) {
+		case *protoMessageType:
+			out, err = messageDescriptorToStarlark(registry, opts, val.descriptor)
+		case *protoMessage:
+			out, err = messageDescriptorToStarlark(registry, opts, val.msgDesc)
+		case *protoEnumType:
+			out, err = enumDescriptorToStarlark(registry, val.descriptor)
+		case *protoExtension:
+			out, err = fieldDescriptorToStarlark(registry, opts, val.extType.TypeDescriptor())
+		default:
+			return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.MessageType, proto.EnumType, or proto.Extension", fn.Name(), val.Type())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		out.Freeze()
+		return out, nil
+	})
+}
+
+func messageDescriptorToStarlark(registry *protoregistry.Types, opts messageTypeOptions, desc protoreflect.MessageDescriptor) (starlark.Value, error) {
+	fields := make([]starlark.Value, 0, desc.Fields().Len())
+	for ii := 0; ii < desc.Fields().Len(); ii++ {
+		field, err := fieldDescriptorToStarlark(registry, opts, desc.Fields().Get(ii))
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	var oneofs []starlark.Value
+	for ii := 0; ii < desc.Oneofs().Len(); ii++ {
+		oneof := desc.Oneofs().Get(ii)
+		if oneof.IsSynthetic() {
+			continue
+		}
+		var names []starlark.Value
+		for jj := 0; jj < oneof.Fields().Len(); jj++ {
+			names = append(names, starlark.String(oneof.Fields().Get(jj).Name()))
+		}
+		oneofs = append(oneofs, starlarkstruct.FromStringDict(starlark.String("proto.OneofDescriptor"), starlark.StringDict{
+			"name":   starlark.String(oneof.Name()),
+			"fields": starlark.NewList(names),
+		}))
+	}
+
+	options, err := optionsToStarlark(registry, desc.Options(), &descriptorpb.MessageOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("proto.MessageDescriptor"), starlark.StringDict{
+		"name":      starlark.String(desc.Name()),
+		"full_name": starlark.String(desc.FullName()),
+		"file":      starlark.String(desc.ParentFile().Path()),
+		"fields":    starlark.NewList(fields),
+		"oneofs":    starlark.NewList(oneofs),
+		"options":   options,
+	}), nil
+}
+
+func fieldDescriptorToStarlark(registry *protoregistry.Types, opts messageTypeOptions, desc protoreflect.FieldDescriptor) (starlark.Value, error) {
+	var defaultVal starlark.Value = starlark.None
+	if !desc.IsList() && !desc.IsMap() && desc.Message() == nil {
+		var err error
+		defaultVal, err = valueToStarlark(desc.Default(), desc, opts.conv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var messageType, enumType starlark.Value = starlark.None, starlark.None
+	if msgDesc := desc.Message(); msgDesc != nil && !desc.IsMap() {
+		messageType = newMessageType(registry, findMessageType(registry, msgDesc).New().Interface(), opts)
+	}
+	if enumDesc := desc.Enum(); enumDesc != nil {
+		enumType = newEnumType(enumDesc)
+	}
+
+	var mapKey, mapValue starlark.Value = starlark.None, starlark.None
+	if desc.IsMap() {
+		var err error
+		if mapKey, err = fieldDescriptorToStarlark(registry, opts, desc.MapKey()); err != nil {
+			return nil, err
+		}
+		if mapValue, err = fieldDescriptorToStarlark(registry, opts, desc.MapValue()); err != nil {
+			return nil, err
+		}
+	}
+
+	var oneof starlark.Value = starlark.None
+	if containing := desc.ContainingOneof(); containing != nil && !containing.IsSynthetic() {
+		oneof = starlark.String(containing.Name())
+	}
+
+	var extendee starlark.Value = starlark.None
+	if desc.IsExtension() {
+		extendee = starlark.String(desc.ContainingMessage().FullName())
+	}
+
+	options, err := optionsToStarlark(registry, desc.Options(), &descriptorpb.FieldOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("proto.FieldDescriptor"), starlark.StringDict{
+		"name":         starlark.String(desc.Name()),
+		"full_name":    starlark.String(desc.FullName()),
+		"number":       starlark.MakeInt(int(desc.Number())),
+		"type":         starlark.String(desc.Kind().String()),
+		"label":        starlark.String(desc.Cardinality().String()),
+		"json_name":    starlark.String(desc.JSONName()),
+		"default":      defaultVal,
+		"has_default":  starlark.Bool(desc.HasDefault()),
+		"has_presence": starlark.Bool(desc.HasPresence()),
+		"message_type": messageType,
+		"enum_type":    enumType,
+		"is_map":       starlark.Bool(desc.IsMap()),
+		"map_key":      mapKey,
+		"map_value":    mapValue,
+		"oneof":        oneof,
+		"extendee":     extendee,
+		"options":      options,
+	}), nil
+}
+
+func enumDescriptorToStarlark(registry *protoregistry.Types, desc protoreflect.EnumDescriptor) (starlark.Value, error) {
+	values := make([]starlark.Value, 0, desc.Values().Len())
+	for ii := 0; ii < desc.Values().Len(); ii++ {
+		value := desc.Values().Get(ii)
+		options, err := optionsToStarlark(registry, value.Options(), &descriptorpb.EnumValueOptions{})
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, starlarkstruct.FromStringDict(starlark.String("proto.EnumValueDescriptor"), starlark.StringDict{
+			"name":    starlark.String(value.Name()),
+			"number":  starlark.MakeInt(int(value.Number())),
+			"options": options,
+		}))
+	}
+
+	options, err := optionsToStarlark(registry, desc.Options(), &descriptorpb.EnumOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("proto.EnumDescriptor"), starlark.StringDict{
+		"name":      starlark.String(desc.Name()),
+		"full_name": starlark.String(desc.FullName()),
+		"file":      starlark.String(desc.ParentFile().Path()),
+		"values":    starlark.NewList(values),
+		"options":   options,
+	}), nil
+}
+
+// optionsToStarlark converts a descriptor's options to a message, decoding
+// custom options as extensions if they're present in the registry.
+func optionsToStarlark(registry *protoregistry.Types, options proto.Message, out proto.Message) (starlark.Value, error) {
+	raw, err := proto.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := (proto.UnmarshalOptions{Resolver: registry}).Unmarshal(raw, out); err != nil {
+		return nil, err
+	}
+	return NewMessage(out)
+}
@@ -0,0 +1,190 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// RegisterDescriptorSet adds the message, enum, and extension types defined
+// by the files of a FileDescriptorSet to registry, so that they can be used
+// without compiled Go types.
+//
+// Files that are linked into the binary, such as the well-known types, are
+// registered with their compiled Go types. Other types are implemented with
+// dynamicpb. Types already present in the registry are left unchanged.
+func RegisterDescriptorSet(registry *protoregistry.Types, set *descriptorpb.FileDescriptorSet) error {
+	b := &descriptorSetBuilder{
+		protos: make(map[string]*descriptorpb.FileDescriptorProto),
+		files:  &protoregistry.Files{},
+		built:  make(map[string]bool),
+	}
+	for _, file := range set.GetFile() {
+		b.protos[file.GetName()] = file
+	}
+
+	for _, file := range set.GetFile() {
+		fileDesc, err := b.build(file.GetName(), nil)
+		if err != nil {
+			return err
+		}
+		if err := registerFile(registry, fileDesc); err != nil {
+			return fmt.Errorf("%s: %w", file.GetName(), err)
+		}
+	}
+	return nil
+}
+
+type descriptorSetBuilder struct {
+	protos map[string]*descriptorpb.FileDescriptorProto
+	files  *protoregistry.Files
+	built  map[string]bool
+}
+
+// build returns the descriptor of the named file, after building the files
+// it depends on. Files already known to protoregistry.GlobalFiles are used
+// as-is, so that their messages match the compiled Go types.
+func (b *descriptorSetBuilder) build(path string, importedBy []string) (protoreflect.FileDescriptor, error) {
+	if fileDesc, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+		return fileDesc, nil
+	}
+	if b.built[path] {
+		return b.files.FindFileByPath(path)
+	}
+	for _, importer := range importedBy {
+		if importer == path {
+			return nil, fmt.Errorf("%s: import cycle through %q", path, importedBy)
+		}
+	}
+
+	file, ok := b.protos[path]
+	if !ok {
+		return nil, fmt.Errorf("%s: not found in descriptor set (imported by %s)", path, importedBy[len(importedBy)-1])
+	}
+	for _, dep := range file.GetDependency() {
+		if _, err := b.build(dep, append(importedBy, path)); err != nil {
+			return nil, err
+		}
+	}
+
+	fileDesc, err := protodesc.NewFile(file, descriptorSetResolver{b.files})
+	if err != nil {
+		return nil, err
+	}
+	if err := b.files.RegisterFile(fileDesc); err != nil {
+		return nil, err
+	}
+	b.built[path] = true
+	return fileDesc, nil
+}
+
+// descriptorSetResolver resolves dependencies against files built from the
+// descriptor set, falling back to protoregistry.GlobalFiles.
+type descriptorSetResolver struct {
+	files *protoregistry.Files
+}
+
+func (r descriptorSetResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fileDesc, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+		return fileDesc, nil
+	}
+	return r.files.FindFileByPath(path)
+}
+
+func (r descriptorSetResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if desc, err := r.files.FindDescriptorByName(name); err == nil {
+		return desc, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+type typeContainer interface {
+	Enums() protoreflect.EnumDescriptors
+	Messages() protoreflect.MessageDescriptors
+	Extensions() protoreflect.ExtensionDescriptors
+}
+
+func registerFile(registry *protoregistry.Types, fileDesc protoreflect.FileDescriptor) error {
+	// Linked files are registered with their compiled types.
+	_, err := protoregistry.GlobalFiles.FindFileByPath(fileDesc.Path())
+	return registerTypes(registry, fileDesc, err == nil)
+}
+
+func registerTypes(registry *protoregistry.Types, container typeContainer, linked bool) error {
+	enums := container.Enums()
+	for ii := 0; ii < enums.Len(); ii++ {
+		desc := enums.Get(ii)
+		if _, err := registry.FindEnumByName(desc.FullName()); err == nil {
+			continue
+		}
+		enumType := dynamicpb.NewEnumType(desc)
+		if linked {
+			if globalType, err := protoregistry.GlobalTypes.FindEnumByName(desc.FullName()); err == nil {
+				enumType = globalType
+			}
+		}
+		if err := registry.RegisterEnum(enumType); err != nil {
+			return err
+		}
+	}
+
+	messages := container.Messages()
+	for ii := 0; ii < messages.Len(); ii++ {
+		desc := messages.Get(ii)
+		if desc.IsMapEntry() {
+			continue
+		}
+		if _, err := registry.FindMessageByName(desc.FullName()); err != nil {
+			msgType := dynamicpb.NewMessageType(desc)
+			if linked {
+				if globalType, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName()); err == nil {
+					msgType = globalType
+				}
+			}
+			if err := registry.RegisterMessage(msgType); err != nil {
+				return err
+			}
+		}
+		if err := registerTypes(registry, desc, linked); err != nil {
+			return err
+		}
+	}
+
+	extensions := container.Extensions()
+	for ii := 0; ii < extensions.Len(); ii++ {
+		desc := extensions.Get(ii)
+		if _, err := registry.FindExtensionByName(desc.FullName()); err == nil {
+			continue
+		}
+		extType := dynamicpb.NewExtensionType(desc)
+		if linked {
+			if globalType, err := protoregistry.GlobalTypes.FindExtensionByName(desc.FullName()); err == nil {
+				extType = globalType
+			}
+		}
+		if err := registry.RegisterExtension(extType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A FieldChange is a difference between two messages, as found by Diff.
+type FieldChange struct {
+	// Path of the changed value, such as "spec.ports[0].name" or
+	// `labels["app"]`.
+	Path string
+
+	// Field describes Old and New. For elements of repeated fields, it is
+	// the repeated field; for map entries, it is the map's value field.
+	//
+	// Field is nil for unknown fields, which have a path ending in their
+	// field number and values holding their wire-format bytes.
+	Field protoreflect.FieldDescriptor
+
+	// The values before and after the change. Old is invalid if the value
+	// was added, and New is invalid if it was removed.
+	Old protoreflect.Value
+	New protoreflect.Value
+}
+
+// Diff returns the differences between two messages of the same type.
+// Nested messages set in both are compared field by field, repeated fields
+// are compared by index, and maps by key. Changed extensions follow the
+// message's fields, with paths such as "[pkg.ext]", and are followed by
+// changed unknown fields.
+//
+// A scalar field without presence that is changed to or from its zero value
+// is reported as modified, not as added or removed.
+//
+// Diff can compare the messages returned by successive evaluations of a
+// config, to show what a change to the config will alter.
+func Diff(a, b proto.Message) ([]FieldChange, error) {
+	aReflect, bReflect := a.ProtoReflect(), b.ProtoReflect()
+	if aName, bName := aReflect.Descriptor().FullName(), bReflect.Descriptor().FullName(); aName != bName {
+		return nil, fmt.Errorf("can't diff messages of different types %s and %s", aName, bName)
+	}
+	var changes []FieldChange
+	diffMessages(&changes, "", aReflect, bReflect)
+	return changes, nil
+}
+
+func diffMessages(changes *[]FieldChange, prefix string, a, b protoreflect.Message) {
+	fields := a.Descriptor().Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		field := fields.Get(ii)
+		diffFields(changes, joinDiffPath(prefix, string(field.Name())), field, a, b)
+	}
+
+	var extensions []protoreflect.FieldDescriptor
+	seen := make(map[protoreflect.FullName]bool)
+	collectExtensions := func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if field.IsExtension() && !seen[field.FullName()] {
+			seen[field.FullName()] = true
+			extensions = append(extensions, field)
+		}
+		return true
+	}
+	a.Range(collectExtensions)
+	b.Range(collectExtensions)
+	sort.Slice(extensions, func(i, j int) bool {
+		return extensions[i].Number() < extensions[j].Number()
+	})
+	for _, ext := range extensions {
+		diffFields(changes, joinDiffPath(prefix, "["+string(ext.FullName())+"]"), ext, a, b)
+	}
+
+	diffUnknown(changes, prefix, a.GetUnknown(), b.GetUnknown())
+}
+
+func joinDiffPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// diffFields compares a field, or an extension, of two messages.
+func diffFields(changes *[]FieldChange, path string, field protoreflect.FieldDescriptor, a, b protoreflect.Message) {
+	aHas, bHas := a.Has(field), b.Has(field)
+	if !aHas && !bHas {
+		return
+	}
+	switch {
+	case field.IsList():
+		diffLists(changes, path, field, a.Get(field).List(), b.Get(field).List())
+	case field.IsMap():
+		diffMaps(changes, path, field, a.Get(field).Map(), b.Get(field).Map())
+	case (aHas && bHas) || !field.HasPresence():
+		// Without presence, an unset field has its zero value.
+		diffValues(changes, path, field, a.Get(field), b.Get(field))
+	case aHas:
+		*changes = append(*changes, FieldChange{Path: path, Field: field, Old: a.Get(field)})
+	default:
+		*changes = append(*changes, FieldChange{Path: path, Field: field, New: b.Get(field)})
+	}
+}
+
+// diffUnknown compares the unknown fields of two messages by field number.
+func diffUnknown(changes *[]FieldChange, prefix string, a, b protoreflect.RawFields) {
+	aFields, bFields := unknownFields(a), unknownFields(b)
+	var nums []protowire.Number
+	for num := range aFields {
+		nums = append(nums, num)
+	}
+	for num := range bFields {
+		if _, ok := aFields[num]; !ok {
+			nums = append(nums, num)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	for _, num := range nums {
+		path := joinDiffPath(prefix, strconv.Itoa(int(num)))
+		aRaw, aOk := aFields[num]
+		bRaw, bOk := bFields[num]
+		switch {
+		case !bOk:
+			*changes = append(*changes, FieldChange{Path: path, Old: protoreflect.ValueOfBytes(aRaw)})
+		case !aOk:
+			*changes = append(*changes, FieldChange{Path: path, New: protoreflect.ValueOfBytes(bRaw)})
+		case string(aRaw) != string(bRaw):
+			*changes = append(*changes, FieldChange{
+				Path: path,
+				Old:  protoreflect.ValueOfBytes(aRaw),
+				New:  protoreflect.ValueOfBytes(bRaw),
+			})
+		}
+	}
+}
+
+// unknownFields splits raw unknown fields by field number. The bytes of each
+// number are the concatenated encodings of its occurrences.
+func unknownFields(raw protoreflect.RawFields) map[protowire.Number][]byte {
+	fields := make(map[protowire.Number][]byte)
+	for len(raw) > 0 {
+		num, _, n := protowire.ConsumeField(raw)
+		if n < 0 {
+			// Malformed fields are compared as a whole.
+			fields[0] = append(fields[0], raw...)
+			break
+		}
+		fields[num] = append(fields[num], raw[:n]...)
+		raw = raw[n:]
+	}
+	return fields
+}
+
+func diffValues(changes *[]FieldChange, path string, field protoreflect.FieldDescriptor, a, b protoreflect.Value) {
+	if field.Message() != nil {
+		diffMessages(changes, path, a.Message(), b.Message())
+		return
+	}
+	if !scalarEqual(field, a, b) {
+		*changes = append(*changes, FieldChange{Path: path, Field: field, Old: a, New: b})
+	}
+}
+
+func scalarEqual(field protoreflect.FieldDescriptor, a, b protoreflect.Value) bool {
+	switch field.Kind() {
+	case protoreflect.BytesKind:
+		return string(a.Bytes()) == string(b.Bytes())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		// NaN values are considered equal, as they are by proto.Equal.
+		af, bf := a.Float(), b.Float()
+		return af == bf || (af != af && bf != bf)
+	}
+	return a.Interface() == b.Interface()
+}
+
+func diffLists(changes *[]FieldChange, path string, field protoreflect.FieldDescriptor, a, b protoreflect.List) {
+	for ii := 0; ii < a.Len() || ii < b.Len(); ii++ {
+		elemPath := fmt.Sprintf("%s[%d]", path, ii)
+		switch {
+		case ii >= b.Len():
+			*changes = append(*changes, FieldChange{Path: elemPath, Field: field, Old: a.Get(ii)})
+		case ii >= a.Len():
+			*changes = append(*changes, FieldChange{Path: elemPath, Field: field, New: b.Get(ii)})
+		default:
+			diffValues(changes, elemPath, field, a.Get(ii), b.Get(ii))
+		}
+	}
+}
+
+func diffMaps(changes *[]FieldChange, path string, field protoreflect.FieldDescriptor, a, b protoreflect.Map) {
+	var keys []protoreflect.MapKey
+	a.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	b.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		if !a.Has(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	sortMapKeys(keys)
+
+	valueField := field.MapValue()
+	for _, key := range keys {
+		entryPath := path + "[" + formatMapKey(key) + "]"
+		switch {
+		case !b.Has(key):
+			*changes = append(*changes, FieldChange{Path: entryPath, Field: valueField, Old: a.Get(key)})
+		case !a.Has(key):
+			*changes = append(*changes, FieldChange{Path: entryPath, Field: valueField, New: b.Get(key)})
+		default:
+			diffValues(changes, entryPath, valueField, a.Get(key), b.Get(key))
+		}
+	}
+}
+
+func sortMapKeys(keys []protoreflect.MapKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		switch ki := keys[i].Interface().(type) {
+		case bool:
+			return !ki && keys[j].Bool()
+		case int32, int64:
+			return keys[i].Int() < keys[j].Int()
+		case uint32, uint64:
+			return keys[i].Uint() < keys[j].Uint()
+		}
+		return keys[i].String() < keys[j].String()
+	})
+}
+
+func formatMapKey(key protoreflect.MapKey) string {
+	if s, ok := key.Interface().(string); ok {
+		return strconv.Quote(s)
+	}
+	return key.String()
+}
+
+// FormatDiff renders changes as text, with one line per change. Added
+// values are prefixed by "+", removed values by "-", and modified values by
+// "~".
+func FormatDiff(changes []FieldChange) string {
+	var b strings.Builder
+	for _, change := range changes {
+		switch {
+		case !change.Old.IsValid():
+			fmt.Fprintf(&b, "+ %s: %s\n", change.Path, formatDiffValue(change.Field, change.New))
+		case !change.New.IsValid():
+			fmt.Fprintf(&b, "- %s: %s\n", change.Path, formatDiffValue(change.Field, change.Old))
+		default:
+			fmt.Fprintf(&b, "~ %s: %s -> %s\n", change.Path,
+				formatDiffValue(change.Field, change.Old),
+				formatDiffValue(change.Field, change.New))
+		}
+	}
+	return b.String()
+}
+
+func formatDiffValue(field protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	if field == nil {
+		return strconv.Quote(string(v.Bytes()))
+	}
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return strconv.Quote(v.String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(string(v.Bytes()))
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "{" + prototext.MarshalOptions{}.Format(v.Message().Interface()) + "}"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+var starlarkDiff = starlark.NewBuiltin("proto.diff", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	changes, err := diffArgs(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]starlark.Value, 0, len(changes))
+	for _, change := range changes {
+		oldVal, err := diffValueToStarlark(change.Field, change.Old)
+		if err != nil {
+			return nil, err
+		}
+		newVal, err := diffValueToStarlark(change.Field, change.New)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, starlarkstruct.FromStringDict(starlark.String("proto.FieldChange"), starlark.StringDict{
+			"path": starlark.String(change.Path),
+			"old":  oldVal,
+			"new":  newVal,
+		}))
+	}
+	return starlark.NewList(out), nil
+})
+
+var starlarkDiffText = starlark.NewBuiltin("proto.diff_text", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	changes, err := diffArgs(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(FormatDiff(changes)), nil
+})
+
+func diffArgs(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) ([]FieldChange, error) {
+	var aVal, bVal starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &aVal, &bVal); err != nil {
+		return nil, err
+	}
+	a, ok := AsProtoMessage(aVal)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), aVal.Type())
+	}
+	b, ok := AsProtoMessage(bVal)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 2: got %s, want proto.Message", fn.Name(), bVal.Type())
+	}
+	changes, err := Diff(a, b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return changes, nil
+}
+
+// diffValueToStarlark converts an element of a FieldChange, which is None
+// if the value was added or removed.
+func diffValueToStarlark(field protoreflect.FieldDescriptor, v protoreflect.Value) (starlark.Value, error) {
+	if !v.IsValid() {
+		return starlark.None, nil
+	}
+	if field == nil {
+		return starlark.String(v.Bytes()), nil
+	}
+	return scalarValueToStarlark(v, field, conversionOptions{})
+}
@@ -0,0 +1,385 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var starlarkGet = starlark.NewBuiltin("proto.get", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var val starlark.Value
+	var path string
+	var dflt starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &val, "path", &path, "default?", &dflt); err != nil {
+		return nil, err
+	}
+	msg, ok := val.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+	}
+	steps, err := parseFieldPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid path %q: %v", fn.Name(), path, err)
+	}
+	got, found, err := getFieldPath(msg, steps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid path %q: %v", fn.Name(), path, err)
+	}
+	if !found {
+		return dflt, nil
+	}
+	return got, nil
+})
+
+var starlarkSet = starlark.NewBuiltin("proto.set", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var val, value starlark.Value
+	var path string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 3, &val, &path, &value); err != nil {
+		return nil, err
+	}
+	msg, ok := val.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+	}
+	steps, err := parseFieldPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid path %q: %v", fn.Name(), path, err)
+	}
+	if err := setFieldPath(msg, steps, value); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.None, nil
+})
+
+// A fieldPathStep is a field name, optionally followed by a list index or
+// map key, such as `containers[0]` or `limits["cpu"]`.
+type fieldPathStep struct {
+	field     string
+	subscript starlark.Value // starlark.Int, starlark.String, or nil
+}
+
+// parseFieldPath parses a path of fields separated by dots, where each
+// field may be subscripted by an integer or a quoted string:
+//
+//	spec.template.spec.containers[0].resources.limits["cpu"]
+func parseFieldPath(path string) ([]fieldPathStep, error) {
+	var steps []fieldPathStep
+	rest := path
+	for {
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		step := fieldPathStep{field: rest[:end]}
+		if step.field == "" {
+			return nil, fmt.Errorf("empty field name")
+		}
+		rest = rest[end:]
+		if strings.HasPrefix(rest, "[") {
+			subscript, n, err := parseSubscript(rest)
+			if err != nil {
+				return nil, err
+			}
+			step.subscript = subscript
+			rest = rest[n:]
+		}
+		steps = append(steps, step)
+		if rest == "" {
+			return steps, nil
+		}
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("unexpected %q after %q", rest[:1], step.field)
+		}
+		rest = rest[1:]
+	}
+}
+
+// parseSubscript parses a bracketed subscript at the start of s, returning
+// its value and length.
+func parseSubscript(s string) (starlark.Value, int, error) {
+	if len(s) > 1 && (s[1] == '"' || s[1] == '\'') {
+		quote := s[1]
+		for ii := 2; ii < len(s); ii++ {
+			switch s[ii] {
+			case '\\':
+				ii++
+			case quote:
+				if ii+1 >= len(s) || s[ii+1] != ']' {
+					return nil, 0, fmt.Errorf("expected ] after %s", s[1:ii+1])
+				}
+				literal := s[1 : ii+1]
+				if quote == '\'' {
+					literal = `"` + strings.ReplaceAll(literal[1:len(literal)-1], `"`, `\"`) + `"`
+				}
+				key, err := strconv.Unquote(literal)
+				if err != nil {
+					return nil, 0, fmt.Errorf("invalid map key %s", s[1:ii+1])
+				}
+				return starlark.String(key), ii + 2, nil
+			}
+		}
+		return nil, 0, fmt.Errorf("unterminated map key %s", s[1:])
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return nil, 0, fmt.Errorf("unterminated subscript %s", s)
+	}
+	n, err := strconv.ParseInt(s[1:end], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("subscript %s is not an integer or quoted string", s[:end+1])
+	}
+	return starlark.MakeInt64(n), end + 1, nil
+}
+
+// stepField returns the descriptor of the field named by a step, checking
+// that any subscript applies to a repeated or map field.
+func stepField(msg *protoMessage, step fieldPathStep) (protoreflect.FieldDescriptor, error) {
+	fieldDesc := getFieldDescriptor(msg.msgDesc, step.field)
+	if fieldDesc == nil {
+		return nil, fmt.Errorf("%s has no field %q", msg.Type(), step.field)
+	}
+	if step.subscript != nil && !fieldDesc.IsList() && !fieldDesc.IsMap() {
+		return nil, fmt.Errorf("field %q is not a repeated or map field", step.field)
+	}
+	if err := msg.load(); err != nil {
+		return nil, err
+	}
+	return fieldDesc, nil
+}
+
+// getFieldPath returns the value at a path, or (_, false, nil) if any field,
+// index, or key along the path is unset.
+func getFieldPath(msg *protoMessage, steps []fieldPathStep) (starlark.Value, bool, error) {
+	var cur starlark.Value = msg
+	for _, step := range steps {
+		curMsg, ok := cur.(*protoMessage)
+		if !ok {
+			return nil, false, fmt.Errorf("can't get field %q of %s", step.field, cur.Type())
+		}
+		if _, err := stepField(curMsg, step); err != nil {
+			return nil, false, err
+		}
+		val, ok := curMsg.fields[step.field]
+		if !ok || val == starlark.None {
+			return nil, false, nil
+		}
+		cur = val
+
+		switch container := cur.(type) {
+		case *protoRepeated:
+			if step.subscript == nil {
+				continue
+			}
+			index, err := listIndex(step)
+			if err != nil {
+				return nil, false, err
+			}
+			if index < 0 || index >= container.Len() {
+				return nil, false, nil
+			}
+			cur = container.Index(index)
+		case *protoMap:
+			if step.subscript == nil {
+				continue
+			}
+			val, found, err := container.Get(step.subscript)
+			if err != nil || !found {
+				return nil, false, err
+			}
+			cur = val
+		}
+	}
+	return cur, true, nil
+}
+
+func listIndex(step fieldPathStep) (int, error) {
+	index, ok := step.subscript.(starlark.Int)
+	if !ok {
+		return 0, fmt.Errorf("index of repeated field %q must be an integer", step.field)
+	}
+	i, ok := index.Int64()
+	if !ok {
+		return 0, fmt.Errorf("index %s of repeated field %q out of range", index, step.field)
+	}
+	return int(i), nil
+}
+
+// setFieldPath sets the value at a path, creating intermediate messages and
+// map entries as needed. Repeated fields may be extended by one element, by
+// setting the index equal to their length.
+func setFieldPath(msg *protoMessage, steps []fieldPathStep, value starlark.Value) error {
+	cur := msg
+	for ii, step := range steps {
+		last := ii == len(steps)-1
+		fieldDesc, err := stepField(cur, step)
+		if err != nil {
+			return err
+		}
+		if step.subscript == nil {
+			if last {
+				return cur.SetField(step.field, value)
+			}
+			if fieldDesc.Message() == nil || fieldDesc.IsList() || fieldDesc.IsMap() {
+				return fmt.Errorf("field %q is not a message field", step.field)
+			}
+			switch child := cur.fields[step.field].(type) {
+			case *protoMessage:
+				cur = child
+			case nil, starlark.NoneType:
+				created, err := newChildMessage(cur, fieldDesc)
+				if err != nil {
+					return err
+				}
+				if err := cur.SetField(step.field, created); err != nil {
+					return err
+				}
+				cur = created
+			default:
+				return fmt.Errorf("can't set field %q of %s", steps[ii+1].field, child.Type())
+			}
+			continue
+		}
+
+		if !last && fieldDesc.Message() == nil {
+			return fmt.Errorf("field %q does not contain messages", step.field)
+		}
+		if _, ok := cur.fields[step.field]; !ok {
+			if err := cur.CheckMutable("set field of"); err != nil {
+				return err
+			}
+		}
+		// Accessing an unset repeated or map field sets it to an empty
+		// container.
+		container, err := cur.Attr(step.field)
+		if err != nil {
+			return err
+		}
+
+		var next starlark.Value
+		switch container := container.(type) {
+		case *protoRepeated:
+			index, err := listIndex(step)
+			if err != nil {
+				return err
+			}
+			if index < 0 || index > container.Len() {
+				return fmt.Errorf("index %d out of range for repeated field %q of length %d", index, step.field, container.Len())
+			}
+			if last {
+				if index == container.Len() {
+					return container.Append(value)
+				}
+				return container.SetIndex(index, value)
+			}
+			if index == container.Len() {
+				child, err := newChildMessage(cur, fieldDesc)
+				if err != nil {
+					return err
+				}
+				if err := container.Append(child); err != nil {
+					return err
+				}
+			}
+			next = container.Index(index)
+		case *protoMap:
+			if last {
+				return container.SetKey(step.subscript, value)
+			}
+			val, found, err := container.Get(step.subscript)
+			if err != nil {
+				return err
+			}
+			if !found || val == starlark.None {
+				child, err := newChildMessage(cur, fieldDesc)
+				if err != nil {
+					return err
+				}
+				if err := container.SetKey(step.subscript, child); err != nil {
+					return err
+				}
+				val = child
+			}
+			next = val
+		default:
+			return fmt.Errorf("can't subscript field %q of type %s", step.field, container.Type())
+		}
+
+		nextMsg, ok := next.(*protoMessage)
+		if !ok {
+			return fmt.Errorf("can't set field %q of %s", steps[ii+1].field, next.Type())
+		}
+		cur = nextMsg
+	}
+	return nil
+}
+
+// convertElement applies the conversions of SetField, such as strings to
+// google.protobuf.Duration, to an element of a repeated or map field.
+func convertElement(fieldDesc protoreflect.FieldDescriptor, val starlark.Value, conv conversionOptions) (starlark.Value, error) {
+	if fieldDesc.Kind() == protoreflect.EnumKind {
+		return maybeConvertToEnum(fieldDesc, val, conv)
+	}
+	if fieldDesc.Kind() != protoreflect.MessageKind {
+		return val, nil
+	}
+	converted, err := maybeConvertToWrapper(fieldDesc, val)
+	if err != nil {
+		return nil, err
+	}
+	if converted != nil {
+		return converted, nil
+	}
+	return val, nil
+}
+
+// newChildMessage returns an empty message of the type contained by a field
+// of parent, recording positions on the same thread as parent.
+func newChildMessage(parent *protoMessage, fieldDesc protoreflect.FieldDescriptor) (*protoMessage, error) {
+	field := parent.msg.ProtoReflect().NewField(fieldDesc)
+	var child protoreflect.Message
+	switch {
+	case fieldDesc.IsList():
+		child = field.List().NewElement().Message()
+	case fieldDesc.IsMap():
+		child = field.Map().NewValue().Message()
+	default:
+		child = field.Message()
+	}
+	msg, err := NewMessage(child.Interface())
+	if err != nil {
+		return nil, err
+	}
+	msg.thread = parent.thread
+	msg.conv = parent.conv
+	return msg, nil
+}
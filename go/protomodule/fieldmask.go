@@ -0,0 +1,227 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+var fieldMaskType = (&fieldmaskpb.FieldMask{}).ProtoReflect().Descriptor().FullName()
+
+var starlarkFieldMask = starlark.NewBuiltin("proto.field_mask", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%s: missing argument for message type", fn.Name())
+	}
+	protoMsgType, ok := args[0].(skyProtoMessageType)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.MessageType", fn.Name(), args[0].Type())
+	}
+
+	paths := make([]string, 0, len(args)-1)
+	for ii, arg := range args[1:] {
+		path, ok := arg.(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("%s: for parameter %d: got %s, want string", fn.Name(), ii+2, arg.Type())
+		}
+		paths = append(paths, string(path))
+	}
+
+	msgDesc := protoMsgType.NewMessage().ProtoReflect().Descriptor()
+	if err := validateMaskPaths(msgDesc, paths); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return NewMessage(&fieldmaskpb.FieldMask{Paths: paths})
+})
+
+var starlarkApplyMask = starlark.NewBuiltin("proto.apply_mask", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var val, maskVal starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &val, &maskVal); err != nil {
+		return nil, err
+	}
+	msg, ok := AsProtoMessage(val)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+	}
+	paths, err := maskPaths(maskVal)
+	if err != nil {
+		return nil, fmt.Errorf("%s: for parameter 2: %v", fn.Name(), err)
+	}
+
+	src := msg.ProtoReflect()
+	if err := validateMaskPaths(src.Descriptor(), paths); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	dst := src.New()
+	applyMask(src, dst, newMaskTree(paths))
+	return NewMessage(dst.Interface())
+})
+
+var starlarkMaskOf = starlark.NewBuiltin("proto.mask_of", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	msg, _, err := wantSingleProtoMessage(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	collectMaskPaths(msg.ProtoReflect(), "", &paths)
+	sort.Strings(paths)
+	return NewMessage(&fieldmaskpb.FieldMask{Paths: paths})
+})
+
+// maskPaths returns the paths of a google.protobuf.FieldMask message, or of
+// a list of path strings.
+func maskPaths(val starlark.Value) ([]string, error) {
+	if msg, ok := val.(*protoMessage); ok {
+		if msg.msgDesc.FullName() != fieldMaskType {
+			return nil, fmt.Errorf("got %s, want %s", msg.Type(), fieldMaskType)
+		}
+		fields := msg.msgDesc.Fields()
+		list := msg.toProtoMessage().ProtoReflect().Get(fields.ByName("paths")).List()
+		paths := make([]string, list.Len())
+		for ii := range paths {
+			paths[ii] = list.Get(ii).String()
+		}
+		return paths, nil
+	}
+
+	iterable, ok := val.(starlark.Iterable)
+	if !ok || val.Type() == "string" {
+		return nil, fmt.Errorf("got %s, want %s or list of strings", val.Type(), fieldMaskType)
+	}
+	var paths []string
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var item starlark.Value
+	for iter.Next(&item) {
+		path, ok := item.(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("got list containing %s, want list of strings", item.Type())
+		}
+		paths = append(paths, string(path))
+	}
+	return paths, nil
+}
+
+// validateMaskPaths checks that each path names a field of msgDesc. Every
+// component of a path except the last must be a singular message field.
+func validateMaskPaths(msgDesc protoreflect.MessageDescriptor, paths []string) error {
+	for _, path := range paths {
+		desc := msgDesc
+		names := strings.Split(path, ".")
+		for ii, name := range names {
+			if desc == nil {
+				return fmt.Errorf("invalid path %q for %s: field %q is not a singular message field", path, msgDesc.FullName(), names[ii-1])
+			}
+			fieldDesc := desc.Fields().ByName(protoreflect.Name(name))
+			if fieldDesc == nil {
+				return fmt.Errorf("invalid path %q for %s: %s has no field %q", path, msgDesc.FullName(), desc.FullName(), name)
+			}
+			desc = nil
+			if fieldDesc.Message() != nil && !fieldDesc.IsList() && !fieldDesc.IsMap() {
+				desc = fieldDesc.Message()
+			}
+		}
+	}
+	return nil
+}
+
+// A maskTree is the set of field mask paths, indexed by field name. A nil
+// subtree selects the entire field.
+type maskTree map[string]maskTree
+
+func newMaskTree(paths []string) maskTree {
+	root := maskTree{}
+	for _, path := range paths {
+		node := root
+		names := strings.Split(path, ".")
+		for ii, name := range names {
+			child, ok := node[name]
+			if ok && child == nil {
+				// A parent path already selects the entire field.
+				break
+			}
+			if ii == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if !ok {
+				child = maskTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// applyMask copies the fields of src selected by tree into dst.
+func applyMask(src, dst protoreflect.Message, tree maskTree) {
+	fields := src.Descriptor().Fields()
+	for name, subtree := range tree {
+		fieldDesc := fields.ByName(protoreflect.Name(name))
+		if !src.Has(fieldDesc) {
+			continue
+		}
+		if subtree == nil {
+			dst.Set(fieldDesc, src.Get(fieldDesc))
+			continue
+		}
+		applyMask(src.Get(fieldDesc).Message(), dst.Mutable(fieldDesc).Message(), subtree)
+	}
+}
+
+// collectMaskPaths appends the path of each populated field of msg to paths.
+// Singular message fields are descended into, unless they are empty.
+func collectMaskPaths(msg protoreflect.Message, prefix string, paths *[]string) {
+	msg.Range(func(fieldDesc protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fieldDesc.IsExtension() {
+			return true
+		}
+		path := prefix + string(fieldDesc.Name())
+		isSingularMessage := fieldDesc.Message() != nil && !fieldDesc.IsList() && !fieldDesc.IsMap()
+		if isSingularMessage && proto.Size(v.Message().Interface()) > 0 {
+			collectMaskPaths(v.Message(), path+".", paths)
+		} else {
+			*paths = append(*paths, path)
+		}
+		return true
+	})
+}
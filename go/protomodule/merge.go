@@ -18,12 +18,38 @@ package protomodule
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
+// mergeOptions adjust how proto.merge combines repeated fields. A nil
+// *mergeOptions follows proto.Merge.
+type mergeOptions struct {
+	// Repeated fields set in src replace those of dst.
+	replaceRepeated bool
+
+	// Key fields of repeated message fields whose elements are merged by
+	// key, indexed by the name or full name of the repeated field.
+	mergeKeys map[string]string
+}
+
+// mergeKey returns the name of the key field for a repeated message field,
+// or "" if its elements aren't merged by key.
+func (opts *mergeOptions) mergeKey(fieldDesc protoreflect.FieldDescriptor) string {
+	if opts == nil {
+		return ""
+	}
+	if key, ok := opts.mergeKeys[string(fieldDesc.FullName())]; ok {
+		return key
+	}
+	return opts.mergeKeys[string(fieldDesc.Name())]
+}
+
 // Implements proto.merge merging src into dst, returning merged value
-func mergeField(dst, src starlark.Value) (starlark.Value, error) {
+func mergeField(dst, src starlark.Value, opts *mergeOptions) (starlark.Value, error) {
 	if dst == nil {
 		return src, nil
 	}
@@ -42,14 +68,20 @@ func mergeField(dst, src starlark.Value) (starlark.Value, error) {
 			return nil, mergeError(dst, src)
 		}
 
+		if key := opts.mergeKey(dst.fieldDesc); key != "" && !opts.replaceRepeated {
+			return mergeByKey(dst, src, key, opts)
+		}
+
 		newList := newProtoRepeated(dst.fieldDesc)
 
-		err := newList.Extend(dst)
-		if err != nil {
-			return nil, err
+		if opts == nil || !opts.replaceRepeated {
+			err := newList.Extend(dst)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		err = newList.Extend(src)
+		err := newList.Extend(src)
 		if err != nil {
 			return nil, err
 		}
@@ -89,8 +121,12 @@ func mergeField(dst, src starlark.Value) (starlark.Value, error) {
 			return nil, err
 		}
 
-		newMessage.Merge(dst)
-		newMessage.Merge(src)
+		if err := newMessage.Merge(dst); err != nil {
+			return nil, err
+		}
+		if err := newMessage.mergeWith(src, opts); err != nil {
+			return nil, err
+		}
 
 		return newMessage, nil
 	default:
@@ -98,6 +134,238 @@ func mergeField(dst, src starlark.Value) (starlark.Value, error) {
 	}
 }
 
+// mergeByKey merges the elements of src into dst, replacing each element of
+// dst by its merge with the element of src that has the same key. Other
+// elements of src are appended.
+func mergeByKey(dst, src *protoRepeated, key string, opts *mergeOptions) (*protoRepeated, error) {
+	newList := newProtoRepeated(dst.fieldDesc)
+	if err := newList.Extend(dst); err != nil {
+		return nil, err
+	}
+
+	for ii := 0; ii < src.Len(); ii++ {
+		srcElem := src.Index(ii)
+		srcKey, err := elementKey(srcElem, key)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := indexOfKey(newList, key, srcKey)
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 {
+			if err := newList.Append(srcElem); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		merged, err := mergeField(newList.Index(idx), srcElem, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := newList.SetIndex(idx, merged); err != nil {
+			return nil, err
+		}
+	}
+	return newList, nil
+}
+
+// elementKey returns the value of the key field of a message, or nil if
+// it's unset.
+func elementKey(elem starlark.Value, key string) (starlark.Value, error) {
+	if msg, ok := elem.(*protoMessage); ok {
+		if err := msg.load(); err != nil {
+			return nil, err
+		}
+		return msg.fields[key], nil
+	}
+	return nil, nil
+}
+
+// indexOfKey returns the index of the first message in list whose key field
+// equals keyVal, or -1 if there is none.
+func indexOfKey(list *protoRepeated, key string, keyVal starlark.Value) (int, error) {
+	if keyVal == nil {
+		return -1, nil
+	}
+	for ii := 0; ii < list.Len(); ii++ {
+		elemKey, err := elementKey(list.Index(ii), key)
+		if err != nil {
+			return -1, err
+		}
+		if elemKey == nil {
+			continue
+		}
+		if eq, err := starlark.Equal(elemKey, keyVal); err != nil {
+			return -1, err
+		} else if eq {
+			return ii, nil
+		}
+	}
+	return -1, nil
+}
+
+// parseMergeKeys checks the merge_key argument of proto.merge, which maps
+// repeated message fields to the names of their key fields.
+func parseMergeKeys(msgDesc protoreflect.MessageDescriptor, d *starlark.Dict) (map[string]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+	fields := make(map[string][]protoreflect.FieldDescriptor)
+	collectRepeatedFields(msgDesc, fields, make(map[protoreflect.FullName]bool))
+
+	keys := make(map[string]string, d.Len())
+	for _, item := range d.Items() {
+		field, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("merge_key: got %s key, want string", item[0].Type())
+		}
+		key, ok := starlark.AsString(item[1])
+		if !ok {
+			return nil, fmt.Errorf("merge_key: got %s value for %q, want string", item[1].Type(), field)
+		}
+		candidates := fields[field]
+		switch len(candidates) {
+		case 0:
+			return nil, fmt.Errorf("merge_key: %s has no repeated message field %q", msgDesc.FullName(), field)
+		case 1:
+		default:
+			names := make([]string, len(candidates))
+			for ii, candidate := range candidates {
+				names[ii] = string(candidate.FullName())
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("merge_key: field name %q is ambiguous in %s, use one of %s", field, msgDesc.FullName(), strings.Join(names, ", "))
+		}
+		fieldDesc := candidates[0]
+		if keyDesc := getFieldDescriptor(fieldDesc.Message(), key); keyDesc == nil || keyDesc.IsList() || keyDesc.IsMap() {
+			return nil, fmt.Errorf("merge_key: %s has no singular field %q", fieldDesc.Message().FullName(), key)
+		}
+		keys[field] = key
+	}
+	return keys, nil
+}
+
+// collectRepeatedFields finds the repeated message fields reachable from a
+// message type, indexed by name and by full name. Fields of different
+// message types may share a name.
+func collectRepeatedFields(msgDesc protoreflect.MessageDescriptor, out map[string][]protoreflect.FieldDescriptor, seen map[protoreflect.FullName]bool) {
+	if seen[msgDesc.FullName()] {
+		return
+	}
+	seen[msgDesc.FullName()] = true
+	fields := msgDesc.Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		field := fields.Get(ii)
+		if field.IsMap() {
+			if valueDesc := field.MapValue().Message(); valueDesc != nil {
+				collectRepeatedFields(valueDesc, out, seen)
+			}
+			continue
+		}
+		if field.Message() == nil {
+			continue
+		}
+		if field.IsList() {
+			out[string(field.Name())] = append(out[string(field.Name())], field)
+			out[string(field.FullName())] = []protoreflect.FieldDescriptor{field}
+		}
+		collectRepeatedFields(field.Message(), out, seen)
+	}
+}
+
+// deleteFieldPath removes the value at a path from msg: a field, an element
+// of a repeated field, or a map entry. Elements of repeated fields with a
+// merge key may be selected by a quoted key. Paths that aren't set are
+// ignored.
+func deleteFieldPath(msg *protoMessage, steps []fieldPathStep, opts *mergeOptions) error {
+	cur := msg
+	for ii, step := range steps {
+		last := ii == len(steps)-1
+		fieldDesc, err := stepField(cur, step)
+		if err != nil {
+			return err
+		}
+		val, ok := cur.fields[step.field]
+		if !ok || val == starlark.None {
+			return nil
+		}
+
+		if step.subscript == nil {
+			if last {
+				if err := cur.CheckMutable("delete field of"); err != nil {
+					return err
+				}
+				delete(cur.fields, step.field)
+				delete(cur.positions, step.field)
+				return nil
+			}
+			next, ok := val.(*protoMessage)
+			if !ok {
+				return fmt.Errorf("field %q is not a message field", step.field)
+			}
+			cur = next
+			continue
+		}
+
+		var next starlark.Value
+		switch container := val.(type) {
+		case *protoRepeated:
+			idx := -1
+			if key := opts.mergeKey(fieldDesc); key != "" && step.subscript.Type() == "string" {
+				if idx, err = indexOfKey(container, key, step.subscript); err != nil {
+					return err
+				}
+			} else {
+				if idx, err = listIndex(step); err != nil {
+					return err
+				}
+			}
+			if idx < 0 || idx >= container.Len() {
+				return nil
+			}
+			if last {
+				elems := make([]starlark.Value, 0, container.Len()-1)
+				for jj := 0; jj < container.Len(); jj++ {
+					if jj != idx {
+						elems = append(elems, container.Index(jj))
+					}
+				}
+				// Clear fails if the list is frozen.
+				if err := container.list.Clear(); err != nil {
+					return err
+				}
+				for _, elem := range elems {
+					if err := container.list.Append(elem); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			next = container.Index(idx)
+		case *protoMap:
+			if last {
+				_, _, err := container.dict.Delete(step.subscript)
+				return err
+			}
+			elem, found, err := container.Get(step.subscript)
+			if err != nil || !found {
+				return err
+			}
+			next = elem
+		default:
+			return fmt.Errorf("can't subscript field %q of type %s", step.field, val.Type())
+		}
+
+		nextMsg, ok := next.(*protoMessage)
+		if !ok {
+			return fmt.Errorf("can't delete field %q of %s", steps[ii+1].field, next.Type())
+		}
+		cur = nextMsg
+	}
+	return nil
+}
+
 func mergeError(dst, src starlark.Value) error {
 	return fmt.Errorf("MergeError: Cannot merge protobufs of different types: Merge(%s, %s)", dst.Type(), src.Type())
 }
@@ -0,0 +1,124 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// FieldPositions returns the positions in Starlark source at which the
+// fields of a message value were last set, including fields of nested
+// messages. Positions are keyed by field path, such as "spec.ports[0].name"
+// or `labels["app"]`; the empty path is the position at which the message
+// itself was constructed.
+//
+// Only messages constructed by calling a message type from Starlark, on a
+// thread with EnableFieldPositions, have positions. Returns nil if v is not
+// a message.
+func FieldPositions(v starlark.Value) map[string]syntax.Position {
+	msg, ok := v.(*protoMessage)
+	if !ok {
+		return nil
+	}
+	positions := make(map[string]syntax.Position)
+	collectPositions(positions, "", msg)
+	return positions
+}
+
+// EnableFieldPositions causes messages constructed on a thread to record the
+// positions returned by FieldPositions. Recording a position walks the call
+// stack on every field assignment, so it's disabled by default.
+func EnableFieldPositions(thread *starlark.Thread) {
+	thread.SetLocal(fieldPositionsKey, true)
+}
+
+// Set as a thread local by EnableFieldPositions.
+const fieldPositionsKey = "protomodule.field_positions"
+
+func collectPositions(positions map[string]syntax.Position, prefix string, msg *protoMessage) {
+	if _, ok := positions[prefix]; !ok && msg.pos.IsValid() {
+		positions[prefix] = msg.pos
+	}
+	for name, val := range msg.fields {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if pos, ok := msg.positions[name]; ok {
+			positions[path] = pos
+		}
+		switch val := val.(type) {
+		case *protoMessage:
+			collectPositions(positions, path, val)
+		case *protoRepeated:
+			for ii := 0; ii < val.list.Len(); ii++ {
+				if elem, ok := val.list.Index(ii).(*protoMessage); ok {
+					collectPositions(positions, fmt.Sprintf("%s[%d]", path, ii), elem)
+				}
+			}
+		case *protoMap:
+			for _, item := range val.dict.Items() {
+				if elem, ok := item[1].(*protoMessage); ok {
+					collectPositions(positions, path+"["+mapKeyPath(item[0])+"]", elem)
+				}
+			}
+		}
+	}
+}
+
+func mapKeyPath(key starlark.Value) string {
+	if s, ok := key.(starlark.String); ok {
+		return strconv.Quote(string(s))
+	}
+	return key.String()
+}
+
+// recordPosition records the position of the Starlark code that is setting
+// a field, if the message was constructed by Starlark on a thread with
+// positions enabled.
+func (msg *protoMessage) recordPosition(name string) {
+	if msg.thread == nil {
+		return
+	}
+	pos := callerPosition(msg.thread)
+	if !pos.IsValid() {
+		return
+	}
+	if msg.positions == nil {
+		msg.positions = make(map[string]syntax.Position)
+	}
+	msg.positions[name] = pos
+}
+
+// callerPosition returns the position of the innermost Starlark function
+// call on the thread's stack, skipping builtins. Returns an invalid position
+// if the thread doesn't record positions.
+func callerPosition(thread *starlark.Thread) syntax.Position {
+	if thread == nil || thread.Local(fieldPositionsKey) != true {
+		return syntax.Position{}
+	}
+	for depth := 0; depth < thread.CallStackDepth(); depth++ {
+		if pos := thread.CallFrame(depth).Pos; pos.Filename() != "<builtin>" {
+			return pos
+		}
+	}
+	return syntax.Position{}
+}
@@ -0,0 +1,190 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var starlarkHas = starlark.NewBuiltin("proto.has", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	msg, field, err := unpackMessageField(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if ext, ok := field.(*protoExtension); ok {
+		if err := msg.checkExtension(ext.extType); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		if err := msg.load(); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		_, ok := msg.extensions[ext.name()]
+		return starlark.Bool(ok), nil
+	}
+	fieldDesc, err := messageField(msg, field)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bool(msg.hasField(fieldDesc)), nil
+})
+
+var starlarkClearField = starlark.NewBuiltin("proto.clear_field", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	msg, field, err := unpackMessageField(fn, args, kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.CheckMutable("clear field of"); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	if err := msg.load(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	if ext, ok := field.(*protoExtension); ok {
+		if err := msg.checkExtension(ext.extType); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		delete(msg.extensions, ext.name())
+		return starlark.None, nil
+	}
+	fieldDesc, err := messageField(msg, field)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	delete(msg.fields, string(fieldDesc.Name()))
+	delete(msg.positions, string(fieldDesc.Name()))
+	return starlark.None, nil
+})
+
+var starlarkWhichOneof = starlark.NewBuiltin("proto.which_oneof", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var val starlark.Value
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &val, &name); err != nil {
+		return nil, err
+	}
+	msg, ok := val.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+	}
+	oneof := msg.msgDesc.Oneofs().ByName(protoreflect.Name(name))
+	if oneof == nil {
+		return nil, fmt.Errorf("%s: %s has no oneof %q", fn.Name(), msg.Type(), name)
+	}
+	fields := oneof.Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		if msg.hasField(fields.Get(ii)) {
+			return starlark.String(fields.Get(ii).Name()), nil
+		}
+	}
+	return starlark.None, nil
+})
+
+var starlarkSetFields = starlark.NewBuiltin("proto.set_fields", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var val starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &val); err != nil {
+		return nil, err
+	}
+	msg, ok := val.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+	}
+	var names []starlark.Value
+	fields := msg.msgDesc.Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		if msg.hasField(fields.Get(ii)) {
+			names = append(names, starlark.String(fields.Get(ii).Name()))
+		}
+	}
+	return starlark.NewList(names), nil
+})
+
+// unpackMessageField unpacks the (msg, field) arguments of proto.has and
+// proto.clear_field. The field is a field name or a proto.Extension.
+func unpackMessageField(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (*protoMessage, starlark.Value, error) {
+	var val, field starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &val, &field); err != nil {
+		return nil, nil, err
+	}
+	msg, ok := val.(*protoMessage)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+	}
+	switch field.(type) {
+	case starlark.String, *protoExtension:
+		return msg, field, nil
+	}
+	return nil, nil, fmt.Errorf("%s: for parameter 2: got %s, want string or proto.Extension", fn.Name(), field.Type())
+}
+
+func messageField(msg *protoMessage, field starlark.Value) (protoreflect.FieldDescriptor, error) {
+	name, _ := starlark.AsString(field)
+	fieldDesc := getFieldDescriptor(msg.msgDesc, name)
+	if fieldDesc == nil {
+		return nil, fmt.Errorf("%s has no field %q", msg.Type(), name)
+	}
+	return fieldDesc, nil
+}
+
+// hasField reports whether a field is populated, following the semantics
+// of protoreflect.Message.Has: fields with presence are populated if they
+// have been set, even to their default value, while fields without presence
+// are populated if they are non-empty.
+func (msg *protoMessage) hasField(fieldDesc protoreflect.FieldDescriptor) bool {
+	if msg.src != nil {
+		return msg.src.Has(fieldDesc)
+	}
+	val, ok := msg.fields[string(fieldDesc.Name())]
+	if !ok || val == starlark.None {
+		return false
+	}
+	if fieldDesc.IsList() || fieldDesc.IsMap() {
+		if seq, ok := val.(starlark.Sequence); ok {
+			return seq.Len() > 0
+		}
+		return true
+	}
+	if fieldDesc.HasPresence() {
+		return true
+	}
+	protoValue, err := valueFromStarlark(msg.msg.ProtoReflect(), fieldDesc, val)
+	if err != nil {
+		return true
+	}
+	return isFieldSet(protoValue, fieldDesc)
+}
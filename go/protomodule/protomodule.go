@@ -33,34 +33,80 @@ import (
 // NewModule returns a Starlark module of Protobuf-related functions.
 //
 //  proto = module(
+//    apply_mask,
 //    clear,
+//    clear_field,
 //    clone,
 //    decode_any,
+//    decode_binary,
 //    decode_json,
 //    decode_text,
+//    descriptor,
+//    diff,
+//    diff_text,
 //    encode_any,
+//    encode_binary,
 //    encode_json,
 //    encode_text,
+//    evolve,
+//    field_mask,
+//    get,
+//    get_extension,
+//    has,
+//    mask_of,
 //    merge,
+//    register_defaults,
+//    set,
 //    set_defaults,
+//    set_extension,
+//    set_fields,
+//    which_oneof,
 //  )
 //
 // See `docs/modules.asciidoc` for details on the API of each function.
-func NewModule(registry *protoregistry.Types) *starlarkstruct.Module {
+func NewModule(registry *protoregistry.Types, opts ...ModuleOption) *starlarkstruct.Module {
+	var parsedOpts moduleOptions
+	for _, opt := range opts {
+		opt(&parsedOpts)
+	}
+	defaults := newMessageDefaults(parsedOpts.defaults, parsedOpts.conv)
+	typeOpts := messageTypeOptions{
+		defaults: defaults,
+		conv:     parsedOpts.conv,
+	}
+
 	return &starlarkstruct.Module{
 		Name: "proto",
 		Members: starlark.StringDict{
-			"clear":        starlarkClear,
-			"clone":        starlarkClone,
-			"decode_any":   decodeAny(registry),
-			"decode_json":  decodeJSON(registry),
-			"decode_text":  decodeText(registry),
-			"encode_any":   starlarkEncodeAny,
-			"encode_json":  encodeJSON(registry),
-			"encode_text":  encodeText(registry),
-			"merge":        starlarkMerge,
-			"package":      starlarkPackageFn(registry),
-			"set_defaults": starlarkSetDefaults,
+			"apply_mask":        starlarkApplyMask,
+			"clear":             starlarkClear,
+			"clear_field":       starlarkClearField,
+			"clone":             starlarkClone,
+			"decode_any":        decodeAny(registry, parsedOpts.conv),
+			"decode_binary":     decodeBinary(registry),
+			"decode_json":       decodeJSON(registry),
+			"decode_text":       decodeText(registry),
+			"descriptor":        descriptor(registry, typeOpts),
+			"diff":              starlarkDiff,
+			"diff_text":         starlarkDiffText,
+			"encode_any":        starlarkEncodeAny,
+			"encode_binary":     starlarkEncodeBinary,
+			"encode_json":       encodeJSON(registry),
+			"encode_text":       encodeText(registry),
+			"evolve":            starlarkEvolve,
+			"field_mask":        starlarkFieldMask,
+			"get":               starlarkGet,
+			"get_extension":     getExtension(registry),
+			"has":               starlarkHas,
+			"mask_of":           starlarkMaskOf,
+			"merge":             starlarkMerge,
+			"package":           starlarkPackageFn(registry, typeOpts),
+			"register_defaults": registerDefaults(defaults),
+			"set":               starlarkSet,
+			"set_defaults":      setDefaults(defaults),
+			"set_extension":     setExtension(registry),
+			"set_fields":        starlarkSetFields,
+			"which_oneof":       starlarkWhichOneof,
 		},
 	}
 }
@@ -90,14 +136,52 @@ var starlarkClone = starlark.NewBuiltin("proto.clone", func(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	msg, _, err := wantSingleProtoMessage(fn, args, kwargs)
+	msg, skyProtoMsg, err := wantSingleProtoMessage(fn, args, kwargs)
 	if err != nil {
 		return nil, err
 	}
-	return NewMessage(proto.Clone(msg))
+	out, err := NewMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	out.conv = skyProtoMsg.(*protoMessage).conv
+	return out, nil
 })
 
-func decodeAny(registry *protoregistry.Types) starlark.Callable {
+var starlarkEvolve = starlark.NewBuiltin("proto.evolve", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var val starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, nil, 1, &val); err != nil {
+		return nil, err
+	}
+	msg, ok := val.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+	}
+
+	out, err := msg.clone(t)
+	if err != nil {
+		return nil, err
+	}
+	out.pos = callerPosition(t)
+	for _, kwarg := range kwargs {
+		name, _ := starlark.AsString(kwarg[0])
+		if err := out.SetField(name, kwarg[1]); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+	}
+
+	if msg.frozen {
+		out.Freeze()
+	}
+	return out, nil
+})
+
+func decodeAny(registry *protoregistry.Types, conv conversionOptions) starlark.Callable {
 	return starlark.NewBuiltin("proto.decode_any", func(
 		t *starlark.Thread,
 		fn *starlark.Builtin,
@@ -119,7 +203,47 @@ func decodeAny(registry *protoregistry.Types) starlark.Callable {
 		if err != nil {
 			return nil, err
 		}
-		return NewMessage(decoded)
+		out := newLazyMessage(decoded.ProtoReflect())
+		out.conv = conv
+		return out, nil
+	})
+}
+
+// newDecodedMessage wraps a message decoded by a builtin, converting its
+// field values like messages constructed by msgType.
+func newDecodedMessage(msgType skyProtoMessageType, decoded proto.Message) *protoMessage {
+	out := newLazyMessage(decoded.ProtoReflect())
+	if t, ok := msgType.(*protoMessageType); ok {
+		out.conv = t.opts.conv
+	}
+	return out
+}
+
+func decodeBinary(registry *protoregistry.Types) starlark.Callable {
+	return starlark.NewBuiltin("proto.decode_binary", func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var msgType starlark.Value
+		var value starlark.String
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msgType, &value); err != nil {
+			return nil, err
+		}
+		protoMsgType, ok := msgType.(skyProtoMessageType)
+		if !ok {
+			return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.MessageType", fn.Name(), msgType.Type())
+		}
+
+		unmarshal := proto.UnmarshalOptions{
+			Resolver: registry,
+		}
+		decoded := protoMsgType.NewMessage()
+		if err := unmarshal.Unmarshal([]byte(value), decoded); err != nil {
+			return nil, err
+		}
+		return newDecodedMessage(protoMsgType, decoded), nil
 	})
 }
 
@@ -132,7 +256,7 @@ func decodeJSON(registry *protoregistry.Types) starlark.Callable {
 	) (starlark.Value, error) {
 		var msgType starlark.Value
 		var value starlark.String
-		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msgType, &value); err != nil {
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, nil, 2, &msgType, &value); err != nil {
 			return nil, err
 		}
 		protoMsgType, ok := msgType.(skyProtoMessageType)
@@ -143,11 +267,17 @@ func decodeJSON(registry *protoregistry.Types) starlark.Callable {
 		unmarshal := protojson.UnmarshalOptions{
 			Resolver: registry,
 		}
+
+		if len(kwargs) > 0 {
+			if err := starlark.UnpackArgs(fn.Name(), nil, kwargs, "discard_unknown?", &unmarshal.DiscardUnknown); err != nil {
+				return nil, err
+			}
+		}
 		decoded := protoMsgType.NewMessage()
 		if err := unmarshal.Unmarshal([]byte(value), decoded); err != nil {
 			return nil, err
 		}
-		return NewMessage(decoded)
+		return newDecodedMessage(protoMsgType, decoded), nil
 	})
 }
 
@@ -160,7 +290,7 @@ func decodeText(registry *protoregistry.Types) starlark.Callable {
 	) (starlark.Value, error) {
 		var msgType starlark.Value
 		var value starlark.String
-		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &msgType, &value); err != nil {
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, nil, 2, &msgType, &value); err != nil {
 			return nil, err
 		}
 		protoMsgType, ok := msgType.(skyProtoMessageType)
@@ -171,11 +301,17 @@ func decodeText(registry *protoregistry.Types) starlark.Callable {
 		unmarshal := prototext.UnmarshalOptions{
 			Resolver: registry,
 		}
+
+		if len(kwargs) > 0 {
+			if err := starlark.UnpackArgs(fn.Name(), nil, kwargs, "discard_unknown?", &unmarshal.DiscardUnknown); err != nil {
+				return nil, err
+			}
+		}
 		decoded := protoMsgType.NewMessage()
 		if err := unmarshal.Unmarshal([]byte(value), decoded); err != nil {
 			return nil, err
 		}
-		return NewMessage(decoded)
+		return newDecodedMessage(protoMsgType, decoded), nil
 	})
 }
 
@@ -199,6 +335,33 @@ var starlarkEncodeAny = starlark.NewBuiltin("proto.encode_any", func(
 	return NewMessage(any)
 })
 
+var starlarkEncodeBinary = starlark.NewBuiltin("proto.encode_binary", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	protoMsg, _, err := wantSingleProtoMessage(fn, args, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	marshal := proto.MarshalOptions{
+		Deterministic: true,
+	}
+
+	if len(kwargs) > 0 {
+		if err := starlark.UnpackArgs(fn.Name(), nil, kwargs, "deterministic", &marshal.Deterministic); err != nil {
+			return nil, err
+		}
+	}
+	data, err := marshal.Marshal(protoMsg)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(data), nil
+})
+
 func encodeJSON(registry *protoregistry.Types) starlark.Callable {
 	return starlark.NewBuiltin("proto.encode_json", func(
 		t *starlark.Thread,
@@ -218,7 +381,12 @@ func encodeJSON(registry *protoregistry.Types) starlark.Callable {
 
 		if len(kwargs) > 0 {
 			compact := true
-			if err := starlark.UnpackArgs(fn.Name(), nil, kwargs, "compact", &compact); err != nil {
+			if err := starlark.UnpackArgs(fn.Name(), nil, kwargs,
+				"compact?", &compact,
+				"use_proto_names?", &marshal.UseProtoNames,
+				"emit_unpopulated?", &marshal.EmitUnpopulated,
+				"use_enum_numbers?", &marshal.UseEnumNumbers,
+			); err != nil {
 				return nil, err
 			}
 			if !compact {
@@ -251,7 +419,7 @@ func encodeText(registry *protoregistry.Types) starlark.Callable {
 
 		if len(kwargs) > 0 {
 			compact := true
-			if err := starlark.UnpackArgs(fn.Name(), nil, kwargs, "compact", &compact); err != nil {
+			if err := starlark.UnpackArgs(fn.Name(), nil, kwargs, "compact?", &compact); err != nil {
 				return nil, err
 			}
 			if !compact {
@@ -273,43 +441,96 @@ var starlarkMerge = starlark.NewBuiltin("proto.merge", func(
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
 	var val1, val2 starlark.Value
-	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &val1, &val2); err != nil {
+	var replaceRepeated bool
+	var mergeKeys *starlark.Dict
+	var deletePaths *starlark.List
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"dst", &val1,
+		"src", &val2,
+		"replace_repeated?", &replaceRepeated,
+		"merge_key?", &mergeKeys,
+		"delete?", &deletePaths,
+	); err != nil {
 		return nil, err
 	}
 
-	dst := val1.(*protoMessage)
-	src := val2.(*protoMessage)
+	dst, ok := val1.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val1.Type())
+	}
+	src, ok := val2.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%s: for parameter 2: got %s, want proto.Message", fn.Name(), val2.Type())
+	}
 	if src.Type() != dst.Type() {
 		return nil, fmt.Errorf("%s: types are not the same: got %s and %s", fn.Name(), src.Type(), dst.Type())
 	}
 
-	err := dst.Merge(src)
-	if err != nil {
-		return nil, err
+	var opts *mergeOptions
+	if replaceRepeated || mergeKeys != nil || deletePaths != nil {
+		keys, err := parseMergeKeys(dst.msgDesc, mergeKeys)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		opts = &mergeOptions{
+			replaceRepeated: replaceRepeated,
+			mergeKeys:       keys,
+		}
 	}
 
-	return dst, nil
-})
-
-var starlarkSetDefaults = starlark.NewBuiltin("proto.set_defaults", func(
-	t *starlark.Thread,
-	fn *starlark.Builtin,
-	args starlark.Tuple,
-	kwargs []starlark.Tuple,
-) (starlark.Value, error) {
-	_, skyProtoMsg, err := wantSingleProtoMessage(fn, args, kwargs)
+	err := dst.mergeWith(src, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	err = skyProtoMsg.SetDefaults()
-	if err != nil {
-		return nil, err
+	if deletePaths != nil {
+		for ii := 0; ii < deletePaths.Len(); ii++ {
+			path, ok := starlark.AsString(deletePaths.Index(ii))
+			if !ok {
+				return nil, fmt.Errorf("%s: delete: got %s, want string", fn.Name(), deletePaths.Index(ii).Type())
+			}
+			steps, err := parseFieldPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid path %q: %v", fn.Name(), path, err)
+			}
+			if err := deleteFieldPath(dst, steps, opts); err != nil {
+				return nil, fmt.Errorf("%s: delete %q: %v", fn.Name(), path, err)
+			}
+		}
 	}
 
-	return skyProtoMsg, nil
+	return dst, nil
 })
 
+func setDefaults(defaults *messageDefaults) starlark.Callable {
+	return starlark.NewBuiltin("proto.set_defaults", func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		_, skyProtoMsg, err := wantSingleProtoMessage(fn, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+
+		// Registered defaults take precedence over those declared in
+		// the message's schema.
+		if msg, ok := skyProtoMsg.(*protoMessage); ok && !msg.frozen {
+			if err := defaults.applyUnset(t, msg); err != nil {
+				return nil, err
+			}
+		}
+
+		err = skyProtoMsg.SetDefaults()
+		if err != nil {
+			return nil, err
+		}
+
+		return skyProtoMsg, nil
+	})
+}
+
 type skyProtoMessageType interface {
 	NewMessage() protoreflect.ProtoMessage
 }
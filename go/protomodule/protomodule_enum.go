@@ -18,7 +18,9 @@ package protomodule
 
 import (
 	"fmt"
+	"math"
 	"sort"
+	"strings"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
@@ -37,18 +39,21 @@ func newEnumType(descriptor protoreflect.EnumDescriptor) *protoEnumType {
 	}
 
 	return &protoEnumType{
-		name:  descriptor.FullName(),
-		attrs: attrs,
+		name:       descriptor.FullName(),
+		descriptor: descriptor,
+		attrs:      attrs,
 	}
 }
 
 type protoEnumType struct {
-	name  protoreflect.FullName
-	attrs map[string]*protoEnumValue
+	name       protoreflect.FullName
+	descriptor protoreflect.EnumDescriptor
+	attrs      map[string]*protoEnumValue
 }
 
 var _ starlark.HasAttrs = (*protoEnumType)(nil)
 var _ starlark.Value = (*protoEnumType)(nil)
+var _ starlark.Callable = (*protoEnumType)(nil)
 
 func (t *protoEnumType) String() string {
 	return fmt.Sprintf("<proto.EnumType %q>", t.name)
@@ -60,12 +65,15 @@ func (t *protoEnumType) Hash() (uint32, error) {
 	return 0, fmt.Errorf("unhashable type: %s", t.Type())
 }
 
+func (t *protoEnumType) Name() string {
+	return string(t.name)
+}
+
 func (t *protoEnumType) Attr(attrName string) (starlark.Value, error) {
 	if attr, ok := t.attrs[attrName]; ok {
 		return attr, nil
 	}
-	// TODO: better error message
-	return nil, nil
+	return nil, fmt.Errorf("%s has no value %q (valid values: %s)", t.name, attrName, validEnumValues(t.descriptor))
 }
 
 func (t *protoEnumType) AttrNames() []string {
@@ -77,13 +85,71 @@ func (t *protoEnumType) AttrNames() []string {
 	return names
 }
 
-func (t *protoEnumType) ByNum(enumNumber protoreflect.EnumNumber) (starlark.Value, error) {
-	for _, enum := range t.attrs {
-		if enum.enumNumber() == enumNumber {
-			return enum, nil
+// CallInternal returns the value of the enum with a given name or number.
+//
+//  MyEnum("FOO")
+//  MyEnum(3)
+func (t *protoEnumType) CallInternal(
+	thread *starlark.Thread,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var val starlark.Value
+	if err := starlark.UnpackPositionalArgs(t.Name(), args, kwargs, 1, &val); err != nil {
+		return nil, err
+	}
+	return t.valueOf(val)
+}
+
+// valueOf returns the enum value named by a string, or numbered by an int.
+// Enum values of this type are returned unchanged.
+func (t *protoEnumType) valueOf(val starlark.Value) (*protoEnumValue, error) {
+	return enumValueOf(t.descriptor, val)
+}
+
+// enumValueOf is like protoEnumType.valueOf, but looks values up in the
+// descriptor's own index rather than building an enum type.
+func enumValueOf(desc protoreflect.EnumDescriptor, val starlark.Value) (*protoEnumValue, error) {
+	switch val := val.(type) {
+	case *protoEnumValue:
+		if val.typeName == desc.FullName() {
+			return val, nil
+		}
+	case starlark.String:
+		if value := desc.Values().ByName(protoreflect.Name(val)); value != nil {
+			return &protoEnumValue{typeName: desc.FullName(), value: value}, nil
 		}
+		return nil, fmt.Errorf("ValueError: %s has no value %s (valid values: %s)", desc.FullName(), val, validEnumValues(desc))
+	case starlark.Int:
+		// Enum numbers are int32, so larger values would be truncated.
+		if num, ok := val.Int64(); ok && num >= math.MinInt32 && num <= math.MaxInt32 {
+			if value := desc.Values().ByNumber(protoreflect.EnumNumber(num)); value != nil {
+				return &protoEnumValue{typeName: desc.FullName(), value: value}, nil
+			}
+		}
+		return nil, fmt.Errorf("ValueError: %s has no value numbered %s (valid values: %s)", desc.FullName(), val, validEnumValues(desc))
 	}
-	return nil, fmt.Errorf("ValueError: enum %d out of bounds for %s", enumNumber, string(t.name))
+	return nil, fmt.Errorf("TypeError: value %s (type %q) can't be converted to type %q.", val, val.Type(), desc.FullName())
+}
+
+// validEnumValues lists the names and numbers of an enum's values, in
+// declaration order.
+func validEnumValues(desc protoreflect.EnumDescriptor) string {
+	values := desc.Values()
+	out := make([]string, 0, values.Len())
+	for ii := 0; ii < values.Len(); ii++ {
+		value := values.Get(ii)
+		out = append(out, fmt.Sprintf("%s=%d", value.Name(), value.Number()))
+	}
+	return strings.Join(out, ", ")
+}
+
+// enumByNumber returns the value of an enum with a given number.
+func enumByNumber(desc protoreflect.EnumDescriptor, enumNumber protoreflect.EnumNumber) (starlark.Value, error) {
+	if value := desc.Values().ByNumber(enumNumber); value != nil {
+		return &protoEnumValue{typeName: desc.FullName(), value: value}, nil
+	}
+	return nil, fmt.Errorf("ValueError: enum %d out of bounds for %s", enumNumber, desc.FullName())
 }
 
 type protoEnumValue struct {
@@ -93,6 +159,7 @@ type protoEnumValue struct {
 
 var _ starlark.Comparable = (*protoEnumValue)(nil)
 var _ starlark.Value = (*protoEnumValue)(nil)
+var _ starlark.HasAttrs = (*protoEnumValue)(nil)
 
 func (v *protoEnumValue) String() string {
 	return fmt.Sprintf("<%s %s=%d>", v.typeName, v.value.Name(), v.value.Number())
@@ -108,6 +175,34 @@ func (v *protoEnumValue) enumNumber() protoreflect.EnumNumber {
 	return v.value.Number()
 }
 
+func (v *protoEnumValue) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(v.value.Name()), nil
+	case "number":
+		return starlark.MakeInt64(int64(v.value.Number())), nil
+	}
+	return nil, nil
+}
+
+func (v *protoEnumValue) AttrNames() []string {
+	return []string{"name", "number"}
+}
+
+// maybeConvertToEnum converts a string or int assigned to an enum field to
+// the enum value with that name or number, if enabled by WithEnumConversion.
+// Other values are returned unchanged, to be type checked by the caller.
+func maybeConvertToEnum(fieldDesc protoreflect.FieldDescriptor, val starlark.Value, conv conversionOptions) (starlark.Value, error) {
+	if !conv.enumNames || fieldDesc.Kind() != protoreflect.EnumKind {
+		return val, nil
+	}
+	switch val.(type) {
+	case starlark.String, starlark.Int:
+		return enumValueOf(fieldDesc.Enum(), val)
+	}
+	return val, nil
+}
+
 func (v *protoEnumValue) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
 	other := y.(*protoEnumValue)
 	switch op {
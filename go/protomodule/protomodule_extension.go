@@ -0,0 +1,253 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// newExtension creates a Starlark value representing a Protobuf extension
+// field, which may be used to get or set the extension on messages.
+func newExtension(extType protoreflect.ExtensionType) *protoExtension {
+	return &protoExtension{extType: extType}
+}
+
+type protoExtension struct {
+	extType protoreflect.ExtensionType
+}
+
+var _ starlark.Value = (*protoExtension)(nil)
+var _ starlark.Comparable = (*protoExtension)(nil)
+
+func (ext *protoExtension) String() string {
+	return fmt.Sprintf("<proto.Extension %q>", ext.name())
+}
+func (ext *protoExtension) Type() string         { return "proto.Extension" }
+func (ext *protoExtension) Freeze()              {}
+func (ext *protoExtension) Truth() starlark.Bool { return starlark.True }
+func (ext *protoExtension) Hash() (uint32, error) {
+	return starlark.String(ext.name()).Hash()
+}
+
+func (ext *protoExtension) name() protoreflect.FullName {
+	return ext.extType.TypeDescriptor().FullName()
+}
+
+func (ext *protoExtension) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
+	other := y.(*protoExtension)
+	switch op {
+	case syntax.EQL:
+		return ext.name() == other.name(), nil
+	case syntax.NEQ:
+		return ext.name() != other.name(), nil
+	default:
+		return false, fmt.Errorf("extensions support only `==' and `!=' comparisons, got: %#v", op)
+	}
+}
+
+// extensionField is the value of an extension set on a protoMessage.
+type extensionField struct {
+	extType protoreflect.ExtensionType
+	val     starlark.Value
+}
+
+// resolveExtension returns the extension type named by v, which may be a
+// proto.Extension or the full name of an extension in the registry.
+func resolveExtension(registry *protoregistry.Types, v starlark.Value) (protoreflect.ExtensionType, error) {
+	switch v := v.(type) {
+	case *protoExtension:
+		return v.extType, nil
+	case starlark.String:
+		extType, err := registry.FindExtensionByName(protoreflect.FullName(v))
+		if err != nil {
+			return nil, fmt.Errorf("Protobuf extension %q not found", string(v))
+		}
+		return extType, nil
+	}
+	return nil, fmt.Errorf("got %s, want proto.Extension or string", v.Type())
+}
+
+func (msg *protoMessage) checkExtension(extType protoreflect.ExtensionType) error {
+	extDesc := extType.TypeDescriptor()
+	if extDesc.ContainingMessage().FullName() != msg.msgDesc.FullName() {
+		return fmt.Errorf("%s is not an extension of %s", extDesc.FullName(), msg.Type())
+	}
+	return nil
+}
+
+// Get implements starlark.Mapping, so that extensions may be read with
+// msg[ext]. Like fields, unset extensions have a default value. Other keys
+// are an error, but the `in` operator ignores errors from Get, so
+// `"field" in msg` is False.
+func (msg *protoMessage) Get(k starlark.Value) (starlark.Value, bool, error) {
+	ext, err := msg.extensionKey(k)
+	if err != nil {
+		return nil, false, err
+	}
+	val, err := msg.getExtension(ext.extType)
+	if err != nil {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+// SetKey implements starlark.HasSetKey, so that extensions may be set with
+// msg[ext] = value.
+func (msg *protoMessage) SetKey(k, v starlark.Value) error {
+	ext, err := msg.extensionKey(k)
+	if err != nil {
+		return err
+	}
+	return msg.setExtension(ext.extType, v)
+}
+
+// extensionKey returns the extension that k, a key of msg[k], refers to.
+// Only extensions are keys: fields are accessed as attributes, so keys
+// naming them are reported as such.
+func (msg *protoMessage) extensionKey(k starlark.Value) (*protoExtension, error) {
+	if ext, ok := k.(*protoExtension); ok {
+		return ext, nil
+	}
+	if name, ok := k.(starlark.String); ok && getFieldDescriptor(msg.msgDesc, string(name)) != nil {
+		return nil, fmt.Errorf("%s: got string key %s, want proto.Extension; use attribute access for fields, such as msg.%s", msg.Type(), name, string(name))
+	}
+	return nil, fmt.Errorf("%s: got %s key, want proto.Extension; use attribute access for fields", msg.Type(), k.Type())
+}
+
+func (msg *protoMessage) getExtension(extType protoreflect.ExtensionType) (starlark.Value, error) {
+	if err := msg.checkExtension(extType); err != nil {
+		return nil, err
+	}
+	if err := msg.load(); err != nil {
+		return nil, err
+	}
+	extDesc := extType.TypeDescriptor()
+	if field, ok := msg.extensions[extDesc.FullName()]; ok {
+		return field.val, nil
+	}
+
+	val, err := valueToStarlark(extDesc.Default(), extDesc, msg.conv)
+	if err != nil {
+		return nil, err
+	}
+
+	// As with fields, unset repeated extensions are set on access so that
+	// they can be appended to.
+	if extDesc.IsList() {
+		if msg.frozen {
+			val.Freeze()
+			return val, nil
+		}
+		if err := msg.setExtension(extType, val); err != nil {
+			return nil, err
+		}
+	}
+	return val, nil
+}
+
+func (msg *protoMessage) setExtension(extType protoreflect.ExtensionType, val starlark.Value) error {
+	if err := msg.checkExtension(extType); err != nil {
+		return err
+	}
+	if err := msg.CheckMutable("set extension of"); err != nil {
+		return err
+	}
+	if err := msg.load(); err != nil {
+		return err
+	}
+
+	extDesc := extType.TypeDescriptor()
+	val, err := convertFieldValue(extDesc, val, msg.conv)
+	if err != nil {
+		return err
+	}
+
+	// Extensions always have presence, so assigning None clears them.
+	if !extDesc.IsList() && val == starlark.None {
+		delete(msg.extensions, extDesc.FullName())
+		return nil
+	}
+
+	if err := checkFieldValue(extDesc, val); err != nil {
+		return err
+	}
+
+	msg.adopt(val)
+	if msg.extensions == nil {
+		msg.extensions = make(map[protoreflect.FullName]extensionField)
+	}
+	msg.extensions[extDesc.FullName()] = extensionField{extType: extType, val: val}
+	return nil
+}
+
+func getExtension(registry *protoregistry.Types) starlark.Callable {
+	return starlark.NewBuiltin("proto.get_extension", func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var val, extVal starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &val, &extVal); err != nil {
+			return nil, err
+		}
+		msg, ok := val.(*protoMessage)
+		if !ok {
+			return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+		}
+		extType, err := resolveExtension(registry, extVal)
+		if err != nil {
+			return nil, fmt.Errorf("%s: for parameter 2: %v", fn.Name(), err)
+		}
+		got, err := msg.getExtension(extType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		return got, nil
+	})
+}
+
+func setExtension(registry *protoregistry.Types) starlark.Callable {
+	return starlark.NewBuiltin("proto.set_extension", func(
+		t *starlark.Thread,
+		fn *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var val, extVal, value starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 3, &val, &extVal, &value); err != nil {
+			return nil, err
+		}
+		msg, ok := val.(*protoMessage)
+		if !ok {
+			return nil, fmt.Errorf("%s: for parameter 1: got %s, want proto.Message", fn.Name(), val.Type())
+		}
+		extType, err := resolveExtension(registry, extVal)
+		if err != nil {
+			return nil, fmt.Errorf("%s: for parameter 2: %v", fn.Name(), err)
+		}
+		if err := msg.setExtension(extType, value); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		return starlark.None, nil
+	})
+}
@@ -38,6 +38,9 @@ var allowedListMethods = map[string]func(*protoRepeated) starlark.Value{
 type protoRepeated struct {
 	fieldDesc protoreflect.FieldDescriptor
 	list      *starlark.List
+
+	// How appended values are converted.
+	conv conversionOptions
 }
 
 var _ starlark.Value = (*protoRepeated)(nil)
@@ -50,11 +53,11 @@ var _ starlark.HasBinary = (*protoRepeated)(nil)
 var _ starlark.Comparable = (*protoRepeated)(nil)
 
 func newProtoRepeated(fieldDesc protoreflect.FieldDescriptor) *protoRepeated {
-	return &protoRepeated{fieldDesc, starlark.NewList(nil)}
+	return &protoRepeated{fieldDesc: fieldDesc, list: starlark.NewList(nil)}
 }
 
 func newProtoRepeatedFromList(fieldDesc protoreflect.FieldDescriptor, l *starlark.List) (*protoRepeated, error) {
-	out := &protoRepeated{fieldDesc, l}
+	out := &protoRepeated{fieldDesc: fieldDesc, list: l}
 	for i := 0; i < l.Len(); i++ {
 		err := scalarTypeCheck(fieldDesc, l.Index(i))
 		if err != nil {
@@ -99,7 +102,11 @@ func (r *protoRepeated) CompareSameType(op syntax.Token, y starlark.Value, depth
 }
 
 func (r *protoRepeated) Append(v starlark.Value) error {
-	err := scalarTypeCheck(r.fieldDesc, v)
+	v, err := convertElement(r.fieldDesc, v, r.conv)
+	if err != nil {
+		return err
+	}
+	err = scalarTypeCheck(r.fieldDesc, v)
 	if err != nil {
 		return err
 	}
@@ -108,7 +115,11 @@ func (r *protoRepeated) Append(v starlark.Value) error {
 }
 
 func (r *protoRepeated) SetIndex(i int, v starlark.Value) error {
-	err := scalarTypeCheck(r.fieldDesc, v)
+	v, err := convertElement(r.fieldDesc, v, r.conv)
+	if err != nil {
+		return err
+	}
+	err = scalarTypeCheck(r.fieldDesc, v)
 	if err != nil {
 		return err
 	}
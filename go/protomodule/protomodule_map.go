@@ -39,6 +39,9 @@ type protoMap struct {
 	mapKey   protoreflect.FieldDescriptor
 	mapValue protoreflect.FieldDescriptor
 	dict     *starlark.Dict
+
+	// How values set on the map are converted.
+	conv conversionOptions
 }
 
 var _ starlark.Value = (*protoMap)(nil)
@@ -56,17 +59,19 @@ func newProtoMap(mapKey protoreflect.FieldDescriptor, mapValue protoreflect.Fiel
 	}
 }
 
-func newProtoMapFromDict(mapKey protoreflect.FieldDescriptor, mapValue protoreflect.FieldDescriptor, d *starlark.Dict) (*protoMap, error) {
+func newProtoMapFromDict(mapKey protoreflect.FieldDescriptor, mapValue protoreflect.FieldDescriptor, d *starlark.Dict, conv conversionOptions) (*protoMap, error) {
 	out := &protoMap{
 		mapKey:   mapKey,
 		mapValue: mapValue,
 		dict:     d,
+		conv:     conv,
 	}
 
 	// SetKey is used to typecheck fields appropriately but done on a temporary object
 	// so that the underlying out.dict still has a reference to the given
 	// dict rather than copying
 	tmpMap := newProtoMap(mapKey, mapValue)
+	tmpMap.conv = conv
 	for _, item := range d.Items() {
 		err := tmpMap.SetKey(item[0], item[1])
 		if err != nil {
@@ -74,6 +79,14 @@ func newProtoMapFromDict(mapKey protoreflect.FieldDescriptor, mapValue protorefl
 		}
 	}
 
+	// Values that SetKey may convert, such as strings to
+	// google.protobuf.Duration, are kept in the temporary copy instead, so
+	// the caller's dict is left unchanged and may be frozen.
+	if mapValue.Kind() == protoreflect.EnumKind || mapValue.Kind() == protoreflect.MessageKind {
+		out.dict = tmpMap.dict
+		return out, nil
+	}
+
 	// Remove any None values from map, see SetKey for compatibility behavior
 	for _, item := range d.Items() {
 		if item[1] == starlark.None {
@@ -174,6 +187,10 @@ func (m *protoMap) SetKey(k, v starlark.Value) error {
 	}
 
 	// Typecheck value
+	v, err = convertElement(m.mapValue, v, m.conv)
+	if err != nil {
+		return err
+	}
 	err = scalarTypeCheck(m.mapValue, v)
 	if err != nil {
 		return err
@@ -19,6 +19,7 @@ package protomodule
 import (
 	"fmt"
 	"sort"
+	"sync"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
@@ -31,46 +32,84 @@ import (
 // NewMessage returns a Starlark value representing the given Protobuf
 // message. It can be returned back to a proto.Message() via AsProtoMessage().
 //
-// NewMessage copies the input proto.Message and therefore does not modify it
+// NewMessage copies the input proto.Message and therefore does not modify it.
+// Fields of the copy are converted to Starlark values when first accessed.
 func NewMessage(msg proto.Message) (*protoMessage, error) {
-	msgReflect := msg.ProtoReflect()
-
-	fields := make(map[string]starlark.Value)
-
-	// Copy any existing set fields
-	var rangeErr error
-	msgReflect.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
-		// Protobuf field presense is complex: https://github.com/protocolbuffers/protobuf/blob/d67f921f90e3aa03f65c3e1e507ca7017c8327a6/docs/field_presence.md
-		// There are two different manifestations of presence for protobufs: no
-		// presence, where the generated message API stores field values (only),
-		// and explicit presence, where the API also stores whether or not a
-		// field has been set.
-		// For fields with explicit presence, we trust `Range`: if it iterates over them, we keep the field.
-		// For fields with no presence, we manually double-check whether the field is equal to the default value. If so, we omit it.
-		if fd.HasPresence() || isFieldSet(v, fd) {
-			starlarkValue, err := valueToStarlark(v, fd)
-			if err != nil {
-				rangeErr = err
-				return false
+	return newLazyMessage(proto.Clone(msg).ProtoReflect()), nil
+}
+
+// newLazyMessage returns a Starlark value wrapping src, which is shared
+// rather than copied and so must not be modified afterwards.
+func newLazyMessage(src protoreflect.Message) *protoMessage {
+	return &protoMessage{
+		msg:     src.New().Interface(),
+		msgDesc: src.Descriptor(),
+		src:     src,
+	}
+}
+
+// load converts the fields of a lazily wrapped message to Starlark values.
+// Sub-messages are wrapped lazily in turn, so only the parts of a message
+// that are accessed get converted.
+func (msg *protoMessage) load() error {
+	if msg.src == nil {
+		return nil
+	}
+	msg.loadOnce.Do(func() {
+		fields := make(map[string]starlark.Value)
+		var extensions map[protoreflect.FullName]extensionField
+
+		// Copy any existing set fields
+		var rangeErr error
+		msg.src.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			// Protobuf field presense is complex: https://github.com/protocolbuffers/protobuf/blob/d67f921f90e3aa03f65c3e1e507ca7017c8327a6/docs/field_presence.md
+			// There are two different manifestations of presence for protobufs: no
+			// presence, where the generated message API stores field values (only),
+			// and explicit presence, where the API also stores whether or not a
+			// field has been set.
+			// For fields with explicit presence, we trust `Range`: if it iterates over them, we keep the field.
+			// For fields with no presence, we manually double-check whether the field is equal to the default value. If so, we omit it.
+			if fd.HasPresence() || isFieldSet(v, fd) {
+				starlarkValue, err := valueToStarlark(v, fd, msg.conv)
+				if err != nil {
+					rangeErr = err
+					return false
+				}
+				if msg.frozen {
+					starlarkValue.Freeze()
+				} else {
+					msg.adopt(starlarkValue)
+				}
+				if extDesc, ok := fd.(protoreflect.ExtensionTypeDescriptor); ok {
+					if extensions == nil {
+						extensions = make(map[protoreflect.FullName]extensionField)
+					}
+					extensions[fd.FullName()] = extensionField{extType: extDesc.Type(), val: starlarkValue}
+					return true
+				}
+				fields[string(fd.Name())] = starlarkValue
 			}
-			fields[string(fd.Name())] = starlarkValue
+			return true
+		})
+		if rangeErr != nil {
+			msg.loadErr = rangeErr
+			return
 		}
-		return true
-	})
-	if rangeErr != nil {
-		return nil, rangeErr
-	}
 
-	// Clone and reset the input msg to ensure no mutations
-	cloned := proto.Clone(msg)
-	proto.Reset(cloned)
+		msg.fields = fields
+		msg.extensions = extensions
+		if raw := msg.src.GetUnknown(); len(raw) > 0 {
+			msg.unknown = append(protoreflect.RawFields(nil), raw...)
+		}
 
-	return &protoMessage{
-		msg:     cloned,
-		msgDesc: msgReflect.Descriptor(),
-		fields:  fields,
-		frozen:  false,
-	}, nil
+		// A frozen message still matches src, which may be read concurrently
+		// and is kept for converting it back to Go. Otherwise the fields
+		// are now authoritative.
+		if !msg.frozen {
+			msg.src = nil
+		}
+	})
+	return msg.loadErr
 }
 
 // AsProtoMessage returns a Protobuf message underlying the given Starlark
@@ -83,27 +122,67 @@ func AsProtoMessage(v starlark.Value) (proto.Message, bool) {
 	return nil, false
 }
 
+// FieldValue returns the value of a field of msg as a Starlark value, as it's
+// read by configs. Sub-messages share storage with msg rather than being
+// copied, so msg must not be modified while the value is in use.
+func FieldValue(msg protoreflect.Message, field protoreflect.FieldDescriptor) (starlark.Value, error) {
+	return valueToStarlark(msg.Get(field), field, conversionOptions{})
+}
+
 // protoMessage exposes an underlying protobuf message as a starlark.Value
 //
 // Internally protoMessage tracks the message state on the `fields` map. Values
 // are stored as starlark.Value through execution and only converted into a
 // proto.Message through AsProtoMessage. Any fields set to starlark.None or the
-// default field value will be ignored when returning to a protobuf.Message
+// default field value will be ignored when returning to a protobuf.Message.
+// Messages created from Go fill the map on first access, see load.
 type protoMessage struct {
-	// A copy of the underlying is stored so AsProtoMessage can construct a new object
+	// An empty message of the underlying type is stored so AsProtoMessage can
+	// construct a new object
 	msg     proto.Message
 	msgDesc protoreflect.MessageDescriptor
 	fields  map[string]starlark.Value
 	frozen  bool
+
+	// Extensions set on the message, indexed by full name.
+	extensions map[protoreflect.FullName]extensionField
+
+	// Unknown fields of the message it was created from, such as fields
+	// added to the schema after the config was written.
+	unknown protoreflect.RawFields
+
+	// How field values are converted, see WithEnumConversion and
+	// WithStructValues.
+	conv conversionOptions
+
+	// The thread that constructed the message, which is used to record the
+	// positions at which fields are set. Nil for messages created by Go.
+	thread    *starlark.Thread
+	pos       syntax.Position
+	positions map[string]syntax.Position
+
+	// Frozen messages can't change, so they're converted at most once. The
+	// converted message is shared and must not be modified.
+	converted     proto.Message
+	convertedOnce sync.Once
+
+	// For messages wrapped by newLazyMessage, the message whose fields are
+	// converted by load. It may be shared with the message it was read
+	// from, and is never modified.
+	src      protoreflect.Message
+	loadOnce sync.Once
+	loadErr  error
 }
 
 var _ starlark.Value = (*protoMessage)(nil)
 var _ starlark.HasAttrs = (*protoMessage)(nil)
 var _ starlark.HasSetField = (*protoMessage)(nil)
+var _ starlark.Mapping = (*protoMessage)(nil)
+var _ starlark.HasSetKey = (*protoMessage)(nil)
 var _ starlark.Comparable = (*protoMessage)(nil)
 
 func (msg *protoMessage) String() string {
-	return fmt.Sprintf("<%s %s>", msg.Type(), (prototext.MarshalOptions{Multiline: false}).Format(msg.toProtoMessage()))
+	return fmt.Sprintf("<%s %s>", msg.Type(), (prototext.MarshalOptions{Multiline: false}).Format(msg.sharedProtoMessage()))
 }
 func (msg *protoMessage) Type() string         { return string(msg.msgDesc.FullName()) }
 func (msg *protoMessage) Truth() starlark.Bool { return starlark.True }
@@ -117,6 +196,9 @@ func (msg *protoMessage) Freeze() {
 		for _, field := range msg.fields {
 			field.Freeze()
 		}
+		for _, ext := range msg.extensions {
+			ext.val.Freeze()
+		}
 	}
 }
 
@@ -126,7 +208,11 @@ func (msg *protoMessage) Clear() error {
 		return err
 	}
 
+	msg.src = nil
 	msg.fields = make(map[string]starlark.Value)
+	msg.extensions = nil
+	msg.unknown = nil
+	msg.positions = nil
 
 	return nil
 }
@@ -146,10 +232,10 @@ func (msg *protoMessage) CompareSameType(op syntax.Token, y starlark.Value, dept
 
 	switch op {
 	case syntax.EQL:
-		eql := proto.Equal(msg.toProtoMessage(), other.toProtoMessage())
+		eql := proto.Equal(msg.sharedProtoMessage(), other.sharedProtoMessage())
 		return eql, nil
 	case syntax.NEQ:
-		eql := proto.Equal(msg.toProtoMessage(), other.toProtoMessage())
+		eql := proto.Equal(msg.sharedProtoMessage(), other.sharedProtoMessage())
 		return !eql, nil
 	default:
 		return false, fmt.Errorf("Only == and != operations are supported on protobufs, found %s", op.String())
@@ -159,7 +245,7 @@ func (msg *protoMessage) CompareSameType(op syntax.Token, y starlark.Value, dept
 func (msg *protoMessage) MarshalJSON() ([]byte, error) {
 	jsonData, err := (protojson.MarshalOptions{
 		UseProtoNames: true,
-	}).Marshal(msg.toProtoMessage())
+	}).Marshal(msg.sharedProtoMessage())
 	if err != nil {
 		return nil, err
 	}
@@ -167,6 +253,10 @@ func (msg *protoMessage) MarshalJSON() ([]byte, error) {
 }
 
 func (msg *protoMessage) Attr(name string) (starlark.Value, error) {
+	if err := msg.load(); err != nil {
+		return starlark.None, err
+	}
+
 	// If a value has already been set on msg, return it
 	if val, ok := msg.fields[name]; ok {
 		return val, nil
@@ -174,13 +264,16 @@ func (msg *protoMessage) Attr(name string) (starlark.Value, error) {
 
 	fieldDesc := getFieldDescriptor(msg.msgDesc, name)
 	if fieldDesc == nil {
+		if val, err := timeAttr(msg, name); val != nil || err != nil {
+			return val, err
+		}
 		return starlark.None, fmt.Errorf("AttributeError: `%s' value has no field %q", msg.Type(), name)
 	}
 
 	// Given field name exists but has not been set, return a default value
 	val := fieldDesc.Default()
 
-	starlarkValue, err := valueToStarlark(val, fieldDesc)
+	starlarkValue, err := valueToStarlark(val, fieldDesc, msg.conv)
 	if err != nil {
 		return starlark.None, err
 	}
@@ -200,7 +293,12 @@ func (msg *protoMessage) Attr(name string) (starlark.Value, error) {
 }
 
 func (msg *protoMessage) AttrNames() []string {
-	return fieldNames(msg.msgDesc)
+	names := fieldNames(msg.msgDesc)
+	if timeNames := timeAttrNames(msg.msgDesc); timeNames != nil {
+		names = append(names, timeNames...)
+		sort.Strings(names)
+	}
+	return names
 }
 
 func fieldNames(msgDesc protoreflect.MessageDescriptor) []string {
@@ -223,28 +321,194 @@ func (msg *protoMessage) SetField(name string, val starlark.Value) error {
 	if err := msg.CheckMutable("set field of"); err != nil {
 		return err
 	}
+	if err := msg.load(); err != nil {
+		return err
+	}
+
+	val, err := convertFieldValue(fieldDesc, val, msg.conv)
+	if err != nil {
+		return err
+	}
+
+	// Allow using msg_field = None to unset a scalar message field
+	if fieldAllowsNone(fieldDesc) && val == starlark.None {
+		delete(msg.fields, name)
+		delete(msg.positions, name)
+		return nil
+	}
 
+	if err := checkFieldValue(fieldDesc, val); err != nil {
+		return err
+	}
+
+	// Clear other oneof
+	oneof := fieldDesc.ContainingOneof()
+	if oneof != nil {
+		fields := oneof.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			delete(msg.fields, string(fields.Get(i).Name()))
+			delete(msg.positions, string(fields.Get(i).Name()))
+		}
+	}
+
+	msg.adopt(val)
+	msg.fields[name] = val
+	msg.recordPosition(name)
+
+	return nil
+}
+
+// adopt applies the settings of msg to a value stored in one of its fields.
+// Nested messages created by Go, such as defaults of unset fields, record
+// positions on the same thread as their parent, and convert enums like it.
+func (msg *protoMessage) adopt(val starlark.Value) {
+	switch val := val.(type) {
+	case *protoMessage:
+		if val.thread == nil && !val.frozen {
+			val.thread = msg.thread
+			val.conv = msg.conv
+		}
+	case *protoRepeated:
+		val.conv = msg.conv
+		for i := 0; i < val.list.Len(); i++ {
+			msg.adopt(val.list.Index(i))
+		}
+	case *protoMap:
+		val.conv = msg.conv
+		for _, item := range val.dict.Items() {
+			msg.adopt(item[1])
+		}
+	}
+}
+
+// clone returns a copy of msg, including the positions at which its fields
+// were set, without converting it to Protobuf. Nested messages and containers
+// are copied, and record further positions on thread.
+func (msg *protoMessage) clone(thread *starlark.Thread) (*protoMessage, error) {
+	if msg.src != nil {
+		// Messages wrapped lazily haven't been modified, so they can
+		// share the message they were read from.
+		out := newLazyMessage(msg.src)
+		out.thread = thread
+		out.conv = msg.conv
+		return out, nil
+	}
+	out := &protoMessage{
+		msg:     msg.msg,
+		msgDesc: msg.msgDesc,
+		fields:  make(map[string]starlark.Value, len(msg.fields)),
+		unknown: msg.unknown,
+		conv:    msg.conv,
+		thread:  thread,
+		pos:     msg.pos,
+	}
+	for name, val := range msg.fields {
+		copied, err := cloneValue(thread, val)
+		if err != nil {
+			return nil, err
+		}
+		out.fields[name] = copied
+	}
+	if len(msg.extensions) > 0 {
+		out.extensions = make(map[protoreflect.FullName]extensionField, len(msg.extensions))
+		for name, ext := range msg.extensions {
+			copied, err := cloneValue(thread, ext.val)
+			if err != nil {
+				return nil, err
+			}
+			out.extensions[name] = extensionField{extType: ext.extType, val: copied}
+		}
+	}
+	if len(msg.positions) > 0 {
+		out.positions = make(map[string]syntax.Position, len(msg.positions))
+		for name, pos := range msg.positions {
+			out.positions[name] = pos
+		}
+	}
+	return out, nil
+}
+
+// cloneValue returns a copy of a field value for clone. Immutable values are
+// returned as is.
+func cloneValue(thread *starlark.Thread, val starlark.Value) (starlark.Value, error) {
+	switch val := val.(type) {
+	case *protoMessage:
+		return val.clone(thread)
+	case *protoRepeated:
+		list, err := cloneValue(thread, val.list)
+		if err != nil {
+			return nil, err
+		}
+		return &protoRepeated{
+			fieldDesc: val.fieldDesc,
+			list:      list.(*starlark.List),
+			conv:      val.conv,
+		}, nil
+	case *protoMap:
+		dict, err := cloneValue(thread, val.dict)
+		if err != nil {
+			return nil, err
+		}
+		return &protoMap{
+			mapKey:   val.mapKey,
+			mapValue: val.mapValue,
+			dict:     dict.(*starlark.Dict),
+			conv:     val.conv,
+		}, nil
+	case *starlark.List:
+		// Values of google.protobuf.Struct fields may be plain lists and
+		// dicts.
+		elems := make([]starlark.Value, val.Len())
+		for i := range elems {
+			elem, err := cloneValue(thread, val.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return starlark.NewList(elems), nil
+	case *starlark.Dict:
+		dict := starlark.NewDict(val.Len())
+		for _, item := range val.Items() {
+			elem, err := cloneValue(thread, item[1])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(item[0], elem); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return val, nil
+}
+
+// convertFieldValue converts Starlark lists, dicts and primitives to the
+// values stored for repeated, map and wrapper fields on assignment, as
+// adjusted by conv.
+func convertFieldValue(fieldDesc protoreflect.FieldDescriptor, val starlark.Value, conv conversionOptions) (starlark.Value, error) {
 	// Autoconvert starlark.List, starlark.Dict, wrapperspb on assignment
 	if fieldDesc.IsList() {
 		if starlarkListVal, ok := val.(*starlark.List); ok {
-			// To support repeated StringValue support autoboxing
-			// if relevant conversion, mutate incoming list
-			if fieldDesc.Kind() == protoreflect.MessageKind {
-				for i := 0; i < starlarkListVal.Len(); i++ {
-					msg, err := maybeConvertToWrapper(fieldDesc, starlarkListVal.Index(i))
+			// To support repeated StringValue autoboxing and enum names,
+			// convert elements into a new list. The caller's list is left
+			// unchanged, and may be frozen.
+			if fieldDesc.Kind() == protoreflect.MessageKind || fieldDesc.Kind() == protoreflect.EnumKind {
+				elems := make([]starlark.Value, starlarkListVal.Len())
+				for i := range elems {
+					elem, err := convertElement(fieldDesc, starlarkListVal.Index(i), conv)
 					if err != nil {
-						return err
-					}
-					if msg != nil {
-						starlarkListVal.SetIndex(i, msg)
+						return nil, err
 					}
+					elems[i] = elem
 				}
+				starlarkListVal = starlark.NewList(elems)
 			}
 
 			// Convert starlark.List to protoRepeated
 			list, err := newProtoRepeatedFromList(fieldDesc, starlarkListVal)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			val = list
@@ -252,47 +516,30 @@ func (msg *protoMessage) SetField(name string, val starlark.Value) error {
 	} else if fieldDesc.IsMap() {
 		if starlarkDictVal, ok := val.(*starlark.Dict); ok {
 			// Convert stalark.Map into protoMap
-			mapVal, err := newProtoMapFromDict(fieldDesc.MapKey(), fieldDesc.MapValue(), starlarkDictVal)
+			mapVal, err := newProtoMapFromDict(fieldDesc.MapKey(), fieldDesc.MapValue(), starlarkDictVal, conv)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			val = mapVal
 		}
+	} else if fieldDesc.Kind() == protoreflect.EnumKind {
+		enum, err := maybeConvertToEnum(fieldDesc, val, conv)
+		if err != nil {
+			return nil, err
+		}
+		val = enum
 	} else if fieldDesc.Kind() == protoreflect.MessageKind {
 		msg, err := maybeConvertToWrapper(fieldDesc, val)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if msg != nil {
 			val = msg
 		}
 	}
 
-	// Allow using msg_field = None to unset a scalar message field
-	if fieldAllowsNone(fieldDesc) && val == starlark.None {
-		delete(msg.fields, name)
-		return nil
-	}
-
-	// If valueFromStarlark returns an error, the val cannot be assigned to the field
-	_, err := valueFromStarlark(msg.msg.ProtoReflect(), fieldDesc, val)
-	if err != nil {
-		return err
-	}
-
-	// Clear other oneof
-	oneof := fieldDesc.ContainingOneof()
-	if oneof != nil {
-		fields := oneof.Fields()
-		for i := 0; i < fields.Len(); i++ {
-			delete(msg.fields, string(fields.Get(i).Name()))
-		}
-	}
-
-	msg.fields[name] = val
-
-	return nil
+	return val, nil
 }
 
 // Applies default values for proto2 fields with defaults that are not already set
@@ -300,6 +547,9 @@ func (msg *protoMessage) SetDefaults() error {
 	if err := msg.CheckMutable("set field defaults of"); err != nil {
 		return err
 	}
+	if err := msg.load(); err != nil {
+		return err
+	}
 
 	for _, fieldName := range fieldNames(msg.msgDesc) {
 		fieldDesc := getFieldDescriptor(msg.msgDesc, fieldName)
@@ -316,7 +566,7 @@ func (msg *protoMessage) SetDefaults() error {
 			continue
 		}
 
-		val, err := valueToStarlark(fieldDesc.Default(), fieldDesc)
+		val, err := valueToStarlark(fieldDesc.Default(), fieldDesc, msg.conv)
 		if err != nil {
 			return err
 		}
@@ -329,6 +579,11 @@ func (msg *protoMessage) SetDefaults() error {
 
 // Merges values from other into msg following proto.Merge logic
 func (msg *protoMessage) Merge(other *protoMessage) error {
+	return msg.mergeWith(other, nil)
+}
+
+// mergeWith merges values from other into msg, adjusted by opts.
+func (msg *protoMessage) mergeWith(other *protoMessage, opts *mergeOptions) error {
 	if msg.Type() != other.Type() {
 		return fmt.Errorf("Cannot merge protobufs of different types: Merge(%s, %s) ", msg.Type(), other.Type())
 	}
@@ -336,6 +591,12 @@ func (msg *protoMessage) Merge(other *protoMessage) error {
 	if err := msg.CheckMutable("merge"); err != nil {
 		return err
 	}
+	if err := msg.load(); err != nil {
+		return err
+	}
+	if err := other.load(); err != nil {
+		return err
+	}
 
 	for fieldName, val := range other.fields {
 		fieldDesc := getFieldDescriptor(msg.msgDesc, fieldName)
@@ -343,7 +604,7 @@ func (msg *protoMessage) Merge(other *protoMessage) error {
 			continue
 		}
 
-		merged, err := mergeField(msg.fields[fieldName], val)
+		merged, err := mergeField(msg.fields[fieldName], val, opts)
 		if err != nil {
 			return err
 		}
@@ -351,13 +612,60 @@ func (msg *protoMessage) Merge(other *protoMessage) error {
 		msg.SetField(fieldName, merged)
 	}
 
+	if len(other.unknown) > 0 {
+		unknown := make(protoreflect.RawFields, 0, len(msg.unknown)+len(other.unknown))
+		unknown = append(unknown, msg.unknown...)
+		msg.unknown = append(unknown, other.unknown...)
+	}
+
+	for _, ext := range other.extensions {
+		var dst starlark.Value
+		if field, ok := msg.extensions[ext.extType.TypeDescriptor().FullName()]; ok {
+			dst = field.val
+		}
+		merged, err := mergeField(dst, ext.val, opts)
+		if err != nil {
+			return err
+		}
+		if err := msg.setExtension(ext.extType, merged); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// Construct a new instance of msg.msg and set each field on msg.fields
+// toProtoMessage returns a new message with the values of msg's fields, which
+// the caller may modify. Frozen messages copy the message cached by
+// sharedProtoMessage, while others convert each of their fields again.
 func (msg *protoMessage) toProtoMessage() proto.Message {
-	out := proto.Clone(msg.msg)
-	proto.Reset(out)
+	if msg.src != nil {
+		return proto.Clone(msg.src.Interface())
+	}
+	if msg.frozen {
+		return proto.Clone(msg.sharedProtoMessage())
+	}
+	return msg.buildProtoMessage()
+}
+
+// sharedProtoMessage is like toProtoMessage, but the returned message may be
+// shared with other callers and must not be modified. Only frozen messages
+// cache the converted message; others are converted on every call.
+func (msg *protoMessage) sharedProtoMessage() proto.Message {
+	if msg.src != nil {
+		return msg.src.Interface()
+	}
+	if !msg.frozen {
+		return msg.buildProtoMessage()
+	}
+	msg.convertedOnce.Do(func() {
+		msg.converted = msg.buildProtoMessage()
+	})
+	return msg.converted
+}
+
+func (msg *protoMessage) buildProtoMessage() proto.Message {
+	out := msg.msg.ProtoReflect().New()
 
 	// All entries in msg.fields should exist as fields on the message, and
 	// the values be the corresponding type, checked in SetField
@@ -366,28 +674,22 @@ func (msg *protoMessage) toProtoMessage() proto.Message {
 		if fieldDesc == nil {
 			continue
 		}
+		setFieldFromStarlark(out, fieldDesc, val)
+	}
 
-		protoValue, err := valueFromStarlark(msg.msg.ProtoReflect(), fieldDesc, val)
-		if err != nil {
-			continue
-		}
+	for _, ext := range msg.extensions {
+		setFieldFromStarlark(out, ext.extType.TypeDescriptor(), ext.val)
+	}
 
-		out.ProtoReflect().Set(fieldDesc, protoValue)
+	if len(msg.unknown) > 0 {
+		out.SetUnknown(append(protoreflect.RawFields(nil), msg.unknown...))
 	}
 
-	return out
+	return out.Interface()
 }
 
 func getFieldDescriptor(msgDesc protoreflect.MessageDescriptor, fieldName string) protoreflect.FieldDescriptor {
-	fields := msgDesc.Fields()
-	for i := 0; i < fields.Len(); i++ {
-		field := fields.Get(i)
-		if fieldName == string(field.Name()) {
-			return field
-		}
-	}
-
-	return nil
+	return msgDesc.Fields().ByName(protoreflect.Name(fieldName))
 }
 
 // Return if a value is not the default
@@ -22,10 +22,17 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	pb "github.com/stripe/skycfg/internal/testdata/test_proto"
@@ -56,6 +63,7 @@ func TestMessageAttrNames(t *testing.T) {
 		"f_nested_enum",
 		"f_oneof_a",
 		"f_oneof_b",
+		"f_optional_int32",
 		"f_bytes",
 		"f_BoolValue",
 		"f_StringValue",
@@ -67,6 +75,12 @@ func TestMessageAttrNames(t *testing.T) {
 		"f_Uint64Value",
 		"r_StringValue",
 		"f_Any",
+		"f_Duration",
+		"f_Timestamp",
+		"r_Duration",
+		"f_Struct",
+		"f_Value",
+		"f_ListValue",
 	}
 	sort.Strings(want)
 	if !reflect.DeepEqual(want, got) {
@@ -154,7 +168,7 @@ func TestMessageV2(t *testing.T) {
 		},
 		FToplevelEnum: pb.ToplevelEnumV2_TOPLEVEL_ENUM_V2_B.Enum(),
 		FNestedEnum:   pb.MessageV2_NESTED_ENUM_B.Enum(),
-		FOneof:        &pb.MessageV2_FOneofA{"string in oneof"},
+		FOneof:        &pb.MessageV2_FOneofA{FOneofA: "string in oneof"},
 		FBytes:        []byte("also some string"),
 		F_BoolValue:   &wrapperspb.BoolValue{Value: true},
 		F_StringValue: &wrapperspb.StringValue{Value: "something"},
@@ -310,7 +324,7 @@ func TestMessageV3(t *testing.T) {
 		},
 		FToplevelEnum: pb.ToplevelEnumV3_TOPLEVEL_ENUM_V3_B,
 		FNestedEnum:   pb.MessageV3_NESTED_ENUM_B,
-		FOneof:        &pb.MessageV3_FOneofA{"string in oneof"},
+		FOneof:        &pb.MessageV3_FOneofA{FOneofA: "string in oneof"},
 		FBytes:        []byte("also some string"),
 		F_BoolValue:   &wrapperspb.BoolValue{Value: true},
 		F_StringValue: &wrapperspb.StringValue{Value: "something"},
@@ -433,8 +447,8 @@ func TestAttrValidation(t *testing.T) {
 		},
 		{
 			name:    "enum",
-			src:     `pb.MessageV3(f_toplevel_enum = 0)`,
-			wantErr: fmt.Errorf(`TypeError: value 0 (type "int") can't be assigned to type "skycfg.test_proto.ToplevelEnumV3".`),
+			src:     `pb.MessageV3(f_toplevel_enum = 1.5)`,
+			wantErr: fmt.Errorf(`TypeError: value 1.5 (type "float") can't be assigned to type "skycfg.test_proto.ToplevelEnumV3".`),
 		},
 
 		// Non-scalar type mismatch
@@ -815,7 +829,7 @@ func TestProtoMergeV2(t *testing.T) {
 		},
 		FToplevelEnum: pb.ToplevelEnumV2_TOPLEVEL_ENUM_V2_B.Enum(),
 		FNestedEnum:   pb.MessageV2_NESTED_ENUM_B.Enum(),
-		FOneof:        &pb.MessageV2_FOneofA{"f_oneof_a msg1 string in oneof"},
+		FOneof:        &pb.MessageV2_FOneofA{FOneofA: "f_oneof_a msg1 string in oneof"},
 		FBytes:        []byte("f_bytes msg1"),
 	}
 	msg2 := &pb.MessageV2{
@@ -845,7 +859,7 @@ func TestProtoMergeV2(t *testing.T) {
 		},
 		FToplevelEnum: pb.ToplevelEnumV2_TOPLEVEL_ENUM_V2_B.Enum(),
 		FNestedEnum:   pb.MessageV2_NESTED_ENUM_B.Enum(),
-		FOneof:        &pb.MessageV2_FOneofB{"f_oneof_b msg2 string in oneof"},
+		FOneof:        &pb.MessageV2_FOneofB{FOneofB: "f_oneof_b msg2 string in oneof"},
 		FBytes:        []byte("f_bytes msg2"),
 	}
 	proto.Merge(msg1, msg2)
@@ -948,7 +962,7 @@ func TestProtoMergeV3(t *testing.T) {
 		},
 		FToplevelEnum: pb.ToplevelEnumV3_TOPLEVEL_ENUM_V3_B,
 		FNestedEnum:   pb.MessageV3_NESTED_ENUM_B,
-		FOneof:        &pb.MessageV3_FOneofA{"f_oneof_a msg1 string in oneof"},
+		FOneof:        &pb.MessageV3_FOneofA{FOneofA: "f_oneof_a msg1 string in oneof"},
 		FBytes:        []byte("f_bytes msg1"),
 	}
 	msg2 := &pb.MessageV3{
@@ -978,7 +992,7 @@ func TestProtoMergeV3(t *testing.T) {
 		},
 		FToplevelEnum: pb.ToplevelEnumV3_TOPLEVEL_ENUM_V3_B,
 		FNestedEnum:   pb.MessageV3_NESTED_ENUM_B,
-		FOneof:        &pb.MessageV3_FOneofB{"f_oneof_b msg2 string in oneof"},
+		FOneof:        &pb.MessageV3_FOneofB{FOneofB: "f_oneof_b msg2 string in oneof"},
 		FBytes:        []byte("f_bytes msg2"),
 	}
 	proto.Merge(msg1, msg2)
@@ -1001,6 +1015,812 @@ func TestProtoMergeDiffTypes(t *testing.T) {
 	}
 }
 
+func TestListFieldConversion(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "frozen list",
+			srcFunc: `
+NAMES = ["s1", "s2"]
+
+def fun():
+	return proto.package("skycfg.test_proto").MessageV3(r_StringValue = NAMES)
+`,
+			want: &pb.MessageV3{
+				R_StringValue: []*wrapperspb.StringValue{
+					wrapperspb.String("s1"),
+					wrapperspb.String("s2"),
+				},
+			},
+		},
+		{
+			name: "assigned list is unchanged",
+			srcFunc: `
+def fun():
+	names = ["s1", "s2"]
+	proto.package("skycfg.test_proto").MessageV3(r_StringValue = names)
+	return names
+`,
+			want: `["s1", "s2"]`,
+		},
+	})
+}
+
+func TestEnumFieldConversion(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "names and numbers",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV3(f_toplevel_enum = "TOPLEVEL_ENUM_V3_B", r_submsg = [])
+	msg.f_nested_enum = 1
+	return msg
+`,
+			want: &pb.MessageV3{
+				FToplevelEnum: pb.ToplevelEnumV3_TOPLEVEL_ENUM_V3_B,
+				FNestedEnum:   pb.MessageV3_NESTED_ENUM_B,
+			},
+		},
+		{
+			name: "read back as enum value",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_toplevel_enum = "TOPLEVEL_ENUM_V3_B").f_toplevel_enum`,
+			want: `<skycfg.test_proto.ToplevelEnumV3 TOPLEVEL_ENUM_V3_B=1>`,
+		},
+		{
+			name: "proto.set",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto").MessageV2()
+	proto.set(msg, "f_submsg.f_nested_enum", "NESTED_ENUM_B")
+	return msg
+`,
+			want: &pb.MessageV2{
+				FSubmsg: &pb.MessageV2{FNestedEnum: pb.MessageV2_NESTED_ENUM_B.Enum()},
+			},
+		},
+		{
+			name:    "unknown name",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_toplevel_enum = "TOPLEVEL_ENUM_V3_C")`,
+			wantErr: fmt.Errorf(`ValueError: skycfg.test_proto.ToplevelEnumV3 has no value "TOPLEVEL_ENUM_V3_C" (valid values: TOPLEVEL_ENUM_V3_A=0, TOPLEVEL_ENUM_V3_B=1)`),
+		},
+		{
+			name:    "unknown number",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_nested_enum = 2)`,
+			wantErr: fmt.Errorf(`ValueError: skycfg.test_proto.MessageV3.NestedEnum has no value numbered 2 (valid values: NESTED_ENUM_A=0, NESTED_ENUM_B=1)`),
+		},
+		{
+			name:    "number out of int32 range",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_nested_enum = 4294967297)`,
+			wantErr: fmt.Errorf(`ValueError: skycfg.test_proto.MessageV3.NestedEnum has no value numbered 4294967297 (valid values: NESTED_ENUM_A=0, NESTED_ENUM_B=1)`),
+		},
+	}, withGlobals(starlark.StringDict{
+		"proto": NewModule(newRegistry(), WithEnumConversion()),
+	}))
+
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name:    "disabled by default",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_toplevel_enum = "TOPLEVEL_ENUM_V3_B")`,
+			wantErr: fmt.Errorf(`TypeError: value "TOPLEVEL_ENUM_V3_B" (type "string") can't be assigned to type "skycfg.test_proto.ToplevelEnumV3".`),
+		},
+	})
+}
+
+func TestProtoExtensions(t *testing.T) {
+	withExtensions := &pb.MessageV2{
+		FInt32: proto.Int32(1),
+	}
+	proto.SetExtension(withExtensions, pb.E_FExtString, "hello")
+	proto.SetExtension(withExtensions, pb.E_RExtInt32, []int32{1, 2})
+	proto.SetExtension(withExtensions, pb.E_FExtSubmsg, &pb.MessageV2{FString: proto.String("sub")})
+	proto.SetExtension(withExtensions, pb.E_MessageV2_FExtNested, int64(5))
+
+	mergedExtensions := &pb.MessageV2{}
+	proto.SetExtension(mergedExtensions, pb.E_FExtString, "src")
+	proto.SetExtension(mergedExtensions, pb.E_RExtInt32, []int32{1, 2})
+
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "bracket syntax",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2(f_int32 = 1)
+	msg[pb.f_ext_string] = "hello"
+	msg[pb.r_ext_int32].append(1)
+	msg[pb.r_ext_int32].append(2)
+	msg[pb.f_ext_submsg] = pb.MessageV2(f_string = "sub")
+	msg[pb.MessageV2.f_ext_nested] = 5
+	return msg
+`,
+			want: withExtensions,
+		},
+		{
+			name: "set_extension",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2(f_int32 = 1)
+	proto.set_extension(msg, "skycfg.test_proto.f_ext_string", "hello")
+	proto.set_extension(msg, pb.r_ext_int32, [1, 2])
+	proto.set_extension(msg, pb.f_ext_submsg, pb.MessageV2(f_string = "sub"))
+	proto.set_extension(msg, pb.MessageV2.f_ext_nested, 5)
+	return msg
+`,
+			want: withExtensions,
+		},
+		{
+			name: "get_extension",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2()
+	msg[pb.f_ext_string] = "hello"
+	return proto.get_extension(msg, "skycfg.test_proto.f_ext_string")
+`,
+			want: `"hello"`,
+		},
+		{
+			name: "unset extension",
+			src:  `proto.get_extension(proto.package("skycfg.test_proto").MessageV2(), "skycfg.test_proto.f_ext_string")`,
+			want: `""`,
+		},
+		{
+			name: "clear extension",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2(f_int32 = 1)
+	msg[pb.f_ext_string] = "hello"
+	msg[pb.f_ext_string] = None
+	return msg
+`,
+			want: &pb.MessageV2{FInt32: proto.Int32(1)},
+		},
+		{
+			name: "string representation",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2()
+	msg[pb.f_ext_string] = "hello"
+	return str(msg)
+`,
+			want:              `"<skycfg.test_proto.MessageV2 [skycfg.test_proto.f_ext_string]:\"hello\">"`,
+			removeRandomSpace: true,
+		},
+		{
+			name: "clone",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2()
+	msg[pb.f_ext_string] = "hello"
+	return proto.clone(msg)[pb.f_ext_string]
+`,
+			want: `"hello"`,
+		},
+		{
+			name: "merge",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	dst = pb.MessageV2()
+	dst[pb.f_ext_string] = "dst"
+	dst[pb.r_ext_int32] = [1]
+	src = pb.MessageV2()
+	src[pb.f_ext_string] = "src"
+	src[pb.r_ext_int32] = [2]
+	return proto.merge(dst, src)
+`,
+			want: mergedExtensions,
+		},
+		{
+			name: "binary round trip",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2()
+	msg[pb.f_ext_string] = "hello"
+	return proto.decode_binary(pb.MessageV2, proto.encode_binary(msg))[pb.f_ext_string]
+`,
+			want: `"hello"`,
+		},
+		{
+			name:    "wrong message type",
+			src:     `proto.package("skycfg.test_proto").MessageV3()[proto.package("skycfg.test_proto").f_ext_string]`,
+			wantErr: fmt.Errorf("skycfg.test_proto.f_ext_string is not an extension of skycfg.test_proto.MessageV3"),
+		},
+		{
+			name:    "field name key",
+			src:     `proto.package("skycfg.test_proto").MessageV2()["f_int32"]`,
+			wantErr: fmt.Errorf(`skycfg.test_proto.MessageV2: got string key "f_int32", want proto.Extension; use attribute access for fields, such as msg.f_int32`),
+		},
+		{
+			name: "field name membership",
+			src:  `"f_int32" in proto.package("skycfg.test_proto").MessageV2(f_int32 = 1)`,
+			want: `False`,
+		},
+		{
+			name: "set field name key",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto").MessageV2()
+	msg["f_int32"] = 1
+`,
+			wantErr: fmt.Errorf(`skycfg.test_proto.MessageV2: got string key "f_int32", want proto.Extension; use attribute access for fields, such as msg.f_int32`),
+		},
+		{
+			name:    "int key",
+			src:     `proto.package("skycfg.test_proto").MessageV2()[1]`,
+			wantErr: fmt.Errorf("skycfg.test_proto.MessageV2: got int key, want proto.Extension; use attribute access for fields"),
+		},
+		{
+			name:    "unknown extension",
+			src:     `proto.get_extension(proto.package("skycfg.test_proto").MessageV2(), "skycfg.test_proto.no_ext")`,
+			wantErr: fmt.Errorf(`proto.get_extension: for parameter 2: Protobuf extension "skycfg.test_proto.no_ext" not found`),
+		},
+		{
+			name: "wrong value type",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2()
+	msg[pb.f_ext_string] = 1
+`,
+			wantErr: fmt.Errorf(`TypeError: value 1 (type "int") can't be assigned to type "string".`),
+		},
+		{
+			name: "frozen message",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+frozen = pb.MessageV2()
+
+def fun():
+	proto.set_extension(frozen, pb.f_ext_string, "hello")
+`,
+			wantErr: fmt.Errorf("proto.set_extension: cannot set extension of frozen message"),
+		},
+	})
+}
+
+func TestNewMessageExtensions(t *testing.T) {
+	msg := &pb.MessageV2{}
+	proto.SetExtension(msg, pb.E_FExtString, "hello")
+	proto.SetExtension(msg, pb.E_RExtInt32, []int32{1, 2})
+
+	val, err := NewMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := AsProtoMessage(val)
+	if !ok {
+		t.Fatalf("AsProtoMessage: got %T", val)
+	}
+	checkProtoEqual(t, msg, got)
+}
+
+func TestNewMessageUnknownFields(t *testing.T) {
+	msg := &pb.MessageV3{FString: "hello"}
+	msg.ProtoReflect().SetUnknown(protowire.AppendVarint(
+		protowire.AppendTag(nil, 1000, protowire.VarintType), 123))
+
+	val, err := NewMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := AsProtoMessage(val)
+	if !ok {
+		t.Fatalf("AsProtoMessage: got %T", val)
+	}
+	checkProtoEqual(t, msg, got)
+}
+
+func TestNewMessageLazy(t *testing.T) {
+	msg := &pb.MessageV3{
+		FString: "a",
+		FSubmsg: &pb.MessageV3{FString: "b"},
+		RSubmsg: []*pb.MessageV3{{FString: "c"}},
+	}
+	val, err := NewMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes to the input after NewMessage aren't visible to Starlark, and
+	// changes made by Starlark aren't visible in the input.
+	msg.FSubmsg.FString = "changed"
+	globals := starlark.StringDict{"msg": val}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "", `
+msg.f_submsg.f_string += "!"
+msg.r_submsg[0].f_int32 = 1
+`, globals)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := AsProtoMessage(val)
+	if !ok {
+		t.Fatalf("AsProtoMessage: got %T", val)
+	}
+	checkProtoEqual(t, &pb.MessageV3{
+		FString: "a",
+		FSubmsg: &pb.MessageV3{FString: "b!"},
+		RSubmsg: []*pb.MessageV3{{FString: "c", FInt32: 1}},
+	}, got)
+	checkProtoEqual(t, &pb.MessageV3{FString: "changed"}, msg.FSubmsg)
+}
+
+func TestNewMessageLazyFrozen(t *testing.T) {
+	val, err := NewMessage(&pb.MessageV3{
+		FSubmsg: &pb.MessageV3{FString: "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	val.Freeze()
+
+	globals := starlark.StringDict{"msg": val}
+	got, err := eval(`msg.f_submsg.f_string`, globals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != starlark.String("a") {
+		t.Fatalf("got %v, want \"a\"", got)
+	}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "", `msg.f_submsg.f_string = "b"`, globals)
+	checkError(t, err, fmt.Errorf("cannot set field of frozen message"))
+}
+
+func TestNewMessageLazyError(t *testing.T) {
+	// Fields are only checked when they're converted to Starlark values,
+	// so an unknown enum number is reported when its message is accessed.
+	msg := &pb.MessageV3{
+		FSubmsg: &pb.MessageV3{FToplevelEnum: 5},
+	}
+	val, err := NewMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := AsProtoMessage(val)
+	if !ok {
+		t.Fatalf("AsProtoMessage: got %T", val)
+	}
+	checkProtoEqual(t, msg, got)
+
+	_, err = eval(`msg.f_submsg.f_string`, starlark.StringDict{"msg": val})
+	checkError(t, err, fmt.Errorf("ValueError: enum 5 out of bounds for skycfg.test_proto.ToplevelEnumV3"))
+}
+
+func TestAsProtoMessageStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    proto.Message
+		wantErr error
+	}{
+		{
+			name: "valid message",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_float32 = 0.1, f_float64 = 1e300, r_string = ["a"])`,
+			want: &pb.MessageV3{FFloat32: 0.1, FFloat64: 1e300, RString: []string{"a"}},
+		},
+		{
+			name:    "float overflow",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_float32 = 1e300)`,
+			wantErr: fmt.Errorf(`skycfg.test_proto.MessageV3: f_float32: ValueError: value 1e+300 is not exactly representable as type "float".`),
+		},
+		{
+			name:    "inexact integer",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_float64 = 9007199254740993)`,
+			wantErr: fmt.Errorf(`skycfg.test_proto.MessageV3: f_float64: ValueError: value 9007199254740993 is not exactly representable as type "double".`),
+		},
+		{
+			name: "nested field",
+			src: `proto.package("skycfg.test_proto").MessageV3(
+				r_submsg = [proto.package("skycfg.test_proto").MessageV3(f_float32 = 16777217)],
+			)`,
+			wantErr: fmt.Errorf(`skycfg.test_proto.MessageV3: r_submsg[0].f_float32: ValueError: value 16777217 is not exactly representable as type "float".`),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			val, err := eval(test.src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := AsProtoMessageStrict(val)
+			checkError(t, err, test.wantErr)
+			if test.wantErr == nil {
+				checkProtoEqual(t, test.want, got)
+			}
+		})
+	}
+
+	if _, err := AsProtoMessageStrict(starlark.None); err == nil {
+		t.Fatal("AsProtoMessageStrict(None): expected error")
+	}
+}
+
+func TestProtoEvolve(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "copy with changes",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	base = pb.MessageV3(f_int32 = 1, r_string = ["a"], f_submsg = pb.MessageV3(f_string = "x"))
+	derived = proto.evolve(base, f_int64 = 2, r_string = ["b"])
+	derived.f_submsg.f_string = "y"
+	return [base, derived]
+`,
+			want:              `[<skycfg.test_proto.MessageV3 f_int32:1 f_submsg:{f_string:"x"} r_string:"a">, <skycfg.test_proto.MessageV3 f_int32:1 f_int64:2 f_submsg:{f_string:"y"} r_string:"b">]`,
+			removeRandomSpace: true,
+		},
+		{
+			name: "containers are copied",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	base = pb.MessageV3(r_string = ["a"], map_string = {"k": "v"}, r_submsg = [pb.MessageV3(f_int32 = 1)])
+	derived = proto.evolve(base)
+	derived.r_string.append("b")
+	derived.map_string["k"] = "w"
+	derived.r_submsg[0].f_int32 = 2
+	return [base, derived]
+`,
+			want:              `[<skycfg.test_proto.MessageV3 r_string:"a" r_submsg:{f_int32:1} map_string:{key:"k" value:"v"}>, <skycfg.test_proto.MessageV3 r_string:"a" r_string:"b" r_submsg:{f_int32:2} map_string:{key:"k" value:"w"}>]`,
+			removeRandomSpace: true,
+		},
+		{
+			name:    "unknown field",
+			src:     `proto.evolve(proto.package("skycfg.test_proto").MessageV3(), f_missing = 1)`,
+			wantErr: fmt.Errorf("proto.evolve: AttributeError: `skycfg.test_proto.MessageV3' value has no field \"f_missing\""),
+		},
+		{
+			name:    "wrong type",
+			src:     `proto.evolve(1)`,
+			wantErr: fmt.Errorf("proto.evolve: for parameter 1: got int, want proto.Message"),
+		},
+	})
+}
+
+func TestProtoEvolvePositions(t *testing.T) {
+	globals, err := starlark.ExecFile(&starlark.Thread{}, "", `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	base = pb.MessageV3(f_string = "a")
+	base.f_submsg = pb.MessageV3(f_int32 = 1)
+	return proto.evolve(base, f_int64 = 2)
+`, starlark.StringDict{"proto": NewModule(newRegistry())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	thread := &starlark.Thread{}
+	EnableFieldPositions(thread)
+	val, err := starlark.Call(thread, globals["fun"], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for path, pos := range FieldPositions(val) {
+		got[path] = pos.String()
+	}
+	want := map[string]string{
+		"":                 ":6:21",
+		"f_string":         ":4:21",
+		"f_submsg":         ":5:6",
+		"f_submsg.f_int32": ":5:30",
+		"f_int64":          ":6:21",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldPositions() = %v, want %v", got, want)
+	}
+}
+
+func TestFrozenPackage(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name:    "constructed messages are frozen",
+			src:     `proto.package("skycfg.test_proto", frozen = True).MessageV3(r_string = ["a"]).r_string.append("b")`,
+			wantErr: fmt.Errorf("cannot append to frozen list"),
+		},
+		{
+			name: "nested types",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto", frozen = True).MessageV3.NestedMessage()
+	msg.f_string = "a"
+`,
+			wantErr: fmt.Errorf("cannot set field of frozen message"),
+		},
+		{
+			name: "evolve frozen message",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto", frozen = True)
+	base = pb.MessageV3(f_int32 = 1)
+	derived = proto.evolve(base, f_int32 = 2)
+	return [base, derived]
+`,
+			want:              `[<skycfg.test_proto.MessageV3 f_int32:1>, <skycfg.test_proto.MessageV3 f_int32:2>]`,
+			removeRandomSpace: true,
+		},
+		{
+			name: "evolve keeps frozen",
+			srcFunc: `
+def fun():
+	msg = proto.evolve(proto.package("skycfg.test_proto", frozen = True).MessageV3(), f_int32 = 2)
+	msg.f_int64 = 3
+`,
+			wantErr: fmt.Errorf("cannot set field of frozen message"),
+		},
+		{
+			name: "not frozen by default",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto").MessageV3()
+	msg.f_int32 = 1
+	return msg
+`,
+			want: &pb.MessageV3{FInt32: 1},
+		},
+	})
+}
+
+func TestProtoPresence(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "proto2 field set to default",
+			src:  `proto.has(proto.package("skycfg.test_proto").MessageV2(f_int32 = 0), "f_int32")`,
+			want: true,
+		},
+		{
+			name: "proto2 field unset",
+			src:  `proto.has(proto.package("skycfg.test_proto").MessageV2(f_int64 = 1), "f_int32")`,
+			want: false,
+		},
+		{
+			name: "proto3 field set to default",
+			src:  `proto.has(proto.package("skycfg.test_proto").MessageV3(f_int32 = 0), "f_int32")`,
+			want: false,
+		},
+		{
+			name: "proto3 field set",
+			src:  `proto.has(proto.package("skycfg.test_proto").MessageV3(f_int32 = 1), "f_int32")`,
+			want: true,
+		},
+		{
+			name: "proto3 optional field set to default",
+			src:  `proto.has(proto.package("skycfg.test_proto").MessageV3(f_optional_int32 = 0), "f_optional_int32")`,
+			want: true,
+		},
+		{
+			name: "proto3 message field",
+			src:  `proto.has(proto.package("skycfg.test_proto").MessageV3(f_submsg = proto.package("skycfg.test_proto").MessageV3()), "f_submsg")`,
+			want: true,
+		},
+		{
+			name: "repeated field accessed but empty",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto").MessageV2()
+	msg.r_string
+	return proto.has(msg, "r_string")
+`,
+			want: false,
+		},
+		{
+			name: "map field",
+			src:  `proto.has(proto.package("skycfg.test_proto").MessageV3(map_string = {"a": "b"}), "map_string")`,
+			want: true,
+		},
+		{
+			name: "extension",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2()
+	msg[pb.f_ext_string] = ""
+	return proto.has(msg, pb.f_ext_string) and not proto.has(msg, pb.r_ext_int32)
+`,
+			want: true,
+		},
+		{
+			name:    "unknown field",
+			src:     `proto.has(proto.package("skycfg.test_proto").MessageV3(), "no_field")`,
+			wantErr: fmt.Errorf(`proto.has: skycfg.test_proto.MessageV3 has no field "no_field"`),
+		},
+		{
+			name:    "invalid field argument",
+			src:     `proto.has(proto.package("skycfg.test_proto").MessageV3(), 1)`,
+			wantErr: fmt.Errorf(`proto.has: for parameter 2: got int, want string or proto.Extension`),
+		},
+		{
+			name: "which_oneof",
+			src:  `proto.which_oneof(proto.package("skycfg.test_proto").MessageV3(f_oneof_b = ""), "f_oneof")`,
+			want: `"f_oneof_b"`,
+		},
+		{
+			name: "which_oneof unset",
+			src:  `proto.which_oneof(proto.package("skycfg.test_proto").MessageV3(), "f_oneof")`,
+			want: `None`,
+		},
+		{
+			name: "which_oneof proto3 optional",
+			src:  `proto.which_oneof(proto.package("skycfg.test_proto").MessageV3(f_optional_int32 = 0), "_f_optional_int32")`,
+			want: `"f_optional_int32"`,
+		},
+		{
+			name:    "which_oneof unknown oneof",
+			src:     `proto.which_oneof(proto.package("skycfg.test_proto").MessageV3(), "f_string")`,
+			wantErr: fmt.Errorf(`proto.which_oneof: skycfg.test_proto.MessageV3 has no oneof "f_string"`),
+		},
+		{
+			name: "clear_field",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV2(f_int32 = 1, f_string = "a")
+	msg[pb.f_ext_string] = "b"
+	proto.clear_field(msg, "f_int32")
+	proto.clear_field(msg, pb.f_ext_string)
+	return msg
+`,
+			want: &pb.MessageV2{FString: proto.String("a")},
+		},
+		{
+			name: "clear_field frozen",
+			srcFunc: `
+frozen = proto.package("skycfg.test_proto").MessageV2(f_int32 = 1)
+
+def fun():
+	proto.clear_field(frozen, "f_int32")
+`,
+			wantErr: fmt.Errorf(`proto.clear_field: cannot clear field of frozen message`),
+		},
+		{
+			name: "set_fields",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto").MessageV3(
+		r_string = ["a"],
+		f_string = "",
+		f_int32 = 1,
+		f_oneof_a = "",
+		f_optional_int32 = 0,
+	)
+	msg.r_submsg
+	return proto.set_fields(msg)
+`,
+			want: `["f_int32", "r_string", "f_oneof_a", "f_optional_int32"]`,
+		},
+	})
+}
+
+func TestProtoMergeOptions(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "replace_repeated",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	dst = pb.MessageV3(r_string = ["a", "b"], f_submsg = pb.MessageV3(r_string = ["c"]))
+	src = pb.MessageV3(r_string = ["x"], f_submsg = pb.MessageV3(r_string = ["y"]))
+	return proto.merge(dst, src, replace_repeated = True)
+`,
+			want: &pb.MessageV3{
+				RString: []string{"x"},
+				FSubmsg: &pb.MessageV3{RString: []string{"y"}},
+			},
+		},
+		{
+			name: "merge_key",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	dst = pb.MessageV3(r_submsg = [
+		pb.MessageV3(f_string = "app", f_int32 = 1, r_string = ["a"]),
+		pb.MessageV3(f_string = "sidecar", f_int32 = 2),
+		pb.MessageV3(f_int32 = 3),
+	])
+	src = pb.MessageV3(r_submsg = [
+		pb.MessageV3(f_string = "app", f_int64 = 10, r_string = ["b"]),
+		pb.MessageV3(f_string = "init"),
+	])
+	return proto.merge(dst, src, merge_key = {"r_submsg": "f_string"})
+`,
+			want: &pb.MessageV3{
+				RSubmsg: []*pb.MessageV3{
+					{FString: "app", FInt32: 1, FInt64: 10, RString: []string{"a", "b"}},
+					{FString: "sidecar", FInt32: 2},
+					{FInt32: 3},
+					{FString: "init"},
+				},
+			},
+		},
+		{
+			name: "merge_key by full name",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	dst = pb.MessageV3(r_submsg = [pb.MessageV3(f_string = "app", f_int32 = 1)])
+	src = pb.MessageV3(r_submsg = [pb.MessageV3(f_string = "app", f_int32 = 2)])
+	return proto.merge(dst, src, merge_key = {"skycfg.test_proto.MessageV3.r_submsg": "f_string"})
+`,
+			want: &pb.MessageV3{
+				RSubmsg: []*pb.MessageV3{{FString: "app", FInt32: 2}},
+			},
+		},
+		{
+			name: "merge_key by full name of ambiguous field",
+			srcFunc: `
+def fun():
+	pb = proto.package("google.protobuf")
+	dst = pb.FileDescriptorProto(extension = [pb.FieldDescriptorProto(name = "a", number = 1)])
+	src = pb.FileDescriptorProto(extension = [pb.FieldDescriptorProto(name = "a", json_name = "A")])
+	return proto.merge(dst, src, merge_key = {"google.protobuf.FileDescriptorProto.extension": "name"})
+`,
+			want: &descriptorpb.FileDescriptorProto{
+				Extension: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("a"), Number: proto.Int32(1), JsonName: proto.String("A")},
+				},
+			},
+		},
+		{
+			name: "delete",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	dst = pb.MessageV3(
+		f_string = "deleted",
+		f_submsg = pb.MessageV3(f_int32 = 1, f_int64 = 2),
+		r_string = ["a", "b", "c"],
+		r_submsg = [pb.MessageV3(f_string = "app"), pb.MessageV3(f_string = "sidecar")],
+		map_string = {"k": "v", "l": "w"},
+	)
+	return proto.merge(dst, pb.MessageV3(f_int32 = 5),
+		merge_key = {"r_submsg": "f_string"},
+		delete = ["f_string", "f_submsg.f_int64", "r_string[1]", 'r_submsg["sidecar"]', 'map_string["k"]', "f_bool", "r_string[7]"],
+	)
+`,
+			want: &pb.MessageV3{
+				FInt32:    5,
+				FSubmsg:   &pb.MessageV3{FInt32: 1},
+				RString:   []string{"a", "c"},
+				RSubmsg:   []*pb.MessageV3{{FString: "app"}},
+				MapString: map[string]string{"l": "w"},
+			},
+		},
+		{
+			name:    "merge_key unknown field",
+			src:     `proto.merge(proto.package("skycfg.test_proto").MessageV3(), proto.package("skycfg.test_proto").MessageV3(), merge_key = {"r_string": "f_string"})`,
+			wantErr: fmt.Errorf(`proto.merge: merge_key: skycfg.test_proto.MessageV3 has no repeated message field "r_string"`),
+		},
+		{
+			name:    "merge_key ambiguous field",
+			src:     `proto.merge(proto.package("google.protobuf").FileDescriptorProto(), proto.package("google.protobuf").FileDescriptorProto(), merge_key = {"extension": "name"})`,
+			wantErr: fmt.Errorf(`proto.merge: merge_key: field name "extension" is ambiguous in google.protobuf.FileDescriptorProto, use one of google.protobuf.DescriptorProto.extension, google.protobuf.FileDescriptorProto.extension`),
+		},
+		{
+			name:    "merge_key unknown key",
+			src:     `proto.merge(proto.package("skycfg.test_proto").MessageV3(), proto.package("skycfg.test_proto").MessageV3(), merge_key = {"r_submsg": "name"})`,
+			wantErr: fmt.Errorf(`proto.merge: merge_key: skycfg.test_proto.MessageV3 has no singular field "name"`),
+		},
+		{
+			name: "delete from frozen message",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+frozen = pb.MessageV3(f_string = "a")
+
+def fun():
+	return proto.merge(frozen, pb.MessageV3(), delete = ["f_string"])
+`,
+			wantErr: fmt.Errorf(`cannot merge frozen message`),
+		},
+	})
+}
+
 // Pre 1.0 Skycfg allowed maps to be constructed with None values for proto2 (see protoMap.SetKey)
 func TestMapNoneCompatibility(t *testing.T) {
 	runSkycfgTests(t, []skycfgTest{
@@ -1099,3 +1919,343 @@ func TestUnsetProto2Fields(t *testing.T) {
 		},
 	})
 }
+
+// Mirrors the representation of durations in the Starlark "time" library.
+type starlarkDuration time.Duration
+
+func (d starlarkDuration) String() string        { return time.Duration(d).String() }
+func (d starlarkDuration) Type() string          { return "time.duration" }
+func (d starlarkDuration) Freeze()               {}
+func (d starlarkDuration) Truth() starlark.Bool  { return d != 0 }
+func (d starlarkDuration) Hash() (uint32, error) { return uint32(d), nil }
+
+func TestMessageTimeConversions(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "duration and timestamp strings",
+			src: `proto.package("skycfg.test_proto").MessageV3(
+				f_Duration = "1h30m0.5s",
+				f_Timestamp = "2021-02-03T04:05:06.7+01:00",
+				r_Duration = ["30s", "-1ms"],
+			)`,
+			want: &pb.MessageV3{
+				F_Duration:  &durationpb.Duration{Seconds: 5400, Nanos: 500000000},
+				F_Timestamp: &timestamppb.Timestamp{Seconds: 1612321506, Nanos: 700000000},
+				R_Duration: []*durationpb.Duration{
+					{Seconds: 30},
+					{Nanos: -1000000},
+				},
+			},
+		},
+		{
+			name: "starlark time.duration",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_Duration = timeout)`,
+			globals: starlark.StringDict{
+				"proto":   NewModule(newRegistry()),
+				"timeout": starlarkDuration(90 * time.Second),
+			},
+			want: &pb.MessageV3{
+				F_Duration: &durationpb.Duration{Seconds: 90},
+			},
+		},
+		{
+			name: "append and set index",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto").MessageV3()
+	msg.r_Duration.append("1s")
+	msg.r_Duration.extend(["2s", "3s"])
+	msg.r_Duration[1] = "1m"
+	return msg
+`,
+			want: &pb.MessageV3{
+				R_Duration: []*durationpb.Duration{
+					{Seconds: 1},
+					{Seconds: 60},
+					{Seconds: 3},
+				},
+			},
+		},
+		{
+			name: "duration accessors",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_Duration = "1h30m0.5s").f_Duration.duration_string`,
+			want: `"1h30m0.5s"`,
+		},
+		{
+			name: "duration total seconds",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_Duration = "-1.25s").f_Duration.total_seconds`,
+			want: `-1.25`,
+		},
+		{
+			name: "timestamp accessor",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_Timestamp = "2021-02-03T04:05:06.7+01:00").f_Timestamp.rfc3339`,
+			want: `"2021-02-03T03:05:06.7Z"`,
+		},
+		{
+			name:    "invalid duration",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Duration = "30 seconds")`,
+			wantErr: fmt.Errorf("ValueError: value \"30 seconds\" is not a valid `google.protobuf.Duration': expected a duration such as \"1h30m\"."),
+		},
+		{
+			name:    "invalid duration unit",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Duration = "5minutes")`,
+			wantErr: fmt.Errorf("ValueError: value \"5minutes\" is not a valid `google.protobuf.Duration': expected a duration such as \"1h30m\"."),
+		},
+		{
+			name: "duration longer than time.Duration",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_Duration = "-3000000h0.25s")`,
+			want: &pb.MessageV3{
+				F_Duration: &durationpb.Duration{Seconds: -10800000000, Nanos: -250000000},
+			},
+		},
+		{
+			name: "duration string longer than time.Duration",
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_Duration = "3000000h1m2.5s").f_Duration.duration_string`,
+			want: `"3000000h1m2.5s"`,
+		},
+		{
+			name:    "duration overflow",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Duration = "87660000h1s")`,
+			wantErr: fmt.Errorf("ValueError: value \"87660000h1s\" overflows type `google.protobuf.Duration'."),
+		},
+		{
+			name:    "invalid timestamp",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Timestamp = "2021-02-03")`,
+			wantErr: fmt.Errorf("ValueError: value \"2021-02-03\" is not a valid `google.protobuf.Timestamp': expected an RFC 3339 timestamp such as \"2006-01-02T15:04:05Z\"."),
+		},
+		{
+			name:    "timestamp overflow",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Timestamp = "0000-12-31T23:59:59Z")`,
+			wantErr: fmt.Errorf("ValueError: value \"0000-12-31T23:59:59Z\" overflows type `google.protobuf.Timestamp'."),
+		},
+		{
+			name:    "wrong type",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Duration = 30)`,
+			wantErr: fmt.Errorf(`TypeError: value 30 (type "int") can't be assigned to type "google.protobuf.Duration".`),
+		},
+	})
+}
+
+func TestMessageStructConversions(t *testing.T) {
+	mustStruct := func(v map[string]interface{}) *structpb.Struct {
+		s, err := structpb.NewStruct(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "struct from dict",
+			src: `proto.package("skycfg.test_proto").MessageV3(
+				f_Struct = {
+					"name": "envoy.filters.http.router",
+					"port": 8080,
+					"ratio": 0.5,
+					"enabled": True,
+					"tags": ["a", ("b",)],
+					"nested": {"unset": None},
+				},
+			)`,
+			want: &pb.MessageV3{
+				F_Struct: mustStruct(map[string]interface{}{
+					"name":    "envoy.filters.http.router",
+					"port":    8080,
+					"ratio":   0.5,
+					"enabled": true,
+					"tags":    []interface{}{"a", []interface{}{"b"}},
+					"nested":  map[string]interface{}{"unset": nil},
+				}),
+			},
+		},
+		{
+			name: "value and list value",
+			src: `proto.package("skycfg.test_proto").MessageV3(
+				f_Value = "hello",
+				f_ListValue = [1, None],
+			)`,
+			want: &pb.MessageV3{
+				F_Value: structpb.NewStringValue("hello"),
+				F_ListValue: &structpb.ListValue{Values: []*structpb.Value{
+					structpb.NewNumberValue(1),
+					structpb.NewNullValue(),
+				}},
+			},
+		},
+		{
+			name: "explicit messages are still accepted",
+			src: `proto.package("skycfg.test_proto").MessageV3(
+				f_Value = proto.package("google.protobuf").Value(bool_value = True),
+			)`,
+			globals: starlark.StringDict{
+				"proto": NewModule(protoregistry.GlobalTypes),
+			},
+			want: &pb.MessageV3{
+				F_Value: structpb.NewBoolValue(true),
+			},
+		},
+		{
+			name: "mutate struct in place",
+			srcFunc: `
+def fun():
+    msg = proto.package("skycfg.test_proto").MessageV3(f_Struct = {})
+    msg.f_Struct["key"] = {"list": [1]}
+    msg.f_Struct["key"]["list"].append(2.5)
+    return msg
+`,
+			want: &pb.MessageV3{
+				F_Struct: mustStruct(map[string]interface{}{
+					"key": map[string]interface{}{"list": []interface{}{1, 2.5}},
+				}),
+			},
+		},
+		{
+			name: "read back as messages by default",
+			src:  `proto.decode_json(proto.package("skycfg.test_proto").MessageV3, '{"f_Struct": {"a": true}}').f_Struct.fields["a"].bool_value`,
+			want: `True`,
+		},
+		{
+			name:    "non-string key",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Struct = {1: "a"})`,
+			wantErr: fmt.Errorf(`TypeError: key 1 (type "int") can't be assigned to type "google.protobuf.Struct": keys must be strings.`),
+		},
+		{
+			name:    "struct from non-dict",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Struct = "a")`,
+			wantErr: fmt.Errorf(`TypeError: value "a" (type "string") can't be assigned to type "google.protobuf.Struct".`),
+		},
+		{
+			name:    "inexact number",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_Value = 9007199254740993)`,
+			wantErr: fmt.Errorf("ValueError: value 9007199254740993 is not exactly representable as type `google.protobuf.Value'."),
+		},
+		{
+			name:    "unsupported value",
+			src:     `proto.package("skycfg.test_proto").MessageV3(f_ListValue = [proto.package("skycfg.test_proto").MessageV3()])`,
+			wantErr: fmt.Errorf(`TypeError: value <skycfg.test_proto.MessageV3 > (type "skycfg.test_proto.MessageV3") can't be assigned to type "google.protobuf.Value".`),
+		},
+	})
+
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "read back as starlark values",
+			src:  `proto.decode_json(proto.package("skycfg.test_proto").MessageV3, '{"f_Struct": {"b": [1, 1.5, null], "a": true}}').f_Struct`,
+			want: `{"a": True, "b": [1, 1.5, None]}`,
+		},
+		{
+			name: "read back nested values",
+			src:  `proto.decode_json(proto.package("skycfg.test_proto").MessageV3, '{"r_submsg": [{"f_Value": "x"}]}').r_submsg[0].f_Value`,
+			want: `"x"`,
+		},
+	}, withGlobals(starlark.StringDict{
+		"proto": NewModule(newRegistry(), WithStructValues()),
+	}))
+}
+
+const benchmarkSrc = `
+pb = proto.package("skycfg.test_proto")
+
+def build(n):
+	items = []
+	for i in range(n):
+		items.append(pb.MessageV3(
+			f_int32 = i,
+			f_string = "item-%d" % i,
+			f_submsg = pb.MessageV3(f_int64 = i, r_string = ["a", "b", "c"]),
+			r_submsg = [pb.MessageV3(f_int32 = j, map_string = {"k": "v"}) for j in range(5)],
+			map_submsg = {"a": pb.MessageV3(f_bool = True)},
+		))
+	return pb.MessageV3(r_submsg = items)
+`
+
+// benchmarkBuild returns a function that constructs a message with n
+// nested messages, each of which has a few nested messages of its own.
+func benchmarkBuild(b *testing.B) func(n int) *protoMessage {
+	b.Helper()
+	thread := &starlark.Thread{}
+	globals, err := starlark.ExecFile(thread, "bench.sky", benchmarkSrc, starlark.StringDict{
+		"proto": NewModule(newRegistry()),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return func(n int) *protoMessage {
+		val, err := starlark.Call(thread, globals["build"], starlark.Tuple{starlark.MakeInt(n)}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return val.(*protoMessage)
+	}
+}
+
+func BenchmarkConstructMessage(b *testing.B) {
+	build := benchmarkBuild(b)
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		build(1000)
+	}
+}
+
+func BenchmarkMergeMessage(b *testing.B) {
+	build := benchmarkBuild(b)
+	msg := build(1000)
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		b.StopTimer()
+		dst := build(1000)
+		b.StartTimer()
+		if err := dst.Merge(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExportMessage(b *testing.B) {
+	msg := benchmarkBuild(b)(1000)
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		AsProtoMessage(msg)
+	}
+}
+
+func BenchmarkExportFrozenMessage(b *testing.B) {
+	msg := benchmarkBuild(b)(1000)
+	msg.Freeze()
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		AsProtoMessage(msg)
+	}
+}
+
+func BenchmarkImportMessage(b *testing.B) {
+	msg := benchmarkBuild(b)(1000).toProtoMessage()
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		if _, err := NewMessage(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkImportMessageField(b *testing.B) {
+	msg := benchmarkBuild(b)(1000).toProtoMessage()
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		val, err := NewMessage(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := val.Attr("r_submsg"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMessageString(b *testing.B) {
+	msg := benchmarkBuild(b)(100)
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		_ = msg.String()
+	}
+}
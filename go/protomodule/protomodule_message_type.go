@@ -28,13 +28,14 @@ import (
 )
 
 // newMessageType creates a Starlark value representing a named Protobuf message
-// type that can be used for constructing new concrete protobuf objects.
-func newMessageType(registry *protoregistry.Types, msg protoreflect.ProtoMessage) starlark.Callable {
+// type that can be used for constructing new concrete protobuf objects. The
+// options also apply to nested types.
+func newMessageType(registry *protoregistry.Types, msg protoreflect.ProtoMessage, opts messageTypeOptions) starlark.Callable {
 	attrs := make(starlark.StringDict)
 
 	descriptor := msg.ProtoReflect().Type().Descriptor()
 
-	// Register child messages, enums as attrs
+	// Register child messages, enums, extensions as attrs
 	for ii := 0; ii < descriptor.Enums().Len(); ii++ {
 		child := descriptor.Enums().Get(ii)
 		attrs[string(child.Name())] = newEnumType(child)
@@ -42,17 +43,18 @@ func newMessageType(registry *protoregistry.Types, msg protoreflect.ProtoMessage
 	for ii := 0; ii < descriptor.Messages().Len(); ii++ {
 		child := descriptor.Messages().Get(ii)
 		if !child.IsMapEntry() {
-			childMsg, err := registry.FindMessageByName(child.FullName())
-			if err != nil {
-				// Fallback to dynamicpb if nested message is
-				// unavailable in registry. This points to the
-				// registry having been incompletely
-				// constructed, missing nested types
-				childMsg = dynamicpb.NewMessageType(child)
-			}
+			childMsg := findMessageType(registry, child)
+			attrs[string(child.Name())] = newMessageType(registry, childMsg.New().Interface(), opts)
+		}
+	}
 
-			attrs[string(child.Name())] = newMessageType(registry, childMsg.New().Interface())
+	for ii := 0; ii < descriptor.Extensions().Len(); ii++ {
+		child := descriptor.Extensions().Get(ii)
+		extType, err := registry.FindExtensionByName(child.FullName())
+		if err != nil {
+			extType = dynamicpb.NewExtensionType(child)
 		}
+		attrs[string(child.Name())] = newExtension(extType)
 	}
 
 	emptyMsg := proto.Clone(msg)
@@ -62,15 +64,30 @@ func newMessageType(registry *protoregistry.Types, msg protoreflect.ProtoMessage
 		descriptor: descriptor,
 		attrs:      attrs,
 		emptyMsg:   emptyMsg,
+		opts:       opts,
 	}
 }
 
+// findMessageType returns the registered type of a message descriptor.
+func findMessageType(registry *protoregistry.Types, desc protoreflect.MessageDescriptor) protoreflect.MessageType {
+	msgType, err := registry.FindMessageByName(desc.FullName())
+	if err != nil {
+		// Fallback to dynamicpb if the message is unavailable in
+		// registry. This points to the registry having been
+		// incompletely constructed, missing nested types
+		return dynamicpb.NewMessageType(desc)
+	}
+	return msgType
+}
+
 type protoMessageType struct {
 	descriptor protoreflect.MessageDescriptor
 	attrs      starlark.StringDict
 
 	// An empty protobuf message of the appropriate type.
 	emptyMsg protoreflect.ProtoMessage
+
+	opts messageTypeOptions
 }
 
 var _ starlark.HasAttrs = (*protoMessageType)(nil)
@@ -120,43 +137,65 @@ func (t *protoMessageType) CallInternal(
 		return nil, err
 	}
 
-	// Parse the kwarg set into a map[string]starlark.Value, containing one
-	// entry for each provided kwarg. Keys are the original protobuf field names.
-	// This lets the starlark kwarg parser handle most of the error reporting,
-	// except type errors which are deferred until later.
-	var parserPairs []interface{}
-	parsedKwargs := make(map[string]*starlark.Value, len(kwargs))
-
-	fields := t.descriptor.Fields()
-	for ii := 0; ii < fields.Len(); ii++ {
-		fieldName := string(fields.Get(ii).Name())
-		v := new(starlark.Value)
-		parsedKwargs[fieldName] = v
-		parserPairs = append(parserPairs, fieldName+"?", v)
-	}
-
-	if err := starlark.UnpackArgs(t.Name(), nil, kwargs, parserPairs...); err != nil {
-		return nil, err
+	// Keys of kwargs are the original protobuf field names. If any are
+	// unknown or repeated, let the starlark kwarg parser report the error.
+	// Type errors are reported as the fields are set.
+	if !t.validKwargs(kwargs) {
+		return nil, t.kwargsError(kwargs)
 	}
 
-	// Instantiate a new message and populate the fields
-	out, err := NewMessage(t.emptyMsg)
+	// Instantiate a new message with any registered defaults, and populate
+	// the fields
+	out, err := t.opts.defaults.newMessage(thread, t.emptyMsg)
 	if err != nil {
 		return nil, err
 	}
-	for fieldName, starlarkValue := range parsedKwargs {
-		if *starlarkValue == nil {
-			continue
-		}
-
-		if err := out.SetField(fieldName, *starlarkValue); err != nil {
+	out.thread = thread
+	out.pos = callerPosition(thread)
+	out.conv = t.opts.conv
+	for _, kwarg := range kwargs {
+		fieldName := string(kwarg[0].(starlark.String))
+		if err := out.SetField(fieldName, kwarg[1]); err != nil {
 			return nil, err
 		}
 	}
 
+	if t.opts.frozen {
+		out.Freeze()
+	}
 	return out, nil
 }
 
+// validKwargs reports whether kwargs are distinct field names of t.
+func (t *protoMessageType) validKwargs(kwargs []starlark.Tuple) bool {
+	for ii, kwarg := range kwargs {
+		name, ok := kwarg[0].(starlark.String)
+		if !ok || t.descriptor.Fields().ByName(protoreflect.Name(name)) == nil {
+			return false
+		}
+		for _, prev := range kwargs[:ii] {
+			if prev[0] == name {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// kwargsError returns the error reported by the starlark kwarg parser for
+// kwargs that aren't valid field names.
+func (t *protoMessageType) kwargsError(kwargs []starlark.Tuple) error {
+	var parserPairs []interface{}
+	fields := t.descriptor.Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		parserPairs = append(parserPairs, string(fields.Get(ii).Name())+"?", new(starlark.Value))
+	}
+	if err := starlark.UnpackArgs(t.Name(), nil, kwargs, parserPairs...); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: invalid keyword arguments", t.Name())
+}
+
 func (t *protoMessageType) NewMessage() protoreflect.ProtoMessage {
 	return proto.Clone(t.emptyMsg)
 }
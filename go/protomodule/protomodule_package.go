@@ -25,7 +25,9 @@ import (
 	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
-func starlarkPackageFn(registry *protoregistry.Types) starlark.Callable {
+// starlarkPackageFn returns the proto.package builtin. Its frozen argument
+// overrides the frozen option of opts.
+func starlarkPackageFn(registry *protoregistry.Types, opts messageTypeOptions) starlark.Callable {
 	return starlark.NewBuiltin("proto.package", func(
 		t *starlark.Thread,
 		fn *starlark.Builtin,
@@ -33,14 +35,16 @@ func starlarkPackageFn(registry *protoregistry.Types) starlark.Callable {
 		kwargs []starlark.Tuple,
 	) (starlark.Value, error) {
 		var rawPackageName string
-		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &rawPackageName); err != nil {
+		var frozen bool
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &rawPackageName, "frozen?", &frozen); err != nil {
 			return nil, err
 		}
 		packageName := protoreflect.FullName(rawPackageName)
 		if !packageName.IsValid() {
 			return nil, fmt.Errorf("invalid Protobuf package name %q", packageName)
 		}
-		return NewProtoPackage(registry, packageName), nil
+		opts.frozen = frozen
+		return newProtoPackage(registry, packageName, opts), nil
 	})
 }
 
@@ -53,6 +57,16 @@ type protoPackage struct {
 func NewProtoPackage(
 	registry *protoregistry.Types,
 	packageName protoreflect.FullName,
+) *protoPackage {
+	return newProtoPackage(registry, packageName, messageTypeOptions{})
+}
+
+// newProtoPackage is like NewProtoPackage, with options for the messages
+// constructed by the package's message types.
+func newProtoPackage(
+	registry *protoregistry.Types,
+	packageName protoreflect.FullName,
+	opts messageTypeOptions,
 ) *protoPackage {
 	attrs := make(starlark.StringDict)
 
@@ -69,12 +83,21 @@ func NewProtoPackage(
 		desc := t.Descriptor()
 		name := desc.Name()
 		if packageName.Append(name) == desc.FullName() {
-			msgType := newMessageType(registry, t.New().Interface())
+			msgType := newMessageType(registry, t.New().Interface(), opts)
 			attrs[string(name)] = msgType
 		}
 		return true
 	})
 
+	registry.RangeExtensions(func(t protoreflect.ExtensionType) bool {
+		desc := t.TypeDescriptor()
+		name := desc.Name()
+		if packageName.Append(name) == desc.FullName() {
+			attrs[string(name)] = newExtension(t)
+		}
+		return true
+	})
+
 	return &protoPackage{
 		name:     packageName,
 		registry: registry,
@@ -0,0 +1,195 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	structType    = (&structpb.Struct{}).ProtoReflect().Descriptor().FullName()
+	valueType     = (&structpb.Value{}).ProtoReflect().Descriptor().FullName()
+	listValueType = (&structpb.ListValue{}).ProtoReflect().Descriptor().FullName()
+)
+
+// Largest integer that a JSON number can represent exactly.
+const maxExactFloatInt = 1 << 53
+
+// isStructType reports whether msgDesc is one of the JSON-like well-known
+// types that convert to and from plain Starlark values.
+func isStructType(msgDesc protoreflect.MessageDescriptor) bool {
+	switch msgDesc.FullName() {
+	case structType, valueType, listValueType:
+		return true
+	}
+	return false
+}
+
+// structFromStarlark converts a JSON-like Starlark value into a message of
+// type google.protobuf.Struct, Value, or ListValue.
+func structFromStarlark(fieldDesc protoreflect.FieldDescriptor, val starlark.Value) (protoreflect.Value, error) {
+	value, err := jsonValueFromStarlark(val)
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+
+	switch fieldDesc.Message().FullName() {
+	case structType:
+		if s := value.GetStructValue(); s != nil {
+			return protoreflect.ValueOf(s.ProtoReflect()), nil
+		}
+		return protoreflect.Value{}, typeError(fieldDesc, val, true)
+	case listValueType:
+		if l := value.GetListValue(); l != nil {
+			return protoreflect.ValueOf(l.ProtoReflect()), nil
+		}
+		return protoreflect.Value{}, typeError(fieldDesc, val, true)
+	}
+	return protoreflect.ValueOf(value.ProtoReflect()), nil
+}
+
+func jsonValueFromStarlark(val starlark.Value) (*structpb.Value, error) {
+	switch val := val.(type) {
+	case starlark.NoneType:
+		return structpb.NewNullValue(), nil
+	case starlark.Bool:
+		return structpb.NewBoolValue(bool(val)), nil
+	case starlark.Int:
+		i, ok := val.Int64()
+		if !ok || i > maxExactFloatInt || i < -maxExactFloatInt {
+			return nil, fmt.Errorf("ValueError: value %v is not exactly representable as type `%s'.", val, valueType)
+		}
+		return structpb.NewNumberValue(float64(i)), nil
+	case starlark.Float:
+		f := float64(val)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("ValueError: value %v is not exactly representable as type `%s'.", val, valueType)
+		}
+		return structpb.NewNumberValue(f), nil
+	case starlark.String:
+		return structpb.NewStringValue(string(val)), nil
+	case starlark.IterableMapping:
+		fields := make(map[string]*structpb.Value)
+		for _, item := range val.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("TypeError: key %s (type %q) can't be assigned to type %q: keys must be strings.", item[0].String(), item[0].Type(), structType)
+			}
+			fieldValue, err := jsonValueFromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			fields[string(key)] = fieldValue
+		}
+		return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+	case *protoMessage:
+		if !isStructType(val.msgDesc) {
+			break
+		}
+		return jsonValueFromMessage(val.toProtoMessage().ProtoReflect()), nil
+	case starlark.Indexable:
+		// Lists, tuples, and repeated fields.
+		values := make([]*structpb.Value, val.Len())
+		for ii := range values {
+			elem, err := jsonValueFromStarlark(val.Index(ii))
+			if err != nil {
+				return nil, err
+			}
+			values[ii] = elem
+		}
+		return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+	}
+	return nil, fmt.Errorf("TypeError: value %s (type %q) can't be assigned to type %q.", val.String(), val.Type(), valueType)
+}
+
+// jsonValueFromMessage wraps a Struct, Value, or ListValue message in a
+// structpb.Value. Messages of other implementations, such as dynamicpb, are
+// copied into the generated types.
+func jsonValueFromMessage(msg protoreflect.Message) *structpb.Value {
+	switch m := msg.Interface().(type) {
+	case *structpb.Value:
+		return m
+	case *structpb.Struct:
+		return structpb.NewStructValue(m)
+	case *structpb.ListValue:
+		return structpb.NewListValue(m)
+	}
+
+	var dst proto.Message
+	switch msg.Descriptor().FullName() {
+	case structType:
+		dst = &structpb.Struct{}
+	case listValueType:
+		dst = &structpb.ListValue{}
+	default:
+		dst = &structpb.Value{}
+	}
+	// Both messages have the same descriptor, so this can't fail.
+	b, _ := proto.Marshal(msg.Interface())
+	_ = proto.Unmarshal(b, dst)
+	return jsonValueFromMessage(dst.ProtoReflect())
+}
+
+// structToStarlark converts a message of type google.protobuf.Struct, Value,
+// or ListValue into the equivalent dict, list, or scalar Starlark value.
+func structToStarlark(msg protoreflect.Message) starlark.Value {
+	return jsonValueToStarlark(jsonValueFromMessage(msg))
+}
+
+func jsonValueToStarlark(value *structpb.Value) starlark.Value {
+	switch kind := value.GetKind().(type) {
+	case *structpb.Value_BoolValue:
+		return starlark.Bool(kind.BoolValue)
+	case *structpb.Value_NumberValue:
+		// JSON doesn't distinguish integers from floats, so return integral
+		// numbers as Starlark ints for readability.
+		f := kind.NumberValue
+		if f == math.Trunc(f) && f <= maxExactFloatInt && f >= -maxExactFloatInt {
+			return starlark.MakeInt64(int64(f))
+		}
+		return starlark.Float(f)
+	case *structpb.Value_StringValue:
+		return starlark.String(kind.StringValue)
+	case *structpb.Value_StructValue:
+		fields := kind.StructValue.GetFields()
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := starlark.NewDict(len(keys))
+		for _, key := range keys {
+			out.SetKey(starlark.String(key), jsonValueToStarlark(fields[key]))
+		}
+		return out
+	case *structpb.Value_ListValue:
+		values := kind.ListValue.GetValues()
+		out := make([]starlark.Value, len(values))
+		for ii, elem := range values {
+			out[ii] = jsonValueToStarlark(elem)
+		}
+		return starlark.NewList(out)
+	}
+	return starlark.None
+}
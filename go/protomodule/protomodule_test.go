@@ -18,18 +18,24 @@ package protomodule
 
 import (
 	"errors"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/anypb"
 	any "google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
 	pb "github.com/stripe/skycfg/internal/testdata/test_proto"
 )
@@ -46,6 +52,13 @@ func newRegistry() *protoregistry.Types {
 	registry.RegisterMessage((&pb.MessageV3_NestedMessage{}).ProtoReflect().Type())
 	registry.RegisterEnum((pb.ToplevelEnumV2)(0).Type())
 	registry.RegisterEnum((pb.ToplevelEnumV3)(0).Type())
+	registry.RegisterExtension(pb.E_FExtString)
+	registry.RegisterExtension(pb.E_RExtInt32)
+	registry.RegisterExtension(pb.E_FExtSubmsg)
+	registry.RegisterExtension(pb.E_MessageV2_FExtNested)
+	// Descriptors have fields of different message types with the same name.
+	registry.RegisterMessage((&descriptorpb.FileDescriptorProto{}).ProtoReflect().Type())
+	registry.RegisterMessage((&descriptorpb.FieldDescriptorProto{}).ProtoReflect().Type())
 	return registry
 }
 
@@ -55,7 +68,7 @@ func TestProtoPackage(t *testing.T) {
 		"proto": &starlarkstruct.Module{
 			Name: "proto",
 			Members: starlark.StringDict{
-				"package": starlarkPackageFn(newRegistry()),
+				"package": starlarkPackageFn(newRegistry(), messageTypeOptions{}),
 			},
 		},
 	}
@@ -67,7 +80,7 @@ func TestProtoPackage(t *testing.T) {
 		},
 		{
 			src:  `dir(proto.package("skycfg.test_proto"))`,
-			want: `["MessageV2", "MessageV3", "ToplevelEnumV2", "ToplevelEnumV3"]`,
+			want: `["MessageV2", "MessageV3", "ToplevelEnumV2", "ToplevelEnumV3", "f_ext_string", "f_ext_submsg", "r_ext_int32"]`,
 		},
 		{
 			src:  `proto.package("skycfg.test_proto").MessageV2`,
@@ -96,7 +109,7 @@ func TestMessageType(t *testing.T) {
 		},
 		{
 			src:  `dir(pb.MessageV2)`,
-			want: `["NestedEnum", "NestedMessage"]`,
+			want: `["NestedEnum", "NestedMessage", "f_ext_nested"]`,
 		},
 		{
 			src:  `pb.MessageV2.NestedMessage`,
@@ -106,6 +119,10 @@ func TestMessageType(t *testing.T) {
 			src:  `pb.MessageV2.NestedEnum`,
 			want: `<proto.EnumType "skycfg.test_proto.MessageV2.NestedEnum">`,
 		},
+		{
+			src:  `pb.MessageV2.f_ext_nested`,
+			want: `<proto.Extension "skycfg.test_proto.MessageV2.f_ext_nested">`,
+		},
 		{
 			src:     `pb.MessageV2.NoExist`,
 			wantErr: errors.New(`Protobuf type "skycfg.test_proto.MessageV2.NoExist" not found`),
@@ -137,7 +154,43 @@ func TestEnumType(t *testing.T) {
 		},
 		{
 			src:     `pb.ToplevelEnumV2.NoExist`,
-			wantErr: errors.New(`proto.EnumType has no .NoExist field or method`),
+			wantErr: errors.New(`skycfg.test_proto.ToplevelEnumV2 has no value "NoExist" (valid values: TOPLEVEL_ENUM_V2_A=0, TOPLEVEL_ENUM_V2_B=1)`),
+		},
+		{
+			src:  `pb.ToplevelEnumV2("TOPLEVEL_ENUM_V2_B")`,
+			want: `<skycfg.test_proto.ToplevelEnumV2 TOPLEVEL_ENUM_V2_B=1>`,
+		},
+		{
+			src:  `pb.ToplevelEnumV2(1)`,
+			want: `<skycfg.test_proto.ToplevelEnumV2 TOPLEVEL_ENUM_V2_B=1>`,
+		},
+		{
+			src:  `pb.ToplevelEnumV2(pb.ToplevelEnumV2.TOPLEVEL_ENUM_V2_B) == pb.ToplevelEnumV2.TOPLEVEL_ENUM_V2_B`,
+			want: true,
+		},
+		{
+			src:     `pb.ToplevelEnumV2("NoExist")`,
+			wantErr: errors.New(`ValueError: skycfg.test_proto.ToplevelEnumV2 has no value "NoExist" (valid values: TOPLEVEL_ENUM_V2_A=0, TOPLEVEL_ENUM_V2_B=1)`),
+		},
+		{
+			src:     `pb.ToplevelEnumV2(7)`,
+			wantErr: errors.New(`ValueError: skycfg.test_proto.ToplevelEnumV2 has no value numbered 7 (valid values: TOPLEVEL_ENUM_V2_A=0, TOPLEVEL_ENUM_V2_B=1)`),
+		},
+		{
+			src:     `pb.ToplevelEnumV2(2*4294967296 + 1)`,
+			wantErr: errors.New(`ValueError: skycfg.test_proto.ToplevelEnumV2 has no value numbered 8589934593 (valid values: TOPLEVEL_ENUM_V2_A=0, TOPLEVEL_ENUM_V2_B=1)`),
+		},
+		{
+			src:     `pb.ToplevelEnumV2(pb.MessageV2.NestedEnum.NESTED_ENUM_B)`,
+			wantErr: errors.New(`TypeError: value <skycfg.test_proto.MessageV2.NestedEnum NESTED_ENUM_B=1> (type "skycfg.test_proto.MessageV2.NestedEnum") can't be converted to type "skycfg.test_proto.ToplevelEnumV2".`),
+		},
+		{
+			src:  `pb.ToplevelEnumV2.TOPLEVEL_ENUM_V2_B.name`,
+			want: `"TOPLEVEL_ENUM_V2_B"`,
+		},
+		{
+			src:  `pb.ToplevelEnumV2.TOPLEVEL_ENUM_V2_B.number`,
+			want: `1`,
 		},
 	}, withGlobals(globals))
 }
@@ -512,6 +565,15 @@ proto.encode_text(proto.package("skycfg.test_proto").MessageV3(
 			src:  `proto.decode_text(proto.package("skycfg.test_proto").MessageV3, "f_int32: 1010").f_int32`,
 			want: "1010",
 		},
+		{
+			name: "proto.decode_text discard_unknown",
+			src: `proto.decode_text(
+				proto.package("skycfg.test_proto").MessageV3,
+				"f_int32: 1010 f_unknown: 1",
+				discard_unknown = True,
+			).f_int32`,
+			want: "1010",
+		},
 	})
 }
 
@@ -542,11 +604,45 @@ func TestProtoJson(t *testing.T) {
 			wantType:          "string",
 			removeRandomSpace: true,
 		},
+		{
+			name: "proto.encode_json use_proto_names",
+			src: `proto.encode_json(proto.package("skycfg.test_proto").MessageV3(
+				f_string = "some string",
+			), use_proto_names=False)`,
+			want:     `"{\"fString\":\"some string\"}"`,
+			wantType: "string",
+		},
+		{
+			name: "proto.encode_json emit_unpopulated",
+			src: `proto.encode_json(
+				proto.package("skycfg.test_proto").MessageV3.NestedMessage(),
+				emit_unpopulated=True,
+			)`,
+			want:     `"{\"f_string\":\"\"}"`,
+			wantType: "string",
+		},
+		{
+			name: "proto.encode_json use_enum_numbers",
+			src: `proto.encode_json(proto.package("skycfg.test_proto").MessageV3(
+				f_toplevel_enum = proto.package("skycfg.test_proto").ToplevelEnumV3.TOPLEVEL_ENUM_V3_B,
+			), use_enum_numbers=True)`,
+			want:     `"{\"f_toplevel_enum\":1}"`,
+			wantType: "string",
+		},
 		{
 			name: "proto.decode_json",
 			src:  `proto.decode_json(proto.package("skycfg.test_proto").MessageV3, "{\"f_int32\": 1010}").f_int32`,
 			want: "1010",
 		},
+		{
+			name: "proto.decode_json discard_unknown",
+			src: `proto.decode_json(
+				proto.package("skycfg.test_proto").MessageV3,
+				"{\"f_int32\": 1010, \"f_unknown\": 1}",
+				discard_unknown = True,
+			).f_int32`,
+			want: "1010",
+		},
 		{
 			// This is a bit of a weird test. Protobuf's have complex behavior around whether a field is present.
 			// Reference: https://github.com/protocolbuffers/protobuf/blob/main/docs/field_presence.md
@@ -565,6 +661,692 @@ func TestProtoJson(t *testing.T) {
 	})
 }
 
+func TestProtoBinary(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "proto.encode_binary",
+			src: `proto.encode_binary(proto.package("skycfg.test_proto").MessageV3(
+				f_int32 = 1,
+				f_string = "a",
+			))`,
+			want:     `"\b\x01:\x01a"`,
+			wantType: "string",
+		},
+		{
+			name: "proto.encode_binary deterministic",
+			src: `proto.encode_binary(proto.package("skycfg.test_proto").MessageV3(
+				map_string = {"b": "2", "a": "1"},
+			), deterministic=True)`,
+			want:     `"b\x06\n\x01a\x12\x011b\x06\n\x01b\x12\x012"`,
+			wantType: "string",
+		},
+		{
+			name: "proto.decode_binary",
+			src: `proto.decode_binary(proto.package("skycfg.test_proto").MessageV3, proto.encode_binary(
+				proto.package("skycfg.test_proto").MessageV3(
+					f_string = "some string",
+					r_submsg = [proto.package("skycfg.test_proto").MessageV3(f_int64 = 5)],
+					map_string = {"a": "1"},
+				),
+			))`,
+			want: &pb.MessageV3{
+				FString:   "some string",
+				RSubmsg:   []*pb.MessageV3{{FInt64: 5}},
+				MapString: map[string]string{"a": "1"},
+			},
+		},
+		{
+			name: "proto.encode_binary into bytes field",
+			src: `proto.package("skycfg.test_proto").MessageV3(
+				f_bytes = proto.encode_binary(proto.package("skycfg.test_proto").MessageV3(f_int32 = 1)),
+			)`,
+			want: &pb.MessageV3{
+				FBytes: []byte{0x08, 0x01},
+			},
+		},
+		{
+			name:    "proto.decode_binary invalid data",
+			src:     `proto.decode_binary(proto.package("skycfg.test_proto").MessageV3, "\x08")`,
+			wantErr: errors.New("unexpected EOF"),
+		},
+		{
+			name:    "proto.decode_binary wrong type",
+			src:     `proto.decode_binary(proto.package("skycfg.test_proto").MessageV3(), "")`,
+			wantErr: errors.New("proto.decode_binary: for parameter 1: got skycfg.test_proto.MessageV3, want proto.MessageType"),
+		},
+	})
+}
+
+func TestProtoDescriptor(t *testing.T) {
+	registry := newRegistry()
+	registry.RegisterMessage((&pb.ValidatedMessage{}).ProtoReflect().Type())
+	registry.RegisterExtension(pb.E_Rule)
+	globals := starlark.StringDict{
+		"proto": NewModule(registry),
+	}
+
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "message fields",
+			src:  `[f.name for f in proto.descriptor(proto.package("skycfg.test_proto").ValidatedMessage).fields]`,
+			want: `["name", "replicas", "children", "by_name"]`,
+		},
+		{
+			name: "message of value",
+			src:  `proto.descriptor(proto.package("skycfg.test_proto").ValidatedMessage()).full_name`,
+			want: `"skycfg.test_proto.ValidatedMessage"`,
+		},
+		{
+			name: "field attributes",
+			srcFunc: `
+def fun():
+	f = proto.descriptor(proto.package("skycfg.test_proto").MessageV2).fields[6]
+	return [f.name, f.number, f.type, f.label, f.json_name, f.default, f.has_default, f.has_presence]
+`,
+			want: `["f_string", 7, "string", "optional", "fString", "default_str", True, True]`,
+		},
+		{
+			name: "required field",
+			src:  `proto.descriptor(proto.package("skycfg.test_proto").ValidatedMessage).fields[0].label`,
+			want: `"required"`,
+		},
+		{
+			name: "message and map fields",
+			srcFunc: `
+def fun():
+	fields = proto.descriptor(proto.package("skycfg.test_proto").ValidatedMessage).fields
+	return [fields[2].message_type, fields[2].label, fields[3].is_map, fields[3].map_key.type, fields[3].map_value.message_type]
+`,
+			want: `[<proto.MessageType "skycfg.test_proto.ValidatedMessage">, "repeated", True, "string", <proto.MessageType "skycfg.test_proto.ValidatedMessage">]`,
+		},
+		{
+			name: "oneofs",
+			srcFunc: `
+def fun():
+	desc = proto.descriptor(proto.package("skycfg.test_proto").MessageV3)
+	return [(o.name, o.fields) for o in desc.oneofs]
+`,
+			want: `[("f_oneof", ["f_oneof_a", "f_oneof_b"])]`,
+		},
+		{
+			name: "custom options",
+			srcFunc: `
+def fun():
+	fields = proto.descriptor(proto.package("skycfg.test_proto").ValidatedMessage).fields
+	rule = proto.package("skycfg.test_proto").rule
+	return [list(f.options[rule]) for f in fields]
+`,
+			want: `[["matches('^[a-z][a-z0-9-]*$', value)"], ["value >= 1", "value <= 10"], ["len(value) <= 2"], []]`,
+		},
+		{
+			name: "enum",
+			srcFunc: `
+def fun():
+	desc = proto.descriptor(proto.package("skycfg.test_proto").ToplevelEnumV3)
+	return [desc.full_name] + [(v.name, v.number) for v in desc.values]
+`,
+			want: `["skycfg.test_proto.ToplevelEnumV3", ("TOPLEVEL_ENUM_V3_A", 0), ("TOPLEVEL_ENUM_V3_B", 1)]`,
+		},
+		{
+			name: "extension",
+			srcFunc: `
+def fun():
+	desc = proto.descriptor(proto.package("skycfg.test_proto").r_ext_int32)
+	return [desc.full_name, desc.extendee, desc.label]
+`,
+			want: `["skycfg.test_proto.r_ext_int32", "skycfg.test_proto.MessageV2", "repeated"]`,
+		},
+		{
+			name:    "frozen",
+			src:     `proto.descriptor(proto.package("skycfg.test_proto").MessageV3).fields.append(1)`,
+			wantErr: errors.New("append: cannot append to frozen list"),
+		},
+		{
+			name:    "wrong type",
+			src:     `proto.descriptor(1)`,
+			wantErr: errors.New("proto.descriptor: for parameter 1: got int, want proto.MessageType, proto.EnumType, or proto.Extension"),
+		},
+	}, withGlobals(globals))
+}
+
+func TestRegisterDefaults(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "message defaults",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+proto.register_defaults(pb.MessageV3, pb.MessageV3(f_int32 = 1, r_string = ["a"]))
+
+def fun():
+	a = pb.MessageV3(f_int64 = 2)
+	a.r_string.append("b")
+	return [a, pb.MessageV3(f_int32 = 3)]
+`,
+			want:              `[<skycfg.test_proto.MessageV3 f_int32:1 f_int64:2 r_string:"a" r_string:"b">, <skycfg.test_proto.MessageV3 f_int32:3 r_string:"a">]`,
+			removeRandomSpace: true,
+		},
+		{
+			name: "dict defaults",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+proto.register_defaults(pb.MessageV3.NestedMessage, {"f_string": "a"})
+
+def fun():
+	return pb.MessageV3.NestedMessage()
+`,
+			want: `<skycfg.test_proto.MessageV3.NestedMessage f_string:"a">`,
+		},
+		{
+			name: "factory",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+
+def factory():
+	return pb.MessageV3(f_int32 = 1, r_string = ["a"])
+
+proto.register_defaults(pb.MessageV3, factory)
+
+def fun():
+	a = pb.MessageV3()
+	a.r_string.append("b")
+	return [a, pb.MessageV3(f_string = "b")]
+`,
+			want:              `[<skycfg.test_proto.MessageV3 f_int32:1 r_string:"a" r_string:"b">, <skycfg.test_proto.MessageV3 f_int32:1 f_string:"b" r_string:"a">]`,
+			removeRandomSpace: true,
+		},
+		{
+			name: "unregister",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+proto.register_defaults(pb.MessageV3, {"f_int32": 1})
+proto.register_defaults(pb.MessageV3, None)
+
+def fun():
+	return pb.MessageV3()
+`,
+			want: &pb.MessageV3{},
+		},
+		{
+			name: "set_defaults",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+proto.register_defaults(pb.MessageV2, {"f_int32": 1, "f_int64": 2})
+
+def fun():
+	msg = pb.MessageV2()
+	msg.f_int32 = 5
+	return proto.set_defaults(msg)
+`,
+			want: &pb.MessageV2{
+				FInt32:  proto.Int32(5),
+				FInt64:  proto.Int64(2),
+				FString: proto.String("default_str"),
+			},
+		},
+		{
+			name:    "wrong message type",
+			src:     `proto.register_defaults(proto.package("skycfg.test_proto").MessageV3, proto.package("skycfg.test_proto").MessageV2())`,
+			wantErr: errors.New("proto.register_defaults: for parameter 2: got skycfg.test_proto.MessageV2, want skycfg.test_proto.MessageV3"),
+		},
+		{
+			name:    "invalid field",
+			src:     `proto.register_defaults(proto.package("skycfg.test_proto").MessageV3, {"f_int32": "a"})`,
+			wantErr: errors.New(`proto.register_defaults: for parameter 2: TypeError: value "a" (type "string") can't be assigned to type "int32".`),
+		},
+		{
+			name: "invalid factory result",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+
+def factory():
+	return 1
+
+proto.register_defaults(pb.MessageV3, factory)
+
+def fun():
+	return pb.MessageV3()
+`,
+			wantErr: errors.New("defaults factory for skycfg.test_proto.MessageV3: got int, want skycfg.test_proto.MessageV3 or dict"),
+		},
+		{
+			name: "registered after loading",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	proto.register_defaults(pb.MessageV3, {"f_int32": 1})
+	return pb.MessageV3()
+`,
+			wantErr: errors.New("proto.register_defaults: defaults can only be registered while loading a module, not by a function called after loading"),
+		},
+		{
+			name: "registered by function called while loading",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+
+def register():
+	proto.register_defaults(pb.MessageV3, {"f_int32": 1})
+
+register()
+
+def fun():
+	return pb.MessageV3()
+`,
+			want: &pb.MessageV3{FInt32: 1},
+		},
+	})
+}
+
+func TestModuleMessageDefaults(t *testing.T) {
+	globals := starlark.StringDict{
+		"proto": NewModule(newRegistry(), WithMessageDefaults(&pb.MessageV3{
+			FInt32:  1,
+			RString: []string{"a"},
+		})),
+	}
+	runSkycfgTests(t, []skycfgTest{
+		{
+			src:  `proto.package("skycfg.test_proto").MessageV3(f_string = "b")`,
+			want: &pb.MessageV3{FInt32: 1, FString: "b", RString: []string{"a"}},
+		},
+		{
+			src:  `proto.package("skycfg.test_proto").MessageV3(r_string = [])`,
+			want: &pb.MessageV3{FInt32: 1},
+		},
+	}, withGlobals(globals))
+}
+
+func TestProtoFieldMask(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "proto.field_mask",
+			src:  `proto.field_mask(proto.package("skycfg.test_proto").MessageV3, "f_string", "f_submsg.f_int32", "r_submsg")`,
+			want: &fieldmaskpb.FieldMask{Paths: []string{"f_string", "f_submsg.f_int32", "r_submsg"}},
+		},
+		{
+			name:    "proto.field_mask unknown field",
+			src:     `proto.field_mask(proto.package("skycfg.test_proto").MessageV3, "f_submsg.f_missing")`,
+			wantErr: errors.New(`proto.field_mask: invalid path "f_submsg.f_missing" for skycfg.test_proto.MessageV3: skycfg.test_proto.MessageV3 has no field "f_missing"`),
+		},
+		{
+			name:    "proto.field_mask through repeated field",
+			src:     `proto.field_mask(proto.package("skycfg.test_proto").MessageV3, "r_submsg.f_int32")`,
+			wantErr: errors.New(`proto.field_mask: invalid path "r_submsg.f_int32" for skycfg.test_proto.MessageV3: field "r_submsg" is not a singular message field`),
+		},
+		{
+			name:    "proto.field_mask non-string path",
+			src:     `proto.field_mask(proto.package("skycfg.test_proto").MessageV3, 1)`,
+			wantErr: errors.New(`proto.field_mask: for parameter 2: got int, want string`),
+		},
+		{
+			name: "proto.apply_mask",
+			src: `proto.apply_mask(
+				proto.package("skycfg.test_proto").MessageV3(
+					f_string = "kept",
+					f_int32 = 1,
+					f_submsg = proto.package("skycfg.test_proto").MessageV3(f_int32 = 2, f_string = "dropped"),
+					r_string = ["kept"],
+				),
+				proto.field_mask(proto.package("skycfg.test_proto").MessageV3, "f_string", "f_submsg.f_int32", "r_string", "f_bool"),
+			)`,
+			want: &pb.MessageV3{
+				FString: "kept",
+				FSubmsg: &pb.MessageV3{FInt32: 2},
+				RString: []string{"kept"},
+			},
+		},
+		{
+			name: "proto.apply_mask with list of paths",
+			src: `proto.apply_mask(
+				proto.package("skycfg.test_proto").MessageV3(f_string = "a", f_int32 = 1),
+				["f_int32", "f_submsg"],
+			)`,
+			want: &pb.MessageV3{FInt32: 1},
+		},
+		{
+			name:    "proto.apply_mask invalid path",
+			src:     `proto.apply_mask(proto.package("skycfg.test_proto").MessageV3(), ["f_nope"])`,
+			wantErr: errors.New(`proto.apply_mask: invalid path "f_nope" for skycfg.test_proto.MessageV3: skycfg.test_proto.MessageV3 has no field "f_nope"`),
+		},
+		{
+			name: "proto.mask_of",
+			src: `proto.mask_of(proto.package("skycfg.test_proto").MessageV3(
+				f_string = "a",
+				f_submsg = proto.package("skycfg.test_proto").MessageV3(f_int32 = 2, f_submsg = proto.package("skycfg.test_proto").MessageV3()),
+				map_string = {"k": "v"},
+			))`,
+			want: &fieldmaskpb.FieldMask{Paths: []string{"f_string", "f_submsg.f_int32", "f_submsg.f_submsg", "map_string"}},
+		},
+	})
+}
+
+func TestProtoFieldPath(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "proto.set creates intermediate messages",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV3()
+	proto.set(msg, "f_submsg.f_submsg.f_string", "deep")
+	proto.set(msg, "r_submsg[0].f_int32", 1)
+	proto.set(msg, "r_submsg[0].r_string[0]", "a")
+	proto.set(msg, 'map_submsg["k"].map_string["x"]', "y")
+	proto.set(msg, "map_string['x']", "quoted")
+	proto.set(msg, "f_Duration", "1s")
+	return msg
+`,
+			want: &pb.MessageV3{
+				FSubmsg: &pb.MessageV3{FSubmsg: &pb.MessageV3{FString: "deep"}},
+				RSubmsg: []*pb.MessageV3{{FInt32: 1, RString: []string{"a"}}},
+				MapSubmsg: map[string]*pb.MessageV3{
+					"k": {MapString: map[string]string{"x": "y"}},
+				},
+				MapString:  map[string]string{"x": "quoted"},
+				F_Duration: durationpb.New(time.Second),
+			},
+		},
+		{
+			name: "proto.set replaces list elements",
+			srcFunc: `
+def fun():
+	msg = proto.package("skycfg.test_proto").MessageV3(r_string = ["a", "b"])
+	proto.set(msg, "r_string[1]", "c")
+	proto.set(msg, "r_string[2]", "d")
+	return msg
+`,
+			want: &pb.MessageV3{RString: []string{"a", "c", "d"}},
+		},
+		{
+			name:    "proto.set index out of range",
+			src:     `proto.set(proto.package("skycfg.test_proto").MessageV3(), "r_submsg[1].f_int32", 1)`,
+			wantErr: errors.New(`proto.set: index 1 out of range for repeated field "r_submsg" of length 0`),
+		},
+		{
+			name:    "proto.set unknown field",
+			src:     `proto.set(proto.package("skycfg.test_proto").MessageV3(), "f_submsg.f_nope", 1)`,
+			wantErr: errors.New(`proto.set: skycfg.test_proto.MessageV3 has no field "f_nope"`),
+		},
+		{
+			name:    "proto.set through scalar field",
+			src:     `proto.set(proto.package("skycfg.test_proto").MessageV3(), "f_string.f_int32", 1)`,
+			wantErr: errors.New(`proto.set: field "f_string" is not a message field`),
+		},
+		{
+			name:    "proto.set type error",
+			src:     `proto.set(proto.package("skycfg.test_proto").MessageV3(), "f_submsg.f_int32", "1")`,
+			wantErr: errors.New(`proto.set: TypeError: value "1" (type "string") can't be assigned to type "int32".`),
+		},
+		{
+			name: "proto.set frozen message",
+			srcFunc: `
+pb = proto.package("skycfg.test_proto")
+frozen = pb.MessageV3()
+
+def fun():
+	proto.set(frozen, "r_string[0]", "a")
+`,
+			wantErr: errors.New("proto.set: cannot set field of frozen message"),
+		},
+		{
+			name:    "proto.set invalid path",
+			src:     `proto.set(proto.package("skycfg.test_proto").MessageV3(), "r_string[x]", "a")`,
+			wantErr: errors.New(`proto.set: invalid path "r_string[x]": subscript [x] is not an integer or quoted string`),
+		},
+		{
+			name: "proto.get",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV3(
+		f_submsg = pb.MessageV3(f_string = "a"),
+		r_submsg = [pb.MessageV3(f_int32 = 1)],
+		map_string = {"k": "v"},
+	)
+	return [
+		proto.get(msg, "f_submsg.f_string"),
+		proto.get(msg, "r_submsg[0].f_int32"),
+		proto.get(msg, 'map_string["k"]'),
+		proto.get(msg, "r_submsg[1].f_int32"),
+		proto.get(msg, 'map_string["missing"]', default = "fallback"),
+		proto.get(msg, "f_submsg.f_submsg.f_string", "unset"),
+	]
+`,
+			want: `["a", 1, "v", None, "fallback", "unset"]`,
+		},
+		{
+			name:    "proto.get subscript of singular field",
+			src:     `proto.get(proto.package("skycfg.test_proto").MessageV3(), "f_submsg[0]")`,
+			wantErr: errors.New(`proto.get: invalid path "f_submsg[0]": field "f_submsg" is not a repeated or map field`),
+		},
+	})
+}
+
+func TestProtoDiff(t *testing.T) {
+	runSkycfgTests(t, []skycfgTest{
+		{
+			name: "proto.diff",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	a = pb.MessageV3(f_string = "a", f_int32 = 1, r_string = ["x", "y"], map_string = {"k": "v"})
+	b = pb.MessageV3(f_string = "b", f_int32 = 1, r_string = ["x"], map_string = {"k": "v", "l": "w"})
+	return [(c.path, c.old, c.new) for c in proto.diff(a, b)]
+`,
+			want: `[("f_string", "a", "b"), ("r_string[1]", "y", None), ("map_string[\"l\"]", None, "w")]`,
+		},
+		{
+			name: "proto.diff nested messages",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	a = pb.MessageV3(f_submsg = pb.MessageV3(f_int32 = 1), r_submsg = [pb.MessageV3(f_toplevel_enum = pb.ToplevelEnumV3.TOPLEVEL_ENUM_V3_A)])
+	b = pb.MessageV3(f_submsg = pb.MessageV3(f_int32 = 2), r_submsg = [pb.MessageV3(f_toplevel_enum = pb.ToplevelEnumV3.TOPLEVEL_ENUM_V3_B)])
+	return [(c.path, c.old, c.new) for c in proto.diff(a, b)]
+`,
+			want: `[("f_submsg.f_int32", 1, 2), ("r_submsg[0].f_toplevel_enum", <skycfg.test_proto.ToplevelEnumV3 TOPLEVEL_ENUM_V3_A=0>, <skycfg.test_proto.ToplevelEnumV3 TOPLEVEL_ENUM_V3_B=1>)]`,
+		},
+		{
+			name: "proto.diff proto3 zero value",
+			srcFunc: `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	return [(c.path, c.old, c.new) for c in proto.diff(pb.MessageV3(f_int32 = 1), pb.MessageV3(f_int32 = 0))]
+`,
+			want: `[("f_int32", 1, 0)]`,
+		},
+		{
+			name: "proto.diff equal messages",
+			src:  `proto.diff(proto.package("skycfg.test_proto").MessageV3(f_int32 = 1), proto.package("skycfg.test_proto").MessageV3(f_int32 = 1))`,
+			want: `[]`,
+		},
+		{
+			name: "proto.diff_text",
+			src: `proto.diff_text(
+				proto.package("skycfg.test_proto").MessageV3(f_string = "a", f_submsg = proto.package("skycfg.test_proto").MessageV3(f_int32 = 1)),
+				proto.package("skycfg.test_proto").MessageV3(f_string = "b", r_string = ["x"]),
+			)`,
+			want: `"~ f_string: \"a\" -> \"b\"\n- f_submsg: {f_int32:1}\n+ r_string[0]: \"x\"\n"`,
+		},
+		{
+			name:    "proto.diff different types",
+			src:     `proto.diff(proto.package("skycfg.test_proto").MessageV2(), proto.package("skycfg.test_proto").MessageV3())`,
+			wantErr: errors.New("proto.diff: can't diff messages of different types skycfg.test_proto.MessageV2 and skycfg.test_proto.MessageV3"),
+		},
+		{
+			name:    "proto.diff non-message",
+			src:     `proto.diff(proto.package("skycfg.test_proto").MessageV3(), 1)`,
+			wantErr: errors.New("proto.diff: for parameter 2: got int, want proto.Message"),
+		},
+	})
+}
+
+func TestDiff(t *testing.T) {
+	a := &pb.MessageV2{
+		FInt32:      proto.Int32(1),
+		FNestedEnum: pb.MessageV2_NESTED_ENUM_A.Enum(),
+		MapSubmsg:   map[string]*pb.MessageV2{"a": {FString: proto.String("x")}},
+		RString:     []string{"x"},
+	}
+	b := &pb.MessageV2{
+		FInt64:      proto.Int64(2),
+		FNestedEnum: pb.MessageV2_NESTED_ENUM_B.Enum(),
+		MapSubmsg:   map[string]*pb.MessageV2{"a": {FString: proto.String("y")}},
+		RString:     []string{"x", "y"},
+	}
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`- f_int32: 1`,
+		`+ f_int64: 2`,
+		`+ r_string[1]: "y"`,
+		`~ map_submsg["a"].f_string: "x" -> "y"`,
+		`~ f_nested_enum: NESTED_ENUM_A -> NESTED_ENUM_B`,
+		``,
+	}, "\n")
+	if got := FormatDiff(changes); got != want {
+		t.Errorf("FormatDiff() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiffExtensionsAndUnknownFields(t *testing.T) {
+	a := &pb.MessageV2{}
+	proto.SetExtension(a, pb.E_FExtString, "x")
+	proto.SetExtension(a, pb.E_RExtInt32, []int32{1})
+	a.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 5000, protowire.VarintType), 1))
+
+	b := &pb.MessageV2{FSubmsg: &pb.MessageV2{}}
+	proto.SetExtension(b, pb.E_FExtString, "y")
+	b.FSubmsg.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 5001, protowire.VarintType), 2))
+
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`+ f_submsg: {5001:2}`,
+		`~ [skycfg.test_proto.f_ext_string]: "x" -> "y"`,
+		`- [skycfg.test_proto.r_ext_int32][0]: 1`,
+		`- 5000: "\xc0\xb8\x02\x01"`,
+		``,
+	}, "\n")
+	if got := FormatDiff(changes); got != want {
+		t.Errorf("FormatDiff() =\n%s\nwant:\n%s", got, want)
+	}
+
+	a.FSubmsg = &pb.MessageV2{}
+	changes, err = Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 4 || changes[0].Path != "f_submsg.5001" || changes[0].Field != nil {
+		t.Errorf("Expected unknown field of f_submsg to be added, got %v", changes)
+	}
+}
+
+func TestRegisterDescriptorSet(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("skycfg/dynamic.proto"),
+		Package:    proto.String("skycfg.dynamic"),
+		Dependency: []string{"skycfg/missing.proto"},
+		Syntax:     proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Example"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("name"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("name"),
+			}},
+		}},
+	}
+
+	registry := &protoregistry.Types{}
+	err := RegisterDescriptorSet(registry, &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{file},
+	})
+	checkError(t, err, errors.New("skycfg/missing.proto: not found in descriptor set (imported by skycfg/dynamic.proto)"))
+
+	file.Dependency = nil
+	err = RegisterDescriptorSet(registry, &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{file},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runSkycfgTests(t, []skycfgTest{
+		{
+			src:  `proto.encode_text(proto.package("skycfg.dynamic").Example(name = "hello"))`,
+			want: `"name:\"hello\""`,
+		},
+	}, withGlobals(starlark.StringDict{
+		"proto": NewModule(registry),
+	}))
+}
+
+func TestFieldPositions(t *testing.T) {
+	globals, err := starlark.ExecFile(&starlark.Thread{}, "", `
+def fun():
+	pb = proto.package("skycfg.test_proto")
+	msg = pb.MessageV3(f_string = "a")
+	msg.f_submsg = pb.MessageV3()
+	msg.f_submsg.f_int32 = 1
+	msg.r_submsg.append(pb.MessageV3(f_int64 = 2))
+	msg.map_submsg["k"] = pb.MessageV3()
+	msg.f_oneof_a = "b"
+	msg.f_oneof_b = "c"
+	return msg
+`, starlark.StringDict{"proto": NewModule(newRegistry())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := starlark.Call(&starlark.Thread{}, globals["fun"], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FieldPositions(val); len(got) != 0 {
+		t.Errorf("Expected no positions without EnableFieldPositions, got %v", got)
+	}
+
+	thread := &starlark.Thread{}
+	EnableFieldPositions(thread)
+	val, err = starlark.Call(thread, globals["fun"], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for path, pos := range FieldPositions(val) {
+		got[path] = pos.String()
+	}
+	want := map[string]string{
+		"":                    ":4:20",
+		"f_string":            ":4:20",
+		"f_submsg":            ":5:5",
+		"f_submsg.f_int32":    ":6:14",
+		"r_submsg":            ":7:5",
+		"r_submsg[0]":         ":7:34",
+		"r_submsg[0].f_int64": ":7:34",
+		"map_submsg":          ":8:5",
+		`map_submsg["k"]`:     ":8:36",
+		"f_oneof_b":           ":10:5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldPositions() = %v, want %v", got, want)
+	}
+
+	msg, err := NewMessage(&pb.MessageV3{FString: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FieldPositions(msg); len(got) != 0 {
+		t.Errorf("Expected no positions for messages created by Go, got %v", got)
+	}
+}
+
 func TestProtoToAnyV2(t *testing.T) {
 	val, err := eval(`proto.encode_any(proto.package("skycfg.test_proto").MessageV2(
 		f_string = "some string",
@@ -692,7 +1474,7 @@ func runSkycfgTests(t *testing.T, tests []skycfgTest, opts ...globalTestOption)
 
 			if test.wantType != "" {
 				if val.Type() != test.wantType {
-					t.Fatalf("Expected type\nwanted: %t\ngot   : %t", test.wantType, val.Type())
+					t.Fatalf("Expected type\nwanted: %s\ngot   : %s", test.wantType, val.Type())
 				}
 			}
 		})
@@ -0,0 +1,235 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	durationType  = (&durationpb.Duration{}).ProtoReflect().Descriptor().FullName()
+	timestampType = (&timestamppb.Timestamp{}).ProtoReflect().Descriptor().FullName()
+
+	goDurationType = reflect.TypeOf(time.Duration(0))
+	goTimeType     = reflect.TypeOf(time.Time{})
+
+	// Matches one part of a duration string, such as "1.5h", with the
+	// syntax of time.ParseDuration.
+	durationPart = regexp.MustCompile(`^([0-9]*)(?:\.([0-9]*))?(ns|us|µs|μs|ms|s|m|h)`)
+
+	errDurationSyntax = errors.New("invalid duration")
+	errDurationRange  = errors.New("duration out of range")
+)
+
+// Nanoseconds in each unit of a duration string.
+var durationUnits = map[string]int64{
+	"ns": 1,
+	"us": 1e3,
+	"µs": 1e3, // U+00B5 micro sign
+	"μs": 1e3, // U+03BC Greek letter mu
+	"ms": 1e6,
+	"s":  1e9,
+	"m":  60e9,
+	"h":  3600e9,
+}
+
+// Longest duration that google.protobuf.Duration can represent, about
+// 10,000 years, in whole seconds.
+const maxDurationSeconds = 315576000000
+
+// Longest duration that time.Duration can represent, in whole seconds.
+const maxGoDurationSeconds = math.MaxInt64 / int64(time.Second)
+
+// durationFromStarlark converts a duration string such as "1h30m", or a
+// Starlark time.duration value, into a google.protobuf.Duration.
+//
+// Returns (nil, nil) if val is not convertible to a duration.
+func durationFromStarlark(val starlark.Value) (*protoMessage, error) {
+	if s, ok := val.(starlark.String); ok {
+		d, err := parseDuration(string(s))
+		switch err {
+		case nil:
+			return NewMessage(d)
+		case errDurationRange:
+			return nil, fmt.Errorf("ValueError: value %s overflows type `%s'.", s, durationType)
+		default:
+			return nil, fmt.Errorf("ValueError: value %s is not a valid `%s': expected a duration such as \"1h30m\".", s, durationType)
+		}
+	}
+	if goValue, ok := starlarkTimeValue(val, "time.duration", goDurationType); ok {
+		return NewMessage(durationpb.New(goValue.Interface().(time.Duration)))
+	}
+	return nil, nil
+}
+
+// parseDuration parses a string with the syntax of time.ParseDuration, but
+// with the range of google.protobuf.Duration rather than time.Duration.
+func parseDuration(s string) (*durationpb.Duration, error) {
+	neg := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if s == "0" {
+		return &durationpb.Duration{}, nil
+	}
+	if s == "" {
+		return nil, errDurationSyntax
+	}
+
+	// Sum in nanoseconds, which may exceed the range of int64.
+	total := new(big.Int)
+	for s != "" {
+		match := durationPart.FindStringSubmatch(s)
+		if match == nil || (match[1] == "" && match[2] == "") {
+			return nil, errDurationSyntax
+		}
+		s = s[len(match[0]):]
+
+		unit := big.NewInt(durationUnits[match[3]])
+		if match[1] != "" {
+			whole, _ := new(big.Int).SetString(match[1], 10)
+			total.Add(total, whole.Mul(whole, unit))
+		}
+		if match[2] != "" {
+			// Fractions of a nanosecond are truncated.
+			frac, _ := new(big.Int).SetString(match[2], 10)
+			scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(len(match[2]))), nil)
+			total.Add(total, frac.Mul(frac, unit).Quo(frac, scale))
+		}
+	}
+	if neg {
+		total.Neg(total)
+	}
+
+	seconds, nanos := new(big.Int).QuoRem(total, big.NewInt(1e9), new(big.Int))
+	if !seconds.IsInt64() || seconds.Int64() > maxDurationSeconds || seconds.Int64() < -maxDurationSeconds {
+		return nil, errDurationRange
+	}
+	return &durationpb.Duration{Seconds: seconds.Int64(), Nanos: int32(nanos.Int64())}, nil
+}
+
+// formatDuration formats a google.protobuf.Duration like time.Duration's
+// String method, including durations too long for time.Duration.
+func formatDuration(seconds, nanos int64) string {
+	if seconds < maxGoDurationSeconds && seconds > -maxGoDurationSeconds {
+		return (time.Duration(seconds)*time.Second + time.Duration(nanos)).String()
+	}
+	sign := ""
+	if seconds < 0 {
+		sign = "-"
+		seconds, nanos = -seconds, -nanos
+	}
+	out := fmt.Sprintf("%s%dh%dm%d", sign, seconds/3600, seconds/60%60, seconds%60)
+	if nanos != 0 {
+		out += strings.TrimRight(fmt.Sprintf(".%09d", nanos), "0")
+	}
+	return out + "s"
+}
+
+// timestampFromStarlark converts an RFC 3339 string, or a Starlark time.time
+// value, into a google.protobuf.Timestamp.
+//
+// Returns (nil, nil) if val is not convertible to a timestamp.
+func timestampFromStarlark(val starlark.Value) (*protoMessage, error) {
+	var t time.Time
+	if s, ok := val.(starlark.String); ok {
+		parsed, err := time.Parse(time.RFC3339Nano, string(s))
+		if err != nil {
+			return nil, fmt.Errorf("ValueError: value %s is not a valid `%s': expected an RFC 3339 timestamp such as \"2006-01-02T15:04:05Z\".", s, timestampType)
+		}
+		t = parsed
+	} else if goValue, ok := starlarkTimeValue(val, "time.time", goTimeType); ok {
+		t = goValue.Interface().(time.Time)
+	} else {
+		return nil, nil
+	}
+
+	ts := timestamppb.New(t)
+	if err := ts.CheckValid(); err != nil {
+		return nil, fmt.Errorf("ValueError: value %s overflows type `%s'.", val.String(), timestampType)
+	}
+	return NewMessage(ts)
+}
+
+// starlarkTimeValue converts values from the Starlark "time" library, which
+// are defined as named types of time.Time and time.Duration, without
+// depending on that library directly.
+func starlarkTimeValue(val starlark.Value, typeName string, goType reflect.Type) (reflect.Value, bool) {
+	if val.Type() != typeName {
+		return reflect.Value{}, false
+	}
+	rv := reflect.ValueOf(val)
+	if !rv.Type().ConvertibleTo(goType) {
+		return reflect.Value{}, false
+	}
+	return rv.Convert(goType), true
+}
+
+// timeAttrNames returns the names of computed attributes available on
+// messages of well-known time types.
+func timeAttrNames(msgDesc protoreflect.MessageDescriptor) []string {
+	switch msgDesc.FullName() {
+	case durationType:
+		return []string{"duration_string", "total_seconds"}
+	case timestampType:
+		return []string{"rfc3339"}
+	}
+	return nil
+}
+
+// timeAttr returns computed attributes of Duration and Timestamp messages,
+// for reading back values in the formats accepted on assignment.
+//
+// Returns (nil, nil) if name is not a computed attribute of msg.
+func timeAttr(msg *protoMessage, name string) (starlark.Value, error) {
+	fullName := msg.msgDesc.FullName()
+	if fullName != durationType && fullName != timestampType {
+		return nil, nil
+	}
+
+	reflectMsg := msg.toProtoMessage().ProtoReflect()
+	fields := msg.msgDesc.Fields()
+	seconds := reflectMsg.Get(fields.ByName("seconds")).Int()
+	nanos := reflectMsg.Get(fields.ByName("nanos")).Int()
+
+	switch {
+	case fullName == durationType && name == "duration_string":
+		return starlark.String(formatDuration(seconds, nanos)), nil
+	case fullName == durationType && name == "total_seconds":
+		return starlark.Float(float64(seconds) + float64(nanos)/1e9), nil
+	case fullName == timestampType && name == "rfc3339":
+		ts := &timestamppb.Timestamp{Seconds: seconds, Nanos: int32(nanos)}
+		if err := ts.CheckValid(); err != nil {
+			return nil, fmt.Errorf("ValueError: value %s is not a valid `%s': %v", msg.String(), timestampType, err)
+		}
+		return starlark.String(ts.AsTime().Format(time.RFC3339Nano)), nil
+	}
+	return nil, nil
+}
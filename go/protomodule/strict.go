@@ -0,0 +1,159 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protomodule
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// AsProtoMessageStrict is like AsProtoMessage, but returns an error naming
+// the field if any field's value can't be converted to Protobuf, or would
+// lose information in the conversion, rather than silently dropping it.
+//
+// Conversions that lose information include integers that can't be
+// represented exactly by a float or double field, and finite numbers that
+// overflow a float field.
+func AsProtoMessageStrict(v starlark.Value) (proto.Message, error) {
+	msg, ok := v.(*protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("got %s, want proto.Message", v.Type())
+	}
+	if err := checkConversion(msg, ""); err != nil {
+		return nil, fmt.Errorf("%s: %v", msg.Type(), err)
+	}
+	return msg.toProtoMessage(), nil
+}
+
+// checkConversion checks that every field of msg can be converted to
+// Protobuf without loss. Errors are prefixed by the path of the field.
+func checkConversion(msg *protoMessage, prefix string) error {
+	// Fields that haven't been converted from Protobuf are unchanged.
+	if msg.src != nil {
+		return nil
+	}
+	fields := msg.msgDesc.Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		fieldDesc := fields.Get(ii)
+		val, ok := msg.fields[string(fieldDesc.Name())]
+		if !ok {
+			continue
+		}
+		path := string(fieldDesc.Name())
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		if err := checkFieldConversion(fieldDesc, path, val); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(msg.extensions))
+	for name := range msg.extensions {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ext := msg.extensions[protoreflect.FullName(name)]
+		path := "[" + name + "]"
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		if err := checkFieldConversion(ext.extType.TypeDescriptor(), path, ext.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFieldConversion(fieldDesc protoreflect.FieldDescriptor, path string, val starlark.Value) error {
+	switch {
+	case fieldDesc.IsList():
+		list, ok := val.(*protoRepeated)
+		if !ok {
+			return fmt.Errorf("%s: %v", path, typeError(fieldDesc, val, false))
+		}
+		for ii := 0; ii < list.Len(); ii++ {
+			if err := checkScalarConversion(fieldDesc, fmt.Sprintf("%s[%d]", path, ii), list.Index(ii)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case fieldDesc.IsMap():
+		m, ok := val.(*protoMap)
+		if !ok {
+			return fmt.Errorf("%s: %v", path, typeError(fieldDesc, val, false))
+		}
+		for _, item := range m.Items() {
+			elemPath := path + "[" + mapKeyPath(item[0]) + "]"
+			if _, err := scalarValueFromStarlark(fieldDesc.MapKey(), item[0]); err != nil {
+				return fmt.Errorf("%s: %v", elemPath, err)
+			}
+			if err := checkScalarConversion(fieldDesc.MapValue(), elemPath, item[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return checkScalarConversion(fieldDesc, path, val)
+}
+
+func checkScalarConversion(fieldDesc protoreflect.FieldDescriptor, path string, val starlark.Value) error {
+	if nested, ok := val.(*protoMessage); ok && nested.Type() == typeName(fieldDesc) {
+		return checkConversion(nested, path)
+	}
+	if _, err := scalarValueFromStarlark(fieldDesc, val); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	switch fieldDesc.Kind() {
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if !isExactFloat(fieldDesc.Kind(), val) {
+			return fmt.Errorf("%s: ValueError: value %v is not exactly representable as type %q.", path, val, typeName(fieldDesc))
+		}
+	}
+	return nil
+}
+
+// isExactFloat reports whether a number assigned to a float or double field
+// keeps its value. Rounding of non-integral values to the nearest float is
+// expected, but integers must be represented exactly and finite values must
+// not overflow.
+func isExactFloat(kind protoreflect.Kind, val starlark.Value) bool {
+	f, ok := starlark.AsFloat(val)
+	if !ok {
+		return true
+	}
+	if kind == protoreflect.FloatKind {
+		if !math.IsInf(f, 0) && math.IsInf(float64(float32(f)), 0) {
+			return false
+		}
+		f = float64(float32(f))
+	}
+	i, ok := val.(starlark.Int)
+	if !ok {
+		return true
+	}
+	exact, _ := new(big.Float).SetFloat64(f).Int(nil)
+	return exact.Cmp(i.BigInt()) == 0
+}
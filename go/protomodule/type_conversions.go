@@ -71,6 +71,60 @@ func valueFromStarlark(msg protoreflect.Message, fieldDesc protoreflect.FieldDes
 	return scalarValueFromStarlark(fieldDesc, val)
 }
 
+// setFieldFromStarlark sets a field of msg to val, appending the elements of
+// lists and maps directly to the field. The field is left unset on error.
+func setFieldFromStarlark(msg protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, val starlark.Value) error {
+	if fieldDesc.IsList() {
+		list, ok := val.(*protoRepeated)
+		if !ok {
+			return typeError(fieldDesc, val, false)
+		}
+		if list.Len() == 0 {
+			return nil
+		}
+		protoList := msg.Mutable(fieldDesc).List()
+		for i := 0; i < list.Len(); i++ {
+			v, err := scalarValueFromStarlark(fieldDesc, list.Index(i))
+			if err != nil {
+				msg.Clear(fieldDesc)
+				return err
+			}
+			protoList.Append(v)
+		}
+		return nil
+	} else if fieldDesc.IsMap() {
+		mapVal, ok := val.(*protoMap)
+		if !ok {
+			return typeError(fieldDesc, val, false)
+		}
+		if mapVal.Len() == 0 {
+			return nil
+		}
+		protoMap := msg.Mutable(fieldDesc).Map()
+		for _, item := range mapVal.Items() {
+			protoK, err := scalarValueFromStarlark(fieldDesc.MapKey(), item[0])
+			if err != nil {
+				msg.Clear(fieldDesc)
+				return err
+			}
+			protoV, err := scalarValueFromStarlark(fieldDesc.MapValue(), item[1])
+			if err != nil {
+				msg.Clear(fieldDesc)
+				return err
+			}
+			protoMap.Set(protoreflect.MapKey(protoK), protoV)
+		}
+		return nil
+	}
+
+	v, err := scalarValueFromStarlark(fieldDesc, val)
+	if err != nil {
+		return err
+	}
+	msg.Set(fieldDesc, v)
+	return nil
+}
+
 func scalarValueFromStarlark(fieldDesc protoreflect.FieldDescriptor, val starlark.Value) (protoreflect.Value, error) {
 	k := fieldDesc.Kind()
 	switch k {
@@ -119,10 +173,14 @@ func scalarValueFromStarlark(fieldDesc protoreflect.FieldDescriptor, val starlar
 			return protoreflect.Value{}, fmt.Errorf("ValueError: value %v overflows type \"uint32\".", valInt)
 		}
 	case protoreflect.MessageKind:
+		if msg, ok := val.(*protoMessage); ok && msg.Type() == typeName(fieldDesc) {
+			return protoreflect.ValueOf(msg.toProtoMessage().ProtoReflect()), nil
+		}
+		if isStructType(fieldDesc.Message()) {
+			return structFromStarlark(fieldDesc, val)
+		}
 		if msg, ok := val.(*protoMessage); ok {
-			if msg.Type() == typeName(fieldDesc) {
-				return protoreflect.ValueOf(msg.toProtoMessage().ProtoReflect()), nil
-			} else if fieldDesc.Message().FullName() == "google.protobuf.Any" {
+			if fieldDesc.Message().FullName() == "google.protobuf.Any" {
 				any, err := anypb.New(msg.toProtoMessage())
 				if err != nil {
 					return protoreflect.Value{}, err
@@ -143,13 +201,25 @@ func scalarValueFromStarlark(fieldDesc protoreflect.FieldDescriptor, val starlar
 	return protoreflect.Value{}, typeError(fieldDesc, val, true)
 }
 
+// conversionOptions adjust how field values are converted between Starlark
+// and Protobuf.
+type conversionOptions struct {
+	// Whether enum fields accept the names and numbers of enum values.
+	enumNames bool
+
+	// Whether Struct, Value, and ListValue fields are read as plain
+	// Starlark values rather than messages.
+	structValues bool
+}
+
 // Wrap a protobuf field value as a starlark.Value
-func valueToStarlark(val protoreflect.Value, fieldDesc protoreflect.FieldDescriptor) (starlark.Value, error) {
+func valueToStarlark(val protoreflect.Value, fieldDesc protoreflect.FieldDescriptor, conv conversionOptions) (starlark.Value, error) {
 	if fieldDesc.IsList() {
 		if listVal, ok := val.Interface().(protoreflect.List); ok {
 			out := newProtoRepeated(fieldDesc)
+			out.conv = conv
 			for i := 0; i < listVal.Len(); i++ {
-				starlarkValue, err := scalarValueToStarlark(listVal.Get(i), fieldDesc)
+				starlarkValue, err := scalarValueToStarlark(listVal.Get(i), fieldDesc, conv)
 				if err != nil {
 					return starlark.None, err
 				}
@@ -163,15 +233,16 @@ func valueToStarlark(val protoreflect.Value, fieldDesc protoreflect.FieldDescrip
 	} else if fieldDesc.IsMap() {
 		if mapVal, ok := val.Interface().(protoreflect.Map); ok {
 			out := newProtoMap(fieldDesc.MapKey(), fieldDesc.MapValue())
+			out.conv = conv
 			var rangeErr error
 			mapVal.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
-				starlarkKey, err := scalarValueToStarlark(protoreflect.Value(k), fieldDesc.MapKey())
+				starlarkKey, err := scalarValueToStarlark(protoreflect.Value(k), fieldDesc.MapKey(), conv)
 				if err != nil {
 					rangeErr = err
 					return false
 				}
 
-				starlarkValue, err := scalarValueToStarlark(v, fieldDesc.MapValue())
+				starlarkValue, err := scalarValueToStarlark(v, fieldDesc.MapValue(), conv)
 				if err != nil {
 					rangeErr = err
 					return false
@@ -191,10 +262,10 @@ func valueToStarlark(val protoreflect.Value, fieldDesc protoreflect.FieldDescrip
 		return starlark.None, fmt.Errorf("TypeError: cannot convert %T into map", val.Interface())
 	}
 
-	return scalarValueToStarlark(val, fieldDesc)
+	return scalarValueToStarlark(val, fieldDesc, conv)
 }
 
-func scalarValueToStarlark(val protoreflect.Value, fieldDesc protoreflect.FieldDescriptor) (starlark.Value, error) {
+func scalarValueToStarlark(val protoreflect.Value, fieldDesc protoreflect.FieldDescriptor, conv conversionOptions) (starlark.Value, error) {
 	switch fieldDesc.Kind() {
 	case protoreflect.BoolKind:
 		return starlark.Bool(val.Bool()), nil
@@ -216,21 +287,24 @@ func scalarValueToStarlark(val protoreflect.Value, fieldDesc protoreflect.FieldD
 		// Handle []byte ([]uint8) -> string special case.
 		return starlark.String(val.Bytes()), nil
 	case protoreflect.EnumKind:
-		enumNumber := val.Enum()
-		enumType := newEnumType(fieldDesc.Enum())
-		return enumType.ByNum(enumNumber)
+		return enumByNumber(fieldDesc.Enum(), val.Enum())
 	case protoreflect.MessageKind:
 		if val.Interface() == nil {
 			return starlark.None, nil
 		}
-		return NewMessage(val.Message().Interface())
+		if conv.structValues && isStructType(fieldDesc.Message()) {
+			return structToStarlark(val.Message()), nil
+		}
+		msg := newLazyMessage(val.Message())
+		msg.conv = conv
+		return msg, nil
 	}
 
 	return starlark.None, fmt.Errorf("valueToStarlark: Value unuspported: %T for %s (%s)\n", val.Interface(), string(fieldDesc.FullName()), fieldDesc.Kind().String())
 }
 
 // maybeConvertToWrapper checks if [val] is a primitive and [fieldDesc] is a corresponding
-// protobuf wrapper type and attempts to convert it.
+// protobuf wrapper type, Duration, or Timestamp and attempts to convert it.
 //
 // Returns
 // - (val, nil) on success
@@ -253,6 +327,10 @@ func maybeConvertToWrapper(fieldDesc protoreflect.FieldDescriptor, val starlark.
 	messageType := fieldDesc.Message().FullName()
 
 	switch messageType {
+	case durationType:
+		return durationFromStarlark(val)
+	case timestampType:
+		return timestampFromStarlark(val)
 	case UInt32ValueType:
 		switch valInt := val.(type) {
 		case starlark.Int:
@@ -310,12 +388,59 @@ func maybeConvertToWrapper(fieldDesc protoreflect.FieldDescriptor, val starlark.
 	return nil, nil
 }
 
-// Verify v can act as fieldDesc
+// Verify v can act as fieldDesc. Messages of the field's type are accepted
+// without converting them, since their fields were checked as they were set.
 func scalarTypeCheck(fieldDesc protoreflect.FieldDescriptor, v starlark.Value) error {
+	if msg, ok := v.(*protoMessage); ok && fieldDesc.Kind() == protoreflect.MessageKind && msg.Type() == typeName(fieldDesc) {
+		return nil
+	}
 	_, err := scalarValueFromStarlark(fieldDesc, v)
 	return err
 }
 
+// checkFieldValue verifies that val, as returned by convertFieldValue, can be
+// assigned to fieldDesc. Lists and maps of the field's element types were
+// checked as their elements were added, so only their type is checked.
+func checkFieldValue(fieldDesc protoreflect.FieldDescriptor, val starlark.Value) error {
+	if fieldDesc.IsList() {
+		list, ok := val.(*protoRepeated)
+		if !ok {
+			return typeError(fieldDesc, val, false)
+		}
+		if sameElementType(list.fieldDesc, fieldDesc) {
+			return nil
+		}
+		for i := 0; i < list.Len(); i++ {
+			if err := scalarTypeCheck(fieldDesc, list.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if fieldDesc.IsMap() {
+		mapVal, ok := val.(*protoMap)
+		if !ok {
+			return typeError(fieldDesc, val, false)
+		}
+		if sameElementType(mapVal.mapKey, fieldDesc.MapKey()) && sameElementType(mapVal.mapValue, fieldDesc.MapValue()) {
+			return nil
+		}
+		for _, item := range mapVal.Items() {
+			if err := scalarTypeCheck(fieldDesc.MapKey(), item[0]); err != nil {
+				return err
+			}
+			if err := scalarTypeCheck(fieldDesc.MapValue(), item[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return scalarTypeCheck(fieldDesc, val)
+}
+
+func sameElementType(a, b protoreflect.FieldDescriptor) bool {
+	return a.Kind() == b.Kind() && typeName(a) == typeName(b)
+}
+
 func typeError(fieldDesc protoreflect.FieldDescriptor, val starlark.Value, scalar bool) error {
 	expectedType := typeName(fieldDesc)
 
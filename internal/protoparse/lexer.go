@@ -0,0 +1,293 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protoparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenPunct
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of file"
+	case tokenIdent:
+		return "identifier"
+	case tokenInt:
+		return "integer"
+	case tokenFloat:
+		return "float"
+	case tokenString:
+		return "string"
+	}
+	return "punctuation"
+}
+
+type position struct {
+	line, col int
+}
+
+type token struct {
+	kind tokenKind
+	pos  position
+	// For strings, the unescaped value. Otherwise the source text.
+	text string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexer splits .proto source into tokens, skipping whitespace and comments.
+type lexer struct {
+	filename string
+	src      string
+	offset   int
+	pos      position
+}
+
+func newLexer(filename string, src []byte) *lexer {
+	return &lexer{
+		filename: filename,
+		src:      string(src),
+		pos:      position{line: 1, col: 1},
+	}
+}
+
+func (l *lexer) errorf(pos position, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d:%d: %s", l.filename, pos.line, pos.col, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) peekByte(ahead int) byte {
+	if l.offset+ahead < len(l.src) {
+		return l.src[l.offset+ahead]
+	}
+	return 0
+}
+
+func (l *lexer) advance(n int) {
+	for ii := 0; ii < n && l.offset < len(l.src); ii++ {
+		if l.src[l.offset] == '\n' {
+			l.pos.line++
+			l.pos.col = 1
+		} else {
+			l.pos.col++
+		}
+		l.offset++
+	}
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.offset < len(l.src) {
+		c := l.src[l.offset]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v':
+			l.advance(1)
+		case c == '/' && l.peekByte(1) == '/':
+			for l.offset < len(l.src) && l.src[l.offset] != '\n' {
+				l.advance(1)
+			}
+		case c == '/' && l.peekByte(1) == '*':
+			start := l.pos
+			end := strings.Index(l.src[l.offset+2:], "*/")
+			if end < 0 {
+				return l.errorf(start, "unterminated block comment")
+			}
+			l.advance(end + 4)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+	pos := l.pos
+	if l.offset >= len(l.src) {
+		return token{kind: tokenEOF, pos: pos}, nil
+	}
+
+	c := l.src[l.offset]
+	switch {
+	case isLetter(c):
+		start := l.offset
+		for l.offset < len(l.src) && (isLetter(l.src[l.offset]) || isDigit(l.src[l.offset])) {
+			l.advance(1)
+		}
+		return token{kind: tokenIdent, pos: pos, text: l.src[start:l.offset]}, nil
+	case isDigit(c) || (c == '.' && isDigit(l.peekByte(1))):
+		return l.number(pos)
+	case c == '"' || c == '\'':
+		return l.string(pos, c)
+	}
+
+	l.advance(1)
+	return token{kind: tokenPunct, pos: pos, text: string(c)}, nil
+}
+
+func (l *lexer) number(pos position) (token, error) {
+	start := l.offset
+	if l.src[l.offset] == '0' && (l.peekByte(1) == 'x' || l.peekByte(1) == 'X') {
+		l.advance(2)
+		for l.offset < len(l.src) && isHexDigit(l.src[l.offset]) {
+			l.advance(1)
+		}
+		return token{kind: tokenInt, pos: pos, text: l.src[start:l.offset]}, nil
+	}
+
+	kind := tokenInt
+	for l.offset < len(l.src) {
+		c := l.src[l.offset]
+		switch {
+		case isDigit(c):
+			l.advance(1)
+		case c == '.':
+			kind = tokenFloat
+			l.advance(1)
+		case c == 'e' || c == 'E':
+			kind = tokenFloat
+			l.advance(1)
+			if next := l.peekByte(0); next == '+' || next == '-' {
+				l.advance(1)
+			}
+		default:
+			if isLetter(c) {
+				return token{}, l.errorf(pos, "invalid number %q", l.src[start:l.offset+1])
+			}
+			return token{kind: kind, pos: pos, text: l.src[start:l.offset]}, nil
+		}
+	}
+	return token{kind: kind, pos: pos, text: l.src[start:l.offset]}, nil
+}
+
+func (l *lexer) string(pos position, quote byte) (token, error) {
+	l.advance(1)
+	var buf []byte
+	for {
+		if l.offset >= len(l.src) || l.src[l.offset] == '\n' {
+			return token{}, l.errorf(pos, "unterminated string")
+		}
+		c := l.src[l.offset]
+		if c == quote {
+			l.advance(1)
+			return token{kind: tokenString, pos: pos, text: string(buf)}, nil
+		}
+		if c != '\\' {
+			buf = append(buf, c)
+			l.advance(1)
+			continue
+		}
+
+		escPos := l.pos
+		l.advance(1)
+		esc := l.peekByte(0)
+		l.advance(1)
+		switch esc {
+		case 'a':
+			buf = append(buf, '\a')
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'v':
+			buf = append(buf, '\v')
+		case '\\', '\'', '"', '?':
+			buf = append(buf, esc)
+		case 'x', 'X':
+			n := 0
+			var v byte
+			for n < 2 && isHexDigit(l.peekByte(0)) {
+				d, _ := strconv.ParseUint(string(l.peekByte(0)), 16, 8)
+				v = v<<4 | byte(d)
+				l.advance(1)
+				n++
+			}
+			if n == 0 {
+				return token{}, l.errorf(escPos, "invalid hex escape")
+			}
+			buf = append(buf, v)
+		case 'u', 'U':
+			size := 4
+			if esc == 'U' {
+				size = 8
+			}
+			if l.offset+size > len(l.src) {
+				return token{}, l.errorf(escPos, "invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(l.src[l.offset:l.offset+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return token{}, l.errorf(escPos, "invalid unicode escape")
+			}
+			buf = append(buf, string(rune(r))...)
+			l.advance(size)
+		default:
+			if '0' <= esc && esc <= '7' {
+				v := int(esc - '0')
+				for n := 1; n < 3 && '0' <= l.peekByte(0) && l.peekByte(0) <= '7'; n++ {
+					v = v*8 + int(l.peekByte(0)-'0')
+					l.advance(1)
+				}
+				if v > 255 {
+					return token{}, l.errorf(escPos, "octal escape out of range")
+				}
+				buf = append(buf, byte(v))
+				continue
+			}
+			return token{}, l.errorf(escPos, "invalid escape %q", "\\"+string(esc))
+		}
+	}
+}
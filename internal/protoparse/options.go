@@ -0,0 +1,509 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protoparse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// constant is the value of an option.
+type constant struct {
+	lex      *lexer
+	pos      position
+	kind     tokenKind
+	text     string
+	negative bool
+	// Aggregate values are written in text format between braces, which
+	// text holds. They are only supported by custom options.
+	aggregate bool
+}
+
+func (c constant) errorf(format string, args ...interface{}) error {
+	return c.lex.errorf(c.pos, format, args...)
+}
+
+func (c constant) String() string {
+	if c.aggregate {
+		return "aggregate value"
+	}
+	sign := ""
+	if c.negative {
+		sign = "-"
+	}
+	if c.kind == tokenString {
+		return strconv.Quote(c.text)
+	}
+	return sign + c.text
+}
+
+// parseOptionStatement parses an "option" statement. The options message is
+// obtained from target only when an option is set, so that descriptors
+// without options have none.
+func (p *parser) parseOptionStatement(target func() protoreflect.Message) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	name, err := p.parseOptionName()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	c, err := p.parseConstant()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(";"); err != nil {
+		return err
+	}
+	return p.setOption(target(), name, c)
+}
+
+// parseCompactOptions parses an optional bracketed option list, such as
+// the options of a field.
+func (p *parser) parseCompactOptions(fn func(name string, c constant) error) error {
+	if ok, err := p.accept("["); err != nil || !ok {
+		return err
+	}
+	for {
+		name, err := p.parseOptionName()
+		if err != nil {
+			return err
+		}
+		if err := p.expect("="); err != nil {
+			return err
+		}
+		c, err := p.parseConstant()
+		if err != nil {
+			return err
+		}
+		if err := fn(name, c); err != nil {
+			return err
+		}
+		if ok, err := p.accept(","); err != nil {
+			return err
+		} else if !ok {
+			return p.expect("]")
+		}
+	}
+}
+
+// parseOptionName parses the name of an option. Custom options are named by
+// parenthesized extension names, such as "(my.option)". Names of fields
+// within options, such as "(my.option).field", are not supported.
+func (p *parser) parseOptionName() (string, error) {
+	pos := p.tok.pos
+	var parts []string
+	for {
+		if ok, err := p.accept("("); err != nil {
+			return "", err
+		} else if ok {
+			name, err := p.fullIdent(true)
+			if err != nil {
+				return "", err
+			}
+			if err := p.expect(")"); err != nil {
+				return "", err
+			}
+			parts = append(parts, "("+name+")")
+		} else {
+			name, err := p.ident()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, name)
+		}
+		if ok, err := p.accept("."); err != nil {
+			return "", err
+		} else if !ok {
+			break
+		}
+	}
+	name := strings.Join(parts, ".")
+	if len(parts) > 1 {
+		return "", p.lex.errorf(pos, "unsupported option %q", name)
+	}
+	return name, nil
+}
+
+func (p *parser) parseConstant() (constant, error) {
+	c := constant{lex: p.lex, pos: p.tok.pos}
+	if p.isPunct("{") {
+		text, err := p.aggregate()
+		c.aggregate = true
+		c.text = text
+		return c, err
+	}
+	if p.isPunct("-") || p.isPunct("+") {
+		c.negative = p.isPunct("-")
+		if err := p.next(); err != nil {
+			return c, err
+		}
+		if p.tok.kind != tokenInt && p.tok.kind != tokenFloat && !p.isIdent("inf") && !p.isIdent("nan") {
+			return c, p.unexpected("number")
+		}
+	}
+	switch p.tok.kind {
+	case tokenString:
+		text, err := p.stringLiteral()
+		c.kind = tokenString
+		c.text = text
+		return c, err
+	case tokenIdent, tokenInt, tokenFloat:
+		c.kind = p.tok.kind
+		c.text = p.tok.text
+		return c, p.next()
+	}
+	return c, p.unexpected("constant")
+}
+
+// aggregate parses a brace-delimited text format value, returning the text
+// between the braces.
+func (p *parser) aggregate() (string, error) {
+	start := p.lex.offset
+	depth := 0
+	for {
+		switch {
+		case p.tok.kind == tokenEOF:
+			return "", p.unexpected(`"}"`)
+		case p.isPunct("{"):
+			depth++
+		case p.isPunct("}"):
+			depth--
+		}
+		// The lexer is positioned just past the current token.
+		end := p.lex.offset - len(p.tok.text)
+		if err := p.next(); err != nil {
+			return "", err
+		}
+		if depth == 0 {
+			return p.lex.src[start:end], nil
+		}
+	}
+}
+
+// setOption sets a standard or custom option.
+func (p *parser) setOption(options protoreflect.Message, name string, c constant) error {
+	if strings.HasPrefix(name, "(") {
+		return p.setCustomOption(options, name, c)
+	}
+	return setStandardOption(options, name, c)
+}
+
+// setStandardOption sets a standard option, which is a field of one of the
+// descriptorpb option messages.
+func setStandardOption(options protoreflect.Message, name string, c constant) error {
+	fd := options.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		return c.errorf("unknown option %q", name)
+	}
+	if fd.Cardinality() == protoreflect.Repeated || fd.Message() != nil {
+		return c.errorf("unsupported option %q", name)
+	}
+	if c.aggregate {
+		return c.errorf("option %q: aggregate values are only supported for custom options", name)
+	}
+	value, err := c.value(fd)
+	if err != nil {
+		return c.errorf("option %q: %v", name, err)
+	}
+	options.Set(fd, value)
+	return nil
+}
+
+// setCustomOption sets a custom option, which is an extension of one of the
+// descriptorpb option messages. The extension is found in the parser's
+// resolver, so it must be registered before the file is parsed.
+func (p *parser) setCustomOption(options protoreflect.Message, name string, c constant) error {
+	extName := name[1 : len(name)-1]
+	xt, err := p.findExtension(extName)
+	if err == protoregistry.NotFound {
+		return c.errorf("unknown option %q: extension %s is not registered", name, extName)
+	} else if err != nil {
+		return c.errorf("option %q: %v", name, err)
+	}
+	xd := xt.TypeDescriptor()
+	if got, want := xd.ContainingMessage().FullName(), options.Descriptor().FullName(); got != want {
+		return c.errorf("option %q: extension of %s, not %s", name, got, want)
+	}
+
+	var list protoreflect.List
+	var value protoreflect.Value
+	if xd.IsList() {
+		list = options.Mutable(xd).List()
+		value = list.NewElement()
+	} else {
+		value = options.NewField(xd)
+	}
+	if xd.Message() != nil {
+		if !c.aggregate {
+			return c.errorf("option %q: expected aggregate value, got %s", name, c)
+		}
+		if err := prototext.Unmarshal([]byte(c.text), value.Message().Interface()); err != nil {
+			return c.errorf("option %q: %v", name, err)
+		}
+	} else {
+		if c.aggregate {
+			return c.errorf("option %q: aggregate values are only supported for message options", name)
+		}
+		value, err = c.value(xd)
+		if err != nil {
+			return c.errorf("option %q: %v", name, err)
+		}
+	}
+	if list != nil {
+		list.Append(value)
+	} else {
+		options.Set(xd, value)
+	}
+	return nil
+}
+
+// findExtension finds the extension of a custom option. Relative names are
+// resolved within the file's package and then each enclosing package, like
+// protoc resolves the names of options set outside of messages.
+func (p *parser) findExtension(name string) (protoreflect.ExtensionType, error) {
+	if strings.HasPrefix(name, ".") {
+		return p.resolver.FindExtensionByName(protoreflect.FullName(name[1:]))
+	}
+	scope := p.file.GetPackage()
+	for {
+		fullName := name
+		if scope != "" {
+			fullName = scope + "." + name
+		}
+		xt, err := p.resolver.FindExtensionByName(protoreflect.FullName(fullName))
+		if err != protoregistry.NotFound || scope == "" {
+			return xt, err
+		}
+		if idx := strings.LastIndex(scope, "."); idx >= 0 {
+			scope = scope[:idx]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+func (c constant) value(fd protoreflect.FieldDescriptor) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		v, err := c.bool()
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.EnumKind:
+		if c.kind != tokenIdent || c.negative {
+			return protoreflect.Value{}, fmt.Errorf("expected %s value, got %s", fd.Enum().Name(), c)
+		}
+		value := fd.Enum().Values().ByName(protoreflect.Name(c.text))
+		if value == nil {
+			return protoreflect.Value{}, fmt.Errorf("unknown %s value %s", fd.Enum().Name(), c.text)
+		}
+		return protoreflect.ValueOfEnum(value.Number()), nil
+	case protoreflect.StringKind:
+		if c.kind != tokenString {
+			return protoreflect.Value{}, fmt.Errorf("expected string, got %s", c)
+		}
+		return protoreflect.ValueOfString(c.text), nil
+	case protoreflect.BytesKind:
+		if c.kind != tokenString {
+			return protoreflect.Value{}, fmt.Errorf("expected string, got %s", c)
+		}
+		return protoreflect.ValueOfBytes([]byte(c.text)), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := c.int(math.MinInt32, math.MaxInt32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := c.int(math.MinInt64, math.MaxInt64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := c.uint(math.MaxUint32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := c.uint(math.MaxUint64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := c.float()
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := c.float()
+		return protoreflect.ValueOfFloat64(v), err
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
+
+func (c constant) bool() (bool, error) {
+	if c.kind == tokenIdent && !c.negative {
+		switch c.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("expected bool, got %s", c)
+}
+
+func (c constant) uint(max uint64) (uint64, error) {
+	if c.kind != tokenInt {
+		return 0, fmt.Errorf("expected integer, got %s", c)
+	}
+	v, err := strconv.ParseUint(c.text, 0, 64)
+	if err != nil || v > max || (c.negative && v != 0) {
+		return 0, fmt.Errorf("integer %s out of range", c)
+	}
+	return v, nil
+}
+
+func (c constant) int(min, max int64) (int64, error) {
+	if c.kind != tokenInt {
+		return 0, fmt.Errorf("expected integer, got %s", c)
+	}
+	v, err := strconv.ParseUint(c.text, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("integer %s out of range", c)
+	}
+	if c.negative {
+		if v > uint64(-(min+1))+1 {
+			return 0, fmt.Errorf("integer %s out of range", c)
+		}
+		return -int64(v-1) - 1, nil
+	}
+	if v > uint64(max) {
+		return 0, fmt.Errorf("integer %s out of range", c)
+	}
+	return int64(v), nil
+}
+
+func (c constant) float() (float64, error) {
+	var v float64
+	switch {
+	case c.kind == tokenInt:
+		u, err := strconv.ParseUint(c.text, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %s", c)
+		}
+		v = float64(u)
+	case c.kind == tokenFloat:
+		f, err := strconv.ParseFloat(c.text, 64)
+		if err != nil && !strings.Contains(err.Error(), "range") {
+			return 0, fmt.Errorf("invalid number %s", c)
+		}
+		v = f
+	case c.kind == tokenIdent && c.text == "inf":
+		v = math.Inf(1)
+	case c.kind == tokenIdent && c.text == "nan":
+		v = math.NaN()
+	default:
+		return 0, fmt.Errorf("expected number, got %s", c)
+	}
+	if c.negative {
+		v = -v
+	}
+	return v, nil
+}
+
+// defaultValue returns the text form of a field's default value, as stored
+// in FieldDescriptorProto.default_value.
+func (c constant) defaultValue(field *descriptorpb.FieldDescriptorProto) (string, error) {
+	if c.aggregate {
+		return "", c.errorf("invalid default value")
+	}
+	var err error
+	var text string
+	if field.Type == nil {
+		// Enum values are the only valid defaults of named types.
+		if c.kind != tokenIdent || c.negative {
+			return "", c.errorf("invalid default value: expected enum value, got %s", c)
+		}
+		return c.text, nil
+	}
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		if c.kind != tokenString {
+			err = fmt.Errorf("expected string, got %s", c)
+		}
+		text = c.text
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		if c.kind != tokenString {
+			err = fmt.Errorf("expected string, got %s", c)
+		}
+		text = escapeBytes(c.text)
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		var v bool
+		v, err = c.bool()
+		text = strconv.FormatBool(v)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		var v int64
+		v, err = c.int(math.MinInt32, math.MaxInt32)
+		text = strconv.FormatInt(v, 10)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		var v int64
+		v, err = c.int(math.MinInt64, math.MaxInt64)
+		text = strconv.FormatInt(v, 10)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		var v uint64
+		v, err = c.uint(math.MaxUint32)
+		text = strconv.FormatUint(v, 10)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		var v uint64
+		v, err = c.uint(math.MaxUint64)
+		text = strconv.FormatUint(v, 10)
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		var v float64
+		v, err = c.float()
+		switch {
+		case math.IsInf(v, 1):
+			text = "inf"
+		case math.IsInf(v, -1):
+			text = "-inf"
+		case math.IsNaN(v):
+			text = "nan"
+		default:
+			text = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	if err != nil {
+		return "", c.errorf("invalid default value: %v", err)
+	}
+	return text, nil
+}
+
+// escapeBytes escapes a bytes default value the way protoc does, using
+// octal escapes for non-printable bytes.
+func escapeBytes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\', c == '"', c == '\'':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "\\%03o", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,985 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package protoparse parses .proto source files into descriptors, so that
+// Protobuf schemas can be used without running protoc.
+//
+// Both the proto2 and proto3 syntaxes are supported, except for groups.
+// Custom options, which are written with parenthesized names, are set from
+// extensions that were registered before parsing: extensions declared by the
+// sources being parsed can't be used as options.
+package protoparse
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// Exclusive upper bounds of field and enum number ranges declared with
+	// the "max" keyword.
+	maxFieldNumber = 536870911
+	maxEnumNumber  = math.MaxInt32
+)
+
+var scalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+var labels = map[string]descriptorpb.FieldDescriptorProto_Label{
+	"optional": descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL,
+	"required": descriptorpb.FieldDescriptorProto_LABEL_REQUIRED,
+	"repeated": descriptorpb.FieldDescriptorProto_LABEL_REPEATED,
+}
+
+// An ExtensionResolver finds the extensions that custom options are set
+// from. It's implemented by *protoregistry.Types.
+type ExtensionResolver interface {
+	FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error)
+}
+
+// Parse parses the source of a .proto file. The returned descriptor has
+// not been validated, and type names are not resolved: it can be converted
+// into a protoreflect.FileDescriptor with protodesc.NewFile().
+//
+// Custom options are set from the extensions of resolver, or of
+// protoregistry.GlobalTypes if resolver is nil.
+func Parse(filename string, src []byte, resolver ExtensionResolver) (*descriptorpb.FileDescriptorProto, error) {
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+	p := &parser{
+		lex:      newLexer(filename, src),
+		resolver: resolver,
+		file: &descriptorpb.FileDescriptorProto{
+			Name: proto.String(filename),
+		},
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if err := p.parseFile(); err != nil {
+		return nil, err
+	}
+	return p.file, nil
+}
+
+type parser struct {
+	lex      *lexer
+	tok      token
+	file     *descriptorpb.FileDescriptorProto
+	proto3   bool
+	resolver ExtensionResolver
+}
+
+func (p *parser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.lex.errorf(p.tok.pos, format, args...)
+}
+
+func (p *parser) unexpected(want string) error {
+	return p.errorf("expected %s, got %s", want, p.tok)
+}
+
+func (p *parser) isPunct(s string) bool {
+	return p.tok.kind == tokenPunct && p.tok.text == s
+}
+
+func (p *parser) isIdent(s string) bool {
+	return p.tok.kind == tokenIdent && p.tok.text == s
+}
+
+// accept consumes the current token if it is the punctuation s.
+func (p *parser) accept(s string) (bool, error) {
+	if !p.isPunct(s) {
+		return false, nil
+	}
+	return true, p.next()
+}
+
+func (p *parser) expect(s string) error {
+	if !p.isPunct(s) {
+		return p.unexpected(strconv.Quote(s))
+	}
+	return p.next()
+}
+
+func (p *parser) expectKeyword(s string) error {
+	if !p.isIdent(s) {
+		return p.unexpected(strconv.Quote(s))
+	}
+	return p.next()
+}
+
+func (p *parser) ident() (string, error) {
+	if p.tok.kind != tokenIdent {
+		return "", p.unexpected("identifier")
+	}
+	text := p.tok.text
+	return text, p.next()
+}
+
+// fullIdent parses a dotted name, with an optional leading dot if
+// allowLeadingDot is set.
+func (p *parser) fullIdent(allowLeadingDot bool) (string, error) {
+	var b strings.Builder
+	if allowLeadingDot && p.isPunct(".") {
+		b.WriteString(".")
+		if err := p.next(); err != nil {
+			return "", err
+		}
+	}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(name)
+		if ok, err := p.accept("."); err != nil {
+			return "", err
+		} else if !ok {
+			return b.String(), nil
+		}
+		b.WriteString(".")
+	}
+}
+
+func (p *parser) stringLiteral() (string, error) {
+	if p.tok.kind != tokenString {
+		return "", p.unexpected("string")
+	}
+	var b strings.Builder
+	// Adjacent string literals are concatenated.
+	for p.tok.kind == tokenString {
+		b.WriteString(p.tok.text)
+		if err := p.next(); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// number parses an optionally signed integer within [min, max].
+func (p *parser) number(min, max int64) (int64, error) {
+	pos := p.tok.pos
+	negative := false
+	if p.isPunct("-") {
+		negative = true
+		if err := p.next(); err != nil {
+			return 0, err
+		}
+	}
+	if p.tok.kind != tokenInt {
+		return 0, p.unexpected("integer")
+	}
+	text := p.tok.text
+	v, err := strconv.ParseInt(text, 0, 64)
+	if negative {
+		v = -v
+	}
+	if err != nil || v < min || v > max {
+		return 0, p.lex.errorf(pos, "integer %s out of range [%d, %d]", text, min, max)
+	}
+	return v, p.next()
+}
+
+func (p *parser) parseFile() error {
+	if p.isIdent("syntax") {
+		if err := p.parseSyntax(); err != nil {
+			return err
+		}
+	} else if p.isIdent("edition") {
+		return p.errorf("editions are not supported")
+	}
+
+	for p.tok.kind != tokenEOF {
+		if ok, err := p.accept(";"); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+
+		var err error
+		switch {
+		case p.isIdent("import"):
+			err = p.parseImport()
+		case p.isIdent("package"):
+			err = p.parsePackage()
+		case p.isIdent("option"):
+			err = p.parseOptionStatement(func() protoreflect.Message {
+				if p.file.Options == nil {
+					p.file.Options = &descriptorpb.FileOptions{}
+				}
+				return p.file.Options.ProtoReflect()
+			})
+		case p.isIdent("message"):
+			var msg *descriptorpb.DescriptorProto
+			msg, err = p.parseMessage()
+			p.file.MessageType = append(p.file.MessageType, msg)
+		case p.isIdent("enum"):
+			var enum *descriptorpb.EnumDescriptorProto
+			enum, err = p.parseEnum()
+			p.file.EnumType = append(p.file.EnumType, enum)
+		case p.isIdent("extend"):
+			var fields []*descriptorpb.FieldDescriptorProto
+			fields, err = p.parseExtend()
+			p.file.Extension = append(p.file.Extension, fields...)
+		case p.isIdent("service"):
+			var service *descriptorpb.ServiceDescriptorProto
+			service, err = p.parseService()
+			p.file.Service = append(p.file.Service, service)
+		default:
+			err = p.unexpected("top-level declaration")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseSyntax() error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	pos := p.tok.pos
+	syntax, err := p.stringLiteral()
+	if err != nil {
+		return err
+	}
+	switch syntax {
+	case "proto2":
+	case "proto3":
+		p.proto3 = true
+		p.file.Syntax = proto.String(syntax)
+	default:
+		return p.lex.errorf(pos, "unknown syntax %q", syntax)
+	}
+	return p.expect(";")
+}
+
+func (p *parser) parseImport() error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	index := int32(len(p.file.Dependency))
+	if p.isIdent("public") {
+		p.file.PublicDependency = append(p.file.PublicDependency, index)
+		if err := p.next(); err != nil {
+			return err
+		}
+	} else if p.isIdent("weak") {
+		p.file.WeakDependency = append(p.file.WeakDependency, index)
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	path, err := p.stringLiteral()
+	if err != nil {
+		return err
+	}
+	p.file.Dependency = append(p.file.Dependency, path)
+	return p.expect(";")
+}
+
+func (p *parser) parsePackage() error {
+	if p.file.Package != nil {
+		return p.errorf("duplicate package declaration")
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	name, err := p.fullIdent(false)
+	if err != nil {
+		return err
+	}
+	p.file.Package = proto.String(name)
+	return p.expect(";")
+}
+
+func (p *parser) parseMessage() (*descriptorpb.DescriptorProto, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	msg := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	// Proto3 optional fields are placed in synthetic oneofs, which must
+	// follow all other oneofs of the message.
+	var syntheticOneofs []*descriptorpb.FieldDescriptorProto
+
+	for !p.isPunct("}") {
+		if ok, err := p.accept(";"); err != nil {
+			return nil, err
+		} else if ok {
+			continue
+		}
+
+		var err error
+		switch {
+		case p.tok.kind == tokenEOF:
+			return nil, p.unexpected(`"}"`)
+		case p.isIdent("option"):
+			err = p.parseOptionStatement(func() protoreflect.Message {
+				if msg.Options == nil {
+					msg.Options = &descriptorpb.MessageOptions{}
+				}
+				return msg.Options.ProtoReflect()
+			})
+		case p.isIdent("message"):
+			var nested *descriptorpb.DescriptorProto
+			nested, err = p.parseMessage()
+			msg.NestedType = append(msg.NestedType, nested)
+		case p.isIdent("enum"):
+			var enum *descriptorpb.EnumDescriptorProto
+			enum, err = p.parseEnum()
+			msg.EnumType = append(msg.EnumType, enum)
+		case p.isIdent("extend"):
+			var fields []*descriptorpb.FieldDescriptorProto
+			fields, err = p.parseExtend()
+			msg.Extension = append(msg.Extension, fields...)
+		case p.isIdent("extensions"):
+			err = p.parseExtensions(msg)
+		case p.isIdent("reserved"):
+			err = p.parseReserved(
+				maxFieldNumber,
+				func(start, end int32) {
+					msg.ReservedRange = append(msg.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+						Start: proto.Int32(start),
+						End:   proto.Int32(end + 1),
+					})
+				},
+				func(name string) { msg.ReservedName = append(msg.ReservedName, name) },
+			)
+		case p.isIdent("oneof"):
+			err = p.parseOneof(msg)
+		case p.isIdent("map"):
+			err = p.parseMapField(msg)
+		default:
+			var field *descriptorpb.FieldDescriptorProto
+			field, err = p.parseField(false)
+			if field != nil {
+				msg.Field = append(msg.Field, field)
+				if field.GetProto3Optional() {
+					syntheticOneofs = append(syntheticOneofs, field)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range syntheticOneofs {
+		field.OneofIndex = proto.Int32(int32(len(msg.OneofDecl)))
+		msg.OneofDecl = append(msg.OneofDecl, &descriptorpb.OneofDescriptorProto{
+			Name: proto.String(syntheticOneofName(msg, field.GetName())),
+		})
+	}
+	return msg, p.next()
+}
+
+// syntheticOneofName returns the name protoc gives to the oneof of a proto3
+// optional field, avoiding conflicts with other names in the message.
+func syntheticOneofName(msg *descriptorpb.DescriptorProto, fieldName string) string {
+	name := "_" + fieldName
+	for {
+		conflict := false
+		for _, field := range msg.Field {
+			conflict = conflict || field.GetName() == name
+		}
+		for _, oneof := range msg.OneofDecl {
+			conflict = conflict || oneof.GetName() == name
+		}
+		if !conflict {
+			return name
+		}
+		name = "X" + name
+	}
+}
+
+// parseField parses a field declaration. Fields of oneofs have no label.
+func (p *parser) parseField(inOneof bool) (*descriptorpb.FieldDescriptorProto, error) {
+	field := &descriptorpb.FieldDescriptorProto{}
+	if label, ok := labels[p.tok.text]; ok && p.tok.kind == tokenIdent && !inOneof {
+		switch {
+		case p.proto3 && label == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+			return nil, p.errorf("required fields are not allowed in proto3")
+		case p.proto3 && label == descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
+			field.Proto3Optional = proto.Bool(true)
+		}
+		field.Label = label.Enum()
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	} else if inOneof || p.proto3 {
+		field.Label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	} else {
+		return nil, p.unexpected("field label")
+	}
+
+	if p.isIdent("group") {
+		return nil, p.errorf("groups are not supported")
+	}
+	if err := p.parseFieldType(field); err != nil {
+		return nil, err
+	}
+	if err := p.parseFieldNameAndNumber(field); err != nil {
+		return nil, err
+	}
+	return field, p.expect(";")
+}
+
+func (p *parser) parseFieldType(field *descriptorpb.FieldDescriptorProto) error {
+	if t, ok := scalarTypes[p.tok.text]; ok && p.tok.kind == tokenIdent {
+		field.Type = t.Enum()
+		return p.next()
+	}
+	// Named types may be messages or enums, which is determined when the
+	// name is resolved.
+	name, err := p.fullIdent(true)
+	if err != nil {
+		return err
+	}
+	field.TypeName = proto.String(name)
+	return nil
+}
+
+func (p *parser) parseFieldNameAndNumber(field *descriptorpb.FieldDescriptorProto) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	field.Name = proto.String(name)
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	number, err := p.number(1, maxFieldNumber)
+	if err != nil {
+		return err
+	}
+	field.Number = proto.Int32(int32(number))
+	return p.parseFieldOptions(field)
+}
+
+func (p *parser) parseFieldOptions(field *descriptorpb.FieldDescriptorProto) error {
+	return p.parseCompactOptions(func(name string, c constant) error {
+		switch name {
+		case "default":
+			value, err := c.defaultValue(field)
+			if err != nil {
+				return err
+			}
+			field.DefaultValue = proto.String(value)
+			return nil
+		case "json_name":
+			if c.kind != tokenString {
+				return c.errorf("json_name must be a string")
+			}
+			field.JsonName = proto.String(c.text)
+			return nil
+		}
+		if field.Options == nil {
+			field.Options = &descriptorpb.FieldOptions{}
+		}
+		return p.setOption(field.Options.ProtoReflect(), name, c)
+	})
+}
+
+func (p *parser) parseMapField(msg *descriptorpb.DescriptorProto) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	if err := p.expect("<"); err != nil {
+		return err
+	}
+	key := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String("key"),
+		Number: proto.Int32(1),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	keyPos := p.tok.pos
+	if err := p.parseFieldType(key); err != nil {
+		return err
+	}
+	switch {
+	case key.Type == nil,
+		key.GetType() == descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+		key.GetType() == descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+		key.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return p.lex.errorf(keyPos, "invalid map key type")
+	}
+	if err := p.expect(","); err != nil {
+		return err
+	}
+	value := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String("value"),
+		Number: proto.Int32(2),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	if err := p.parseFieldType(value); err != nil {
+		return err
+	}
+	if err := p.expect(">"); err != nil {
+		return err
+	}
+
+	field := &descriptorpb.FieldDescriptorProto{
+		Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+	}
+	if err := p.parseFieldNameAndNumber(field); err != nil {
+		return err
+	}
+	entryName := mapEntryName(field.GetName())
+	field.TypeName = proto.String(entryName)
+	msg.Field = append(msg.Field, field)
+	msg.NestedType = append(msg.NestedType, &descriptorpb.DescriptorProto{
+		Name:    proto.String(entryName),
+		Field:   []*descriptorpb.FieldDescriptorProto{key, value},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	})
+	return p.expect(";")
+}
+
+// mapEntryName returns the name of the synthetic message type holding the
+// entries of a map field, following protoc.
+func mapEntryName(fieldName string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range fieldName {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString("Entry")
+	return b.String()
+}
+
+func (p *parser) parseOneof(msg *descriptorpb.DescriptorProto) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	oneof := &descriptorpb.OneofDescriptorProto{Name: proto.String(name)}
+	index := int32(len(msg.OneofDecl))
+	msg.OneofDecl = append(msg.OneofDecl, oneof)
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.isPunct("}") {
+		if ok, err := p.accept(";"); err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+
+		switch {
+		case p.tok.kind == tokenEOF:
+			return p.unexpected(`"}"`)
+		case p.isIdent("option"):
+			err := p.parseOptionStatement(func() protoreflect.Message {
+				if oneof.Options == nil {
+					oneof.Options = &descriptorpb.OneofOptions{}
+				}
+				return oneof.Options.ProtoReflect()
+			})
+			if err != nil {
+				return err
+			}
+		default:
+			field, err := p.parseField(true)
+			if err != nil {
+				return err
+			}
+			field.OneofIndex = proto.Int32(index)
+			msg.Field = append(msg.Field, field)
+		}
+	}
+	return p.next()
+}
+
+func (p *parser) parseExtensions(msg *descriptorpb.DescriptorProto) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	var ranges []*descriptorpb.DescriptorProto_ExtensionRange
+	for {
+		start, end, err := p.parseRange(maxFieldNumber)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, &descriptorpb.DescriptorProto_ExtensionRange{
+			Start: proto.Int32(start),
+			End:   proto.Int32(end + 1),
+		})
+		if ok, err := p.accept(","); err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+	}
+
+	var options *descriptorpb.ExtensionRangeOptions
+	err := p.parseCompactOptions(func(name string, c constant) error {
+		if options == nil {
+			options = &descriptorpb.ExtensionRangeOptions{}
+		}
+		return p.setOption(options.ProtoReflect(), name, c)
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		r.Options = options
+	}
+	msg.ExtensionRange = append(msg.ExtensionRange, ranges...)
+	return p.expect(";")
+}
+
+// parseRange parses a number range such as "5", "5 to 10", or "5 to max".
+// The returned end is inclusive.
+func (p *parser) parseRange(max int64) (int32, int32, error) {
+	min := int64(1)
+	if max == maxEnumNumber {
+		min = math.MinInt32
+	}
+	start, err := p.number(min, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !p.isIdent("to") {
+		return int32(start), int32(start), nil
+	}
+	if err := p.next(); err != nil {
+		return 0, 0, err
+	}
+	if p.isIdent("max") {
+		return int32(start), int32(max), p.next()
+	}
+	end, err := p.number(start, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int32(start), int32(end), nil
+}
+
+// parseReserved parses reserved number ranges, with inclusive ends, or
+// reserved names.
+func (p *parser) parseReserved(max int64, addRange func(start, end int32), addName func(string)) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	for {
+		if p.tok.kind == tokenString {
+			name, err := p.stringLiteral()
+			if err != nil {
+				return err
+			}
+			addName(name)
+		} else {
+			start, end, err := p.parseRange(max)
+			if err != nil {
+				return err
+			}
+			addRange(start, end)
+		}
+		if ok, err := p.accept(","); err != nil {
+			return err
+		} else if !ok {
+			return p.expect(";")
+		}
+	}
+}
+
+func (p *parser) parseEnum() (*descriptorpb.EnumDescriptorProto, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	enum := &descriptorpb.EnumDescriptorProto{Name: proto.String(name)}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.isPunct("}") {
+		if ok, err := p.accept(";"); err != nil {
+			return nil, err
+		} else if ok {
+			continue
+		}
+
+		var err error
+		switch {
+		case p.tok.kind == tokenEOF:
+			return nil, p.unexpected(`"}"`)
+		case p.isIdent("option"):
+			err = p.parseOptionStatement(func() protoreflect.Message {
+				if enum.Options == nil {
+					enum.Options = &descriptorpb.EnumOptions{}
+				}
+				return enum.Options.ProtoReflect()
+			})
+		case p.isIdent("reserved"):
+			err = p.parseReserved(
+				maxEnumNumber,
+				func(start, end int32) {
+					enum.ReservedRange = append(enum.ReservedRange, &descriptorpb.EnumDescriptorProto_EnumReservedRange{
+						Start: proto.Int32(start),
+						End:   proto.Int32(end),
+					})
+				},
+				func(name string) { enum.ReservedName = append(enum.ReservedName, name) },
+			)
+		default:
+			var value *descriptorpb.EnumValueDescriptorProto
+			value, err = p.parseEnumValue()
+			enum.Value = append(enum.Value, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return enum, p.next()
+}
+
+func (p *parser) parseEnumValue() (*descriptorpb.EnumValueDescriptorProto, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	number, err := p.number(math.MinInt32, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	value := &descriptorpb.EnumValueDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(int32(number)),
+	}
+	err = p.parseCompactOptions(func(name string, c constant) error {
+		if value.Options == nil {
+			value.Options = &descriptorpb.EnumValueOptions{}
+		}
+		return p.setOption(value.Options.ProtoReflect(), name, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, p.expect(";")
+}
+
+func (p *parser) parseExtend() ([]*descriptorpb.FieldDescriptorProto, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	extendee, err := p.fullIdent(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []*descriptorpb.FieldDescriptorProto
+	for !p.isPunct("}") {
+		if ok, err := p.accept(";"); err != nil {
+			return nil, err
+		} else if ok {
+			continue
+		}
+		if p.tok.kind == tokenEOF {
+			return nil, p.unexpected(`"}"`)
+		}
+		field, err := p.parseField(false)
+		if err != nil {
+			return nil, err
+		}
+		// Extensions never have synthetic oneofs.
+		field.Proto3Optional = nil
+		field.Extendee = proto.String(extendee)
+		fields = append(fields, field)
+	}
+	return fields, p.next()
+}
+
+func (p *parser) parseService() (*descriptorpb.ServiceDescriptorProto, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	service := &descriptorpb.ServiceDescriptorProto{Name: proto.String(name)}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.isPunct("}") {
+		if ok, err := p.accept(";"); err != nil {
+			return nil, err
+		} else if ok {
+			continue
+		}
+
+		var err error
+		switch {
+		case p.tok.kind == tokenEOF:
+			return nil, p.unexpected(`"}"`)
+		case p.isIdent("option"):
+			err = p.parseOptionStatement(func() protoreflect.Message {
+				if service.Options == nil {
+					service.Options = &descriptorpb.ServiceOptions{}
+				}
+				return service.Options.ProtoReflect()
+			})
+		case p.isIdent("rpc"):
+			var method *descriptorpb.MethodDescriptorProto
+			method, err = p.parseMethod()
+			service.Method = append(service.Method, method)
+		default:
+			err = p.unexpected(`"rpc"`)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return service, p.next()
+}
+
+func (p *parser) parseMethod() (*descriptorpb.MethodDescriptorProto, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	method := &descriptorpb.MethodDescriptorProto{Name: proto.String(name)}
+
+	parseType := func() (string, bool, error) {
+		if err := p.expect("("); err != nil {
+			return "", false, err
+		}
+		stream := false
+		if p.isIdent("stream") {
+			stream = true
+			if err := p.next(); err != nil {
+				return "", false, err
+			}
+		}
+		typeName, err := p.fullIdent(true)
+		if err != nil {
+			return "", false, err
+		}
+		return typeName, stream, p.expect(")")
+	}
+
+	inputType, clientStreaming, err := parseType()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("returns"); err != nil {
+		return nil, err
+	}
+	outputType, serverStreaming, err := parseType()
+	if err != nil {
+		return nil, err
+	}
+	method.InputType = proto.String(inputType)
+	method.OutputType = proto.String(outputType)
+	if clientStreaming {
+		method.ClientStreaming = proto.Bool(true)
+	}
+	if serverStreaming {
+		method.ServerStreaming = proto.Bool(true)
+	}
+
+	if ok, err := p.accept("{"); err != nil {
+		return nil, err
+	} else if !ok {
+		return method, p.expect(";")
+	}
+	for !p.isPunct("}") {
+		if ok, err := p.accept(";"); err != nil {
+			return nil, err
+		} else if ok {
+			continue
+		}
+		if !p.isIdent("option") {
+			return nil, p.unexpected(`"option"`)
+		}
+		err := p.parseOptionStatement(func() protoreflect.Message {
+			if method.Options == nil {
+				method.Options = &descriptorpb.MethodOptions{}
+			}
+			return method.Options.ProtoReflect()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return method, p.next()
+}
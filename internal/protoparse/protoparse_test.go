@@ -0,0 +1,409 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package protoparse
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	pb "github.com/stripe/skycfg/internal/testdata/test_proto"
+)
+
+// resolve builds a file from a parsed descriptor, resolving type names
+// against the compiled-in files, and converts it back to a descriptor.
+func resolve(t *testing.T, fileProto *descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorProto {
+	t.Helper()
+	file, err := protodesc.NewFile(fileProto, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("protodesc.NewFile: %v", err)
+	}
+	return protodesc.ToFileDescriptorProto(file)
+}
+
+func clearJSONNames(fields []*descriptorpb.FieldDescriptorProto, msgs []*descriptorpb.DescriptorProto) {
+	for _, field := range fields {
+		field.JsonName = nil
+	}
+	for _, msg := range msgs {
+		clearJSONNames(msg.Field, nil)
+		clearJSONNames(msg.Extension, msg.NestedType)
+	}
+}
+
+func TestParseMatchesProtoc(t *testing.T) {
+	for _, file := range []protoreflect.FileDescriptor{
+		(&pb.MessageV2{}).ProtoReflect().Descriptor().ParentFile(),
+		(&pb.MessageV3{}).ProtoReflect().Descriptor().ParentFile(),
+	} {
+		t.Run(file.Path(), func(t *testing.T) {
+			src, err := ioutil.ReadFile(filepath.Join("../testdata/test_proto", filepath.Base(file.Path())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := Parse(file.Path(), src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := resolve(t, parsed)
+			want := protodesc.ToFileDescriptorProto(file)
+			// protoc sets the JSON name of every field.
+			clearJSONNames(got.Extension, got.MessageType)
+			clearJSONNames(want.Extension, want.MessageType)
+			if !proto.Equal(got, want) {
+				t.Errorf("parsed descriptor differs from protoc output\ngot:  %s\nwant: %s",
+					prototext.Format(got), prototext.Format(want))
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	src := `
+// Leading comment.
+syntax = "proto3";
+
+package example.v1;
+
+import public "google/protobuf/duration.proto";
+
+option java_package = "com.example" "." "v1";
+option optimize_for = SPEED;
+
+/* Block comment. */
+message Config {
+  option deprecated = true;
+
+  reserved 4, 8 to 10, 20 to max;
+  reserved "legacy";
+
+  string name = 1 [json_name = "displayName"];
+  optional int32 limit = 2;
+  repeated google.protobuf.Duration timeouts = 3;
+  map<string, Endpoint> endpoints = 5;
+  oneof target {
+    string host = 6;
+    .example.v1.Config.Endpoint endpoint = 7 [deprecated = true];
+  }
+
+  message Endpoint {
+    uint32 port = 1;
+    Protocol protocol = 2;
+  }
+
+  enum Protocol {
+    option allow_alias = true;
+    reserved 10 to max;
+    PROTOCOL_UNSPECIFIED = 0;
+    TCP = 1;
+    STREAM = 1 [deprecated = true];
+    UDP = -2;
+  }
+}
+
+service ConfigService {
+  rpc Get(Config) returns (Config);
+  rpc Watch(stream Config) returns (stream Config) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+}
+`
+	parsed, err := Parse("example.proto", []byte(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resolve(t, parsed)
+
+	want := &descriptorpb.FileDescriptorProto{}
+	err = prototext.Unmarshal([]byte(`
+name: "example.proto"
+package: "example.v1"
+dependency: "google/protobuf/duration.proto"
+public_dependency: 0
+syntax: "proto3"
+options {
+  java_package: "com.example.v1"
+  optimize_for: SPEED
+}
+message_type {
+  name: "Config"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "displayName" }
+  field { name: "limit" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 1 proto3_optional: true }
+  field { name: "timeouts" number: 3 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".google.protobuf.Duration" }
+  field { name: "endpoints" number: 5 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".example.v1.Config.EndpointsEntry" }
+  field { name: "host" number: 6 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+  field {
+    name: "endpoint" number: 7 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".example.v1.Config.Endpoint"
+    oneof_index: 0 options { deprecated: true }
+  }
+  nested_type {
+    name: "EndpointsEntry"
+    field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".example.v1.Config.Endpoint" }
+    options { map_entry: true }
+  }
+  nested_type {
+    name: "Endpoint"
+    field { name: "port" number: 1 label: LABEL_OPTIONAL type: TYPE_UINT32 }
+    field { name: "protocol" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".example.v1.Config.Protocol" }
+  }
+  enum_type {
+    name: "Protocol"
+    value { name: "PROTOCOL_UNSPECIFIED" number: 0 }
+    value { name: "TCP" number: 1 }
+    value { name: "STREAM" number: 1 options { deprecated: true } }
+    value { name: "UDP" number: -2 }
+    options { allow_alias: true }
+    reserved_range { start: 10 end: 2147483647 }
+  }
+  oneof_decl { name: "target" }
+  oneof_decl { name: "_limit" }
+  options { deprecated: true }
+  reserved_range { start: 4 end: 5 }
+  reserved_range { start: 8 end: 11 }
+  reserved_range { start: 20 end: 536870912 }
+  reserved_name: "legacy"
+}
+service {
+  name: "ConfigService"
+  method { name: "Get" input_type: ".example.v1.Config" output_type: ".example.v1.Config" }
+  method {
+    name: "Watch" input_type: ".example.v1.Config" output_type: ".example.v1.Config"
+    options { idempotency_level: NO_SIDE_EFFECTS }
+    client_streaming: true
+    server_streaming: true
+  }
+}
+`), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Parse() mismatch\ngot:  %s\nwant: %s", prototext.Format(got), prototext.Format(want))
+	}
+}
+
+func TestParseProto2(t *testing.T) {
+	src := `
+package example;
+
+message Limits {
+  required int32 count = 1 [default = -0x10];
+  optional double ratio = 2 [default = -inf];
+  optional bytes magic = 3 [default = "\x00\x01ab"];
+  optional Mode mode = 4 [default = FAST];
+  extensions 100 to 199, 1000 to max;
+}
+
+enum Mode {
+  SLOW = 0;
+  FAST = 1;
+}
+
+extend Limits {
+  optional string note = 100;
+}
+`
+	parsed, err := Parse("limits.proto", []byte(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resolve(t, parsed)
+
+	want := &descriptorpb.FileDescriptorProto{}
+	err = prototext.Unmarshal([]byte(`
+name: "limits.proto"
+package: "example"
+message_type {
+  name: "Limits"
+  field { name: "count" number: 1 label: LABEL_REQUIRED type: TYPE_INT32 default_value: "-16" }
+  field { name: "ratio" number: 2 label: LABEL_OPTIONAL type: TYPE_DOUBLE default_value: "-inf" }
+  field { name: "magic" number: 3 label: LABEL_OPTIONAL type: TYPE_BYTES default_value: "\\000\\001ab" }
+  field { name: "mode" number: 4 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".example.Mode" default_value: "FAST" }
+  extension_range { start: 100 end: 200 }
+  extension_range { start: 1000 end: 536870912 }
+}
+enum_type {
+  name: "Mode"
+  value { name: "SLOW" number: 0 }
+  value { name: "FAST" number: 1 }
+}
+extension { name: "note" number: 100 label: LABEL_OPTIONAL type: TYPE_STRING extendee: ".example.Limits" }
+`), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Parse() mismatch\ngot:  %s\nwant: %s", prototext.Format(got), prototext.Format(want))
+	}
+}
+
+func TestParseCustomOptions(t *testing.T) {
+	custom, err := Parse("custom.proto", []byte(`
+syntax = "proto2";
+package custom;
+import "google/protobuf/descriptor.proto";
+
+message Info {
+  optional string name = 1;
+  repeated int32 ids = 2;
+}
+
+extend google.protobuf.FileOptions {
+  optional Info file_option = 50000;
+}
+
+extend google.protobuf.FieldOptions {
+  repeated string field_option = 50000;
+}
+`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customFile, err := protodesc.NewFile(custom, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := &protoregistry.Types{}
+	for ii := 0; ii < customFile.Extensions().Len(); ii++ {
+		if err := types.RegisterExtension(dynamicpb.NewExtensionType(customFile.Extensions().Get(ii))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Parse("example.proto", []byte(`
+syntax = "proto3";
+package custom.example;
+import "custom.proto";
+
+option (file_option) = { name: "example" ids: [1, 2] };
+
+message Config {
+  string name = 1 [(custom.field_option) = "a", (.custom.field_option) = "b"];
+}
+`), types)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &descriptorpb.FileDescriptorProto{}
+	err = prototext.UnmarshalOptions{Resolver: types}.Unmarshal([]byte(`
+name: "example.proto"
+package: "custom.example"
+dependency: "custom.proto"
+syntax: "proto3"
+options {
+  [custom.file_option] { name: "example" ids: [1, 2] }
+}
+message_type {
+  name: "Config"
+  field {
+    name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING
+    options { [custom.field_option]: ["a", "b"] }
+  }
+}
+`), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Parse() mismatch\ngot:  %s\nwant: %s", prototext.Format(got), prototext.Format(want))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{
+			src:     `syntax = "proto4";`,
+			wantErr: `test.proto:1:10: unknown syntax "proto4"`,
+		},
+		{
+			src:     "message A {\n  int32 a = 1;\n}",
+			wantErr: `test.proto:2:3: expected field label, got "int32"`,
+		},
+		{
+			src:     "syntax = \"proto3\";\nmessage A { required int32 a = 1; }",
+			wantErr: `test.proto:2:13: required fields are not allowed in proto3`,
+		},
+		{
+			src:     "message A { optional group G = 1 {} }",
+			wantErr: `test.proto:1:22: groups are not supported`,
+		},
+		{
+			src:     "message A { optional int32 a = 0; }",
+			wantErr: `test.proto:1:32: integer 0 out of range [1, 536870911]`,
+		},
+		{
+			src:     "message A { map<float, string> m = 1; }",
+			wantErr: `test.proto:1:17: invalid map key type`,
+		},
+		{
+			src:     `option no_such_option = true;`,
+			wantErr: `test.proto:1:25: unknown option "no_such_option"`,
+		},
+		{
+			src:     `option optimize_for = FASTEST;`,
+			wantErr: `test.proto:1:23: option "optimize_for": unknown OptimizeMode value FASTEST`,
+		},
+		{
+			src:     `option (no.such_option) = 1;`,
+			wantErr: `test.proto:1:27: unknown option "(no.such_option)": extension no.such_option is not registered`,
+		},
+		{
+			src:     `package skycfg.test_proto; option (rule) = "x";`,
+			wantErr: `test.proto:1:44: option "(rule)": extension of google.protobuf.FieldOptions, not google.protobuf.FileOptions`,
+		},
+		{
+			src:     `option (a).b = 1;`,
+			wantErr: `test.proto:1:8: unsupported option "(a).b"`,
+		},
+		{
+			src:     "message A {\n  optional int32 a = 1 [default = \"x\"];\n}",
+			wantErr: `test.proto:2:35: invalid default value: expected integer, got "x"`,
+		},
+		{
+			src:     `message A { optional string s = 1; `,
+			wantErr: `test.proto:1:36: expected "}", got end of file`,
+		},
+		{
+			src:     `message A { optional string s = 1 }`,
+			wantErr: `test.proto:1:35: expected ";", got "}"`,
+		},
+	}
+	for _, test := range tests {
+		_, err := Parse("test.proto", []byte(test.src), nil)
+		if err == nil {
+			t.Errorf("Parse(%q): expected error %q", test.src, test.wantErr)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("Parse(%q): got error %q, want %q", test.src, err, test.wantErr)
+		}
+	}
+}
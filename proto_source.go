@@ -0,0 +1,165 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package skycfg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/stripe/skycfg/go/protomodule"
+	"github.com/stripe/skycfg/internal/protoparse"
+)
+
+// A ProtoFileReader reads .proto source files by their import path, such as
+// "google/protobuf/duration.proto".
+type ProtoFileReader interface {
+	ReadProtoFile(ctx context.Context, importPath string) ([]byte, error)
+}
+
+type localProtoFileReader struct {
+	importPaths []string
+}
+
+// LocalProtoFileReader returns a ProtoFileReader that searches for .proto
+// files within filesystem directories, in order, like the -I flag of protoc.
+func LocalProtoFileReader(importPaths ...string) ProtoFileReader {
+	if len(importPaths) == 0 {
+		panic("LocalProtoFileReader: no import paths")
+	}
+	return &localProtoFileReader{importPaths}
+}
+
+func (r *localProtoFileReader) ReadProtoFile(ctx context.Context, importPath string) ([]byte, error) {
+	if path.IsAbs(importPath) || path.Clean(importPath) != importPath || strings.HasPrefix(importPath, "../") {
+		return nil, fmt.Errorf("%s: invalid import path", importPath)
+	}
+	for _, dir := range r.importPaths {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(importPath)))
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%s: not found in import paths %q", importPath, r.importPaths)
+}
+
+// NewProtoSourceRegistry returns a Protobuf registry containing the types
+// defined by .proto source files, in addition to the compiled types of
+// protoregistry.GlobalTypes. Files are named by import path, and their
+// imports are read from the same ProtoFileReader.
+//
+// Imports of files that are linked into the binary, such as the well-known
+// types, use the compiled descriptors and aren't read. Other types are
+// implemented with dynamicpb, so they can be used with proto.package()
+// without running protoc.
+//
+// Custom options are set from extensions already in the registry, such as
+// those linked into the binary: extensions declared by the files themselves
+// can't be used as options. Groups are not supported.
+func NewProtoSourceRegistry(ctx context.Context, reader ProtoFileReader, files ...string) (unstableProtoRegistryV2, error) {
+	registry := copyProtoTypes(protoregistry.GlobalTypes)
+	if err := registerProtoSources(ctx, registry, reader, files); err != nil {
+		return nil, fmt.Errorf("NewProtoSourceRegistry: %w", err)
+	}
+	return NewUnstableProtobufRegistryV2(registry), nil
+}
+
+// WithProtoSourceFiles adds the types defined by .proto source files to the
+// Protobuf registry used when loading a Skycfg config, as with
+// NewProtoSourceRegistry. Types are added to the registry set by
+// WithProtoRegistry, or protoregistry.GlobalTypes if no registry was set.
+// Custom options are set from extensions already in that registry, and
+// groups are not supported.
+//
+// Errors reading or parsing the files are returned by Load.
+func WithProtoSourceFiles(reader ProtoFileReader, files ...string) LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.protoSources = append(opts.protoSources, protoSourceFiles{reader, files})
+	})
+}
+
+type protoSourceFiles struct {
+	reader ProtoFileReader
+	files  []string
+}
+
+// loadProtoSources returns a copy of base, with the types defined by each
+// group of .proto source files added.
+func loadProtoSources(ctx context.Context, base unstableProtoRegistryV2, sources []protoSourceFiles) (unstableProtoRegistryV2, error) {
+	baseTypes := protoregistry.GlobalTypes
+	if base != nil {
+		baseTypes = base.UnstableProtobufTypes()
+	}
+	registry := copyProtoTypes(baseTypes)
+	for _, source := range sources {
+		if err := registerProtoSources(ctx, registry, source.reader, source.files); err != nil {
+			return nil, err
+		}
+	}
+	return NewUnstableProtobufRegistryV2(registry), nil
+}
+
+func registerProtoSources(ctx context.Context, registry *protoregistry.Types, reader ProtoFileReader, files []string) error {
+	set := &descriptorpb.FileDescriptorSet{}
+	parsed := make(map[string]bool)
+	var parse func(importPath, importedBy string) error
+	parse = func(importPath, importedBy string) error {
+		if parsed[importPath] {
+			return nil
+		}
+		parsed[importPath] = true
+		if protoparse.IsLinked(importPath) {
+			return nil
+		}
+
+		src, err := reader.ReadProtoFile(ctx, importPath)
+		if err != nil {
+			if importedBy != "" {
+				return fmt.Errorf("%w (imported by %s)", err, importedBy)
+			}
+			return err
+		}
+		file, err := protoparse.Parse(importPath, src, registry)
+		if err != nil {
+			return err
+		}
+		set.File = append(set.File, file)
+		for _, dep := range file.GetDependency() {
+			if err := parse(dep, importPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, importPath := range files {
+		if err := parse(importPath, ""); err != nil {
+			return err
+		}
+	}
+	return protomodule.RegisterDescriptorSet(registry, set)
+}
@@ -26,18 +26,21 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkjson"
 	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 
 	"github.com/stripe/skycfg/go/assertmodule"
 	"github.com/stripe/skycfg/go/hashmodule"
+	"github.com/stripe/skycfg/go/mockmodule"
 	"github.com/stripe/skycfg/go/protomodule"
 	"github.com/stripe/skycfg/go/urlmodule"
 	"github.com/stripe/skycfg/go/yamlmodule"
@@ -47,6 +50,7 @@ import (
 const (
 	contextKey   = "context"   // has type context.Context
 	logOutputKey = "logoutput" // has type io.Writer
+	coverageKey  = "coverage"  // has type *Coverage
 )
 
 // A FileReader controls how load() calls resolve and read other modules.
@@ -113,14 +117,16 @@ func NewProtoPackage(r unstableProtoRegistryV2, name string) starlark.Value {
 // A Config is a Skycfg config file that has been fully loaded and is ready
 // for execution.
 type Config struct {
-	filename string
-	globals  starlark.StringDict
-	locals   starlark.StringDict
-	tests    []*Test
+	filename     string
+	globals      starlark.StringDict
+	locals       starlark.StringDict
+	tests        []*Test
+	instrumented *instrumentedModules
 }
 
 type commonOptions struct {
 	logOutput io.Writer
+	coverage  *Coverage
 }
 
 // A CommonOption is an option that can be applied to Load, Config.Main, and Test.Run.
@@ -159,9 +165,28 @@ type LoadOption interface {
 
 type loadOptions struct {
 	commonOptions
-	globals       starlark.StringDict
-	fileReader    FileReader
-	protoRegistry unstableProtoRegistryV2
+	globals        starlark.StringDict
+	userGlobals    starlark.StringDict
+	fileReader     FileReader
+	protoRegistry  unstableProtoRegistryV2
+	protoDefaults  []proto.Message
+	protoOpts      []protomodule.ModuleOption
+	rootTestsOnly  bool
+	testPathPrefix string
+	fieldPositions bool
+	// Set when loading modules for a test, which can't register defaults.
+	fixedDefaults bool
+
+	descriptorSetFiles []string
+	protoSources       []protoSourceFiles
+
+	// Set when loading with coverage enabled, and shared with copies of
+	// the options used to execute modules for tests.
+	instrumented *instrumentedModules
+
+	// Set when executing the module of a test again, whose path was
+	// already resolved.
+	rootResolved bool
 }
 
 type fnLoadOption func(*loadOptions)
@@ -189,6 +214,22 @@ func WithFileReader(r FileReader) LoadOption {
 	})
 }
 
+// WithRootTestsOnly restricts Config.Tests() to test functions defined in the
+// top-level config module, ignoring tests in modules it loads.
+func WithRootTestsOnly() LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.rootTestsOnly = true
+	})
+}
+
+// WithTestPathPrefix restricts Config.Tests() to test functions defined in
+// modules whose path, as returned by FileReader.Resolve(), starts with prefix.
+func WithTestPathPrefix(prefix string) LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.testPathPrefix = prefix
+	})
+}
+
 type unstableProtoRegistryV2 interface {
 	// UNSTABLE go-protobuf v2 type registry
 	UnstableProtobufTypes() *protoregistry.Types
@@ -219,6 +260,34 @@ func WithProtoRegistry(r unstableProtoRegistryV2) LoadOption {
 	})
 }
 
+// WithProtoDefaults registers default field values for Protobuf message
+// types. Messages of each given message's type that are constructed by the
+// config start with copies of its set fields, and proto.set_defaults() sets
+// any of them that are unset.
+func WithProtoDefaults(msgs ...proto.Message) LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.protoDefaults = append(opts.protoDefaults, msgs...)
+	})
+}
+
+// WithProtoEnumConversion allows enum fields of Protobuf messages to be
+// assigned the name or number of an enum value, such as "FOO" or 3, in
+// addition to the value itself.
+func WithProtoEnumConversion() LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.protoOpts = append(opts.protoOpts, protomodule.WithEnumConversion())
+	})
+}
+
+// WithProtoStructValues causes fields of type google.protobuf.Struct, Value,
+// and ListValue to be read as plain Starlark dicts, lists, and scalars, the
+// same values they can be assigned. By default they're read as messages.
+func WithProtoStructValues() LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.protoOpts = append(opts.protoOpts, protomodule.WithStructValues())
+	})
+}
+
 // UnstablePredeclaredModules returns a Starlark string dictionary with
 // predeclared Skycfg modules which can be used in starlark.ExecFile.
 //
@@ -234,11 +303,15 @@ func WithProtoRegistry(r unstableProtoRegistryV2) LoadOption {
 //   - yaml   - same as "json" package but for YAML.
 //   - url    - utility package for encoding URL query string.
 func UnstablePredeclaredModules(r unstableProtoRegistryV2) starlark.StringDict {
+	return predeclaredModules(r)
+}
+
+func predeclaredModules(r unstableProtoRegistryV2, protoOpts ...protomodule.ModuleOption) starlark.StringDict {
 	return starlark.StringDict{
 		"fail":   assertmodule.Fail,
 		"hash":   hashmodule.NewModule(),
 		"json":   newJsonModule(),
-		"proto":  UnstableProtoModule(r),
+		"proto":  newProtoModule(r, protoOpts...),
 		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
 		"yaml":   newYamlModule(),
 		"url":    urlmodule.NewModule(),
@@ -274,12 +347,16 @@ func newYamlModule() starlark.Value {
 }
 
 func UnstableProtoModule(r unstableProtoRegistryV2) starlark.Value {
+	return newProtoModule(r)
+}
+
+func newProtoModule(r unstableProtoRegistryV2, opts ...protomodule.ModuleOption) starlark.Value {
 	protoTypes := protoregistry.GlobalTypes
 	if r != nil {
 		protoTypes = r.UnstableProtobufTypes()
 	}
 
-	protoModule := protomodule.NewModule(protoTypes)
+	protoModule := protomodule.NewModule(protoTypes, opts...)
 
 	// Compatibility aliases
 	protoModule.Members["from_json"] = protoModule.Members["decode_json"]
@@ -300,25 +377,70 @@ func Load(ctx context.Context, filename string, opts ...LoadOption) (*Config, er
 	for _, opt := range opts {
 		opt.applyLoad(parsedOpts)
 	}
+	if len(parsedOpts.descriptorSetFiles) > 0 {
+		registry, err := loadDescriptorSetFiles(parsedOpts.protoRegistry, parsedOpts.descriptorSetFiles)
+		if err != nil {
+			return nil, err
+		}
+		parsedOpts.protoRegistry = registry
+	}
+	if len(parsedOpts.protoSources) > 0 {
+		registry, err := loadProtoSources(ctx, parsedOpts.protoRegistry, parsedOpts.protoSources)
+		if err != nil {
+			return nil, err
+		}
+		parsedOpts.protoRegistry = registry
+	}
 
-	overriddenGlobals := parsedOpts.globals
-	parsedOpts.globals = UnstablePredeclaredModules(parsedOpts.protoRegistry)
-	for key, value := range overriddenGlobals {
-		parsedOpts.globals[key] = value
+	if parsedOpts.coverage != nil {
+		parsedOpts.instrumented = &instrumentedModules{
+			modules: make(map[string]*instrumentedModule),
+		}
 	}
-	configLocals, tests, err := loadImpl(ctx, parsedOpts, filename)
+	parsedOpts.userGlobals = parsedOpts.globals
+	parsedOpts.globals = parsedOpts.predeclared()
+	configLocals, tests, err := loadImpl(ctx, parsedOpts, filename, "", nil)
 	if err != nil {
 		return nil, err
 	}
 	return &Config{
-		filename: filename,
-		globals:  parsedOpts.globals,
-		locals:   configLocals,
-		tests:    tests,
+		filename:     filename,
+		globals:      parsedOpts.globals,
+		locals:       configLocals,
+		tests:        tests,
+		instrumented: parsedOpts.instrumented,
 	}, nil
 }
 
-func loadImpl(ctx context.Context, opts *loadOptions, filename string) (starlark.StringDict, []*Test, error) {
+// predeclared returns new instances of the predeclared globals of modules,
+// overridden by those set with WithGlobals().
+func (opts *loadOptions) predeclared() starlark.StringDict {
+	protoOpts := append([]protomodule.ModuleOption{
+		protomodule.WithMessageDefaults(opts.protoDefaults...),
+	}, opts.protoOpts...)
+	globals := predeclaredModules(opts.protoRegistry, protoOpts...)
+	for key, value := range opts.userGlobals {
+		globals[key] = value
+	}
+	if opts.instrumented != nil {
+		globals[coverageBuiltin] = coverageRecorder
+	}
+	return globals
+}
+
+// loadImpl executes a module and the modules it loads, returning the module's
+// globals and the tests defined in each executed module.
+//
+// The root module is resolved relative to rootFromPath, which is empty except
+// for modules executed by tests, unless opts.rootResolved is set. Modules with a path in fakes are not read,
+// their symbols are returned from load() directly.
+func loadImpl(
+	ctx context.Context,
+	opts *loadOptions,
+	filename string,
+	rootFromPath string,
+	fakes map[string]starlark.StringDict,
+) (starlark.StringDict, []*Test, error) {
 	reader := opts.fileReader
 
 	type cacheEntry struct {
@@ -327,15 +449,24 @@ func loadImpl(ctx context.Context, opts *loadOptions, filename string) (starlark
 	}
 	cache := make(map[string]*cacheEntry)
 	tests := []*Test{}
+	seenTests := make(map[starlark.Callable]bool)
 
 	load := func(thread *starlark.Thread, moduleName string) (starlark.StringDict, error) {
-		var fromPath string
-		if thread.CallStackDepth() > 0 {
+		fromPath := rootFromPath
+		isRoot := thread.CallStackDepth() == 0
+		if !isRoot {
 			fromPath = thread.CallFrame(0).Pos.Filename()
 		}
-		modulePath, err := reader.Resolve(ctx, moduleName, fromPath)
-		if err != nil {
-			return nil, err
+		modulePath := moduleName
+		if !isRoot || !opts.rootResolved {
+			var err error
+			modulePath, err = reader.Resolve(ctx, moduleName, fromPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if fake, ok := fakes[modulePath]; ok {
+			return fake, nil
 		}
 
 		e, ok := cache[modulePath]
@@ -352,19 +483,10 @@ func loadImpl(ctx context.Context, opts *loadOptions, filename string) (starlark
 		}
 
 		cache[modulePath] = nil
-		globals, err := starlark.ExecFile(thread, modulePath, moduleSource, opts.globals)
+		globals, err := opts.execModule(thread, modulePath, moduleSource)
 		cache[modulePath] = &cacheEntry{globals, err}
 
-		for name, val := range globals {
-			if !strings.HasPrefix(name, "test_") {
-				continue
-			}
-			if fn, ok := val.(starlark.Callable); ok {
-				tests = append(tests, &Test{
-					callable: fn,
-				})
-			}
-		}
+		tests = append(tests, discoverTests(opts, modulePath, isRoot, globals, seenTests)...)
 		return globals, err
 	}
 	thread := &starlark.Thread{
@@ -372,10 +494,85 @@ func loadImpl(ctx context.Context, opts *loadOptions, filename string) (starlark
 		Load:  load,
 	}
 	thread.SetLocal(logOutputKey, opts.logOutput)
+	if opts.coverage != nil {
+		thread.SetLocal(coverageKey, opts.coverage)
+	}
+	if opts.fieldPositions {
+		protomodule.EnableFieldPositions(thread)
+	}
+	if opts.fixedDefaults {
+		protomodule.DisableDefaultsRegistration(thread)
+	}
 	locals, err := load(thread, filename)
 	return locals, tests, err
 }
 
+// execModule executes the source of a module, instrumenting it for coverage
+// if enabled.
+func (opts *loadOptions) execModule(thread *starlark.Thread, modulePath string, src []byte) (starlark.StringDict, error) {
+	if opts.instrumented == nil {
+		return starlark.ExecFile(thread, modulePath, src, opts.globals)
+	}
+	return execInstrumented(thread, modulePath, src, opts.globals, func(module *instrumentedModule) {
+		opts.instrumented.add(module)
+		if opts.coverage != nil {
+			opts.coverage.addModule(module)
+		}
+	})
+}
+
+// discoverTests returns the test functions defined by a module, in source order.
+//
+// A test is attributed to the module containing its definition, so a test
+// re-exported from a shared library is reported once, under that library.
+func discoverTests(
+	opts *loadOptions,
+	modulePath string,
+	isRoot bool,
+	globals starlark.StringDict,
+	seen map[starlark.Callable]bool,
+) []*Test {
+	var tests []*Test
+	for name, val := range globals {
+		if !strings.HasPrefix(name, "test_") {
+			continue
+		}
+		fn, ok := val.(starlark.Callable)
+		if !ok || seen[fn] {
+			continue
+		}
+		test := &Test{
+			name:     name,
+			callable: fn,
+			module:   modulePath,
+			pos:      syntax.MakePosition(&modulePath, 0, 0),
+			loadOpts: opts,
+		}
+		if starlarkFn, ok := fn.(*starlark.Function); ok {
+			test.pos = starlarkFn.Position()
+			if test.pos.Filename() != modulePath {
+				// Defined in another module, which discovers it when executed.
+				continue
+			}
+		}
+		seen[fn] = true
+		if opts.rootTestsOnly && !isRoot {
+			continue
+		}
+		if !strings.HasPrefix(modulePath, opts.testPathPrefix) {
+			continue
+		}
+		tests = append(tests, test)
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].pos.Line != tests[j].pos.Line {
+			return tests[i].pos.Line < tests[j].pos.Line
+		}
+		return tests[i].Name() < tests[j].Name()
+	})
+	return tests
+}
+
 // Filename returns the original filename passed to Load().
 func (c *Config) Filename() string {
 	return c.filename
@@ -404,6 +601,8 @@ type execOptions struct {
 	vars         *starlark.Dict
 	funcName     string
 	flattenLists bool
+	strictProto  bool
+	validators   []Validator
 }
 
 type fnExecOption func(*execOptions)
@@ -433,6 +632,15 @@ func WithFlattenLists() ExecOption {
 	})
 }
 
+// WithStrictProtoConversion causes Main to return an error if a returned
+// message has a field value that can't be converted to Protobuf without
+// losing information, instead of silently dropping or rounding it.
+func WithStrictProtoConversion() ExecOption {
+	return fnExecOption(func(opts *execOptions) {
+		opts.strictProto = true
+	})
+}
+
 // Main executes main() or a custom entry point function from the top-level Skycfg config
 // module, which is expected to return either None or a list of Protobuf messages.
 func (c *Config) Main(ctx context.Context, opts ...ExecOption) ([]proto.Message, error) {
@@ -451,12 +659,24 @@ func (c *Config) Main(ctx context.Context, opts ...ExecOption) ([]proto.Message,
 	if !ok {
 		return nil, fmt.Errorf("%q must be a function (got a %s)", parsedOpts.funcName, mainVal.Type())
 	}
+	if parsedOpts.coverage != nil {
+		if err := c.instrumented.startCoverage(parsedOpts.coverage); err != nil {
+			return nil, err
+		}
+	}
 
 	thread := &starlark.Thread{
 		Print: skyPrint,
 	}
 	thread.SetLocal(contextKey, ctx)
 	thread.SetLocal(logOutputKey, parsedOpts.logOutput)
+	if parsedOpts.coverage != nil {
+		thread.SetLocal(coverageKey, parsedOpts.coverage)
+	}
+	if len(parsedOpts.validators) > 0 {
+		// Positions are only needed to report violations.
+		protomodule.EnableFieldPositions(thread)
+	}
 	mainCtx := &starlarkstruct.Module{
 		Name: "skycfg_ctx",
 		Members: starlark.StringDict(map[string]starlark.Value{
@@ -476,6 +696,7 @@ func (c *Config) Main(ctx context.Context, opts ...ExecOption) ([]proto.Message,
 		return nil, fmt.Errorf("%q didn't return a list (got a %s)", parsedOpts.funcName, mainVal.Type())
 	}
 	var msgs []proto.Message
+	var values []starlark.Value
 	for ii := 0; ii < mainList.Len(); ii++ {
 		maybeMsg := mainList.Index(ii)
 		// Flatten lists recursively. [[1, 2], 3] => [1, 2, 3]
@@ -485,17 +706,44 @@ func (c *Config) Main(ctx context.Context, opts ...ExecOption) ([]proto.Message,
 				return nil, fmt.Errorf("%q returned something that's not a protobuf within a nested list %w", parsedOpts.funcName, err)
 			}
 			msgs = append(msgs, flattened...)
+			values = appendFlattened(values, maybeMsgList)
 		} else {
 			msg, ok := AsProtoMessage(maybeMsg)
 			if !ok {
 				return nil, fmt.Errorf("%q returned something that's not a protobuf (a %s)", parsedOpts.funcName, maybeMsg.Type())
 			}
 			msgs = append(msgs, msg)
+			values = append(values, maybeMsg)
+		}
+	}
+	if parsedOpts.strictProto {
+		for ii, value := range values {
+			msg, err := protomodule.AsProtoMessageStrict(value)
+			if err != nil {
+				return nil, fmt.Errorf("%q returned a protobuf that can't be converted: %w", parsedOpts.funcName, err)
+			}
+			msgs[ii] = msg
+		}
+	}
+	if len(parsedOpts.validators) > 0 {
+		if err := validateMessages(parsedOpts.validators, values, msgs); err != nil {
+			return nil, err
 		}
 	}
 	return msgs, nil
 }
 
+func appendFlattened(values []starlark.Value, list *starlark.List) []starlark.Value {
+	for i := 0; i < list.Len(); i++ {
+		if l, ok := list.Index(i).(*starlark.List); ok {
+			values = appendFlattened(values, l)
+		} else {
+			values = append(values, list.Index(i))
+		}
+	}
+	return values
+}
+
 func FlattenProtoList(list *starlark.List) ([]proto.Message, error) {
 	var flattened []proto.Message
 	for i := 0; i < list.Len(); i++ {
@@ -520,13 +768,24 @@ func FlattenProtoList(list *starlark.List) ([]proto.Message, error) {
 // A TestResult is the result of a test run
 type TestResult struct {
 	TestName string
-	Failure  error
+	// Failure is the first assertion failure of the test, or nil if it passed.
+	Failure error
+	// Failures contains every assertion failure recorded during the test run,
+	// in order. A test may record several failures via `ctx.expect`, but
+	// halts on the first failure of `ctx.assert`.
+	Failures []error
 	Duration time.Duration
 }
 
 // A Test is a test case, which is a skycfg function whose name starts with `test_`.
 type Test struct {
+	// The name of the test's global, which may differ from the name of its
+	// function.
+	name     string
 	callable starlark.Callable
+	module   string
+	pos      syntax.Position
+	loadOpts *loadOptions
 }
 
 // Name returns the name of the test (the name of the function)
@@ -534,6 +793,17 @@ func (t *Test) Name() string {
 	return t.callable.Name()
 }
 
+// Module returns the path of the module that defines the test, as returned
+// by FileReader.Resolve().
+func (t *Test) Module() string {
+	return t.module
+}
+
+// Position returns the source position of the test function's definition.
+func (t *Test) Position() syntax.Position {
+	return t.pos
+}
+
 // An TestOption adjusts details of how a Skycfg config's test functions are
 // executed.
 type TestOption interface {
@@ -542,7 +812,8 @@ type TestOption interface {
 
 type testOptions struct {
 	commonOptions
-	vars *starlark.Dict
+	vars    *starlark.Dict
+	globals starlark.StringDict
 }
 
 type fnTestOption func(*testOptions)
@@ -558,21 +829,82 @@ func WithTestVars(vars starlark.StringDict) TestOption {
 	})
 }
 
+// WithTestGlobals replaces predeclared global symbols, such as Skycfg modules
+// or values added by WithGlobals(), for the duration of a test run. The test's
+// module and the modules it loads are executed again with the replaced values,
+// so they can be used to mock builtins called by code under test. Defaults
+// registered by those modules only apply to the test run.
+//
+// Only builtin functions and modules can be replaced. Other test runs,
+// including concurrent ones, aren't affected.
+func WithTestGlobals(globals starlark.StringDict) TestOption {
+	return fnTestOption(func(opts *testOptions) {
+		for key, value := range globals {
+			opts.globals[key] = value
+		}
+	})
+}
+
 // Run actually executes a test. It returns a TestResult if the test completes (even if it fails)
 // The error return value will only be non-nil if the test execution itself errors.
 func (t *Test) Run(ctx context.Context, opts ...TestOption) (*TestResult, error) {
 	parsedOpts := &testOptions{
-		vars: &starlark.Dict{},
+		vars:    &starlark.Dict{},
+		globals: starlark.StringDict{},
 	}
 	for _, opt := range opts {
 		opt.applyTest(parsedOpts)
 	}
 
+	for key := range parsedOpts.globals {
+		original, ok := t.loadOpts.globals[key]
+		if !ok {
+			return nil, fmt.Errorf("cannot replace %q: not a predeclared global", key)
+		}
+		switch original.(type) {
+		case *starlark.Builtin, *starlarkstruct.Module:
+		default:
+			return nil, fmt.Errorf("cannot replace %q: can't replace a %s", key, original.Type())
+		}
+	}
+	if parsedOpts.coverage != nil {
+		if err := t.loadOpts.instrumented.startCoverage(parsedOpts.coverage); err != nil {
+			return nil, err
+		}
+	}
+
+	runOpts := *t.loadOpts
+	runOpts.logOutput = parsedOpts.logOutput
+	runOpts.coverage = parsedOpts.coverage
+	callable := t.callable
+	if len(parsedOpts.globals) > 0 {
+		// Modules only observe the globals they were executed with, so the
+		// test's module is executed again. New instances of the other
+		// predeclared modules keep the run from changing the config, for
+		// example by registering proto defaults.
+		runOpts.globals = runOpts.predeclared()
+		for key, value := range parsedOpts.globals {
+			runOpts.globals[key] = value
+		}
+		runOpts.rootResolved = true
+		globals, _, err := loadImpl(ctx, &runOpts, t.module, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		runOpts.rootResolved = false
+		callable = globals[t.name].(starlark.Callable)
+	}
+	// Modules loaded by the test can't register defaults.
+	runOpts.fixedDefaults = true
+
 	thread := &starlark.Thread{
 		Print: skyPrint,
 	}
 	thread.SetLocal(contextKey, ctx)
 	thread.SetLocal(logOutputKey, parsedOpts.logOutput)
+	if parsedOpts.coverage != nil {
+		thread.SetLocal(coverageKey, parsedOpts.coverage)
+	}
 
 	assertModule := assertmodule.AssertModule()
 	testCtx := &starlarkstruct.Module{
@@ -580,6 +912,13 @@ func (t *Test) Run(ctx context.Context, opts ...TestOption) (*TestResult, error)
 		Members: starlark.StringDict(map[string]starlark.Value{
 			"vars":   parsedOpts.vars,
 			"assert": assertModule,
+			"expect": assertModule.Expect(),
+			"check":  assertModule.Check(),
+			"mock": mockmodule.NewModule(&testModuleLoader{
+				ctx:      ctx,
+				test:     t,
+				loadOpts: &runOpts,
+			}),
 		}),
 	}
 	args := starlark.Tuple([]starlark.Value{testCtx})
@@ -589,26 +928,45 @@ func (t *Test) Run(ctx context.Context, opts ...TestOption) (*TestResult, error)
 	}
 
 	startTime := time.Now()
-	_, err := starlark.Call(thread, t.callable, args, nil)
+	_, err := starlark.Call(thread, callable, args, nil)
 	result.Duration = time.Since(startTime)
-	if err != nil {
-		// if there is no assertion error, there was something wrong with the execution itself
-		if len(assertModule.Failures) == 0 {
-			return nil, err
-		}
+	// if the error is not an assertion failure, there was something wrong with the execution itself
+	if err != nil && !assertmodule.IsFailure(err) {
+		return nil, err
+	}
 
-		// there should only be one failure, because each test run gets its own *TestContext
-		// and each assertion failure halts execution.
-		if len(assertModule.Failures) > 1 {
-			panic("A test run should only have one assertion failure. Something went wrong with the test infrastructure.")
-		}
+	// each test run gets its own *TestContext, so every recorded failure
+	// belongs to this test.
+	if len(assertModule.Failures) > 0 {
 		result.Failure = assertModule.Failures[0]
+		result.Failures = assertModule.Failures
 	}
 
 	return &result, nil
 }
 
-// Tests returns all tests defined in the config
+// testModuleLoader implements `ctx.mock.load` for a test, resolving modules
+// relative to the module that defines the test.
+type testModuleLoader struct {
+	ctx  context.Context
+	test *Test
+	// The options of the test run, whose globals may be replaced.
+	loadOpts *loadOptions
+}
+
+var _ mockmodule.Loader = (*testModuleLoader)(nil)
+
+func (l *testModuleLoader) Resolve(name string) (string, error) {
+	return l.test.loadOpts.fileReader.Resolve(l.ctx, name, l.test.module)
+}
+
+func (l *testModuleLoader) Load(thread *starlark.Thread, name string, fakes map[string]starlark.StringDict) (starlark.StringDict, error) {
+	globals, _, err := loadImpl(l.ctx, l.loadOpts, name, l.test.module, fakes)
+	return globals, err
+}
+
+// Tests returns all tests defined in the config and the modules it loads.
+// Each test is reported once, attributed to the module that defines it.
 func (c *Config) Tests() []*Test {
 	return c.tests
 }
@@ -642,12 +1000,20 @@ func (c *Config) MainNonProtobuf(ctx context.Context, opts ...ExecOption) ([]str
 	if !ok {
 		return nil, fmt.Errorf("%q must be a function (got a %s)", parsedOpts.funcName, mainVal.Type())
 	}
+	if parsedOpts.coverage != nil {
+		if err := c.instrumented.startCoverage(parsedOpts.coverage); err != nil {
+			return nil, err
+		}
+	}
 
 	thread := &starlark.Thread{
 		Print: skyPrint,
 	}
 	thread.SetLocal(contextKey, ctx)
 	thread.SetLocal(logOutputKey, parsedOpts.logOutput)
+	if parsedOpts.coverage != nil {
+		thread.SetLocal(coverageKey, parsedOpts.coverage)
+	}
 	mainCtx := &starlarkstruct.Module{
 		Name: "skycfg_ctx",
 		Members: starlark.StringDict(map[string]starlark.Value{
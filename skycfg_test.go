@@ -19,15 +19,26 @@ package skycfg_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
 	wrappers "google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/stripe/skycfg"
+	"github.com/stripe/skycfg/go/mockmodule"
 	pb "github.com/stripe/skycfg/internal/testdata/test_proto"
 )
 
@@ -312,6 +323,173 @@ def main(ctx):
 	msg4 = "44444"
 
 	return [[msg, [msg2, [msg3]]], msg4]
+`,
+	"discovery/root.sky": `
+load("discovery/lib_a.sky", "helper_a")
+load("discovery/lib_b.sky", "helper_b")
+
+def test_defaults(t):
+	t.assert(helper_a() + helper_b() == 3)
+`,
+	"discovery/lib_a.sky": `
+load("discovery/shared.sky", "shared")
+
+def helper_a():
+	return shared()
+
+def test_defaults(t):
+	t.assert(helper_a() == 1)
+`,
+	"discovery/lib_b.sky": `
+load("discovery/shared.sky", "shared", _shared_test = "test_shared")
+
+def helper_b():
+	return shared() + 1
+
+test_reexported = _shared_test
+`,
+	"discovery/shared.sky": `
+def shared():
+	return 1
+
+def test_shared(t):
+	t.assert(shared() == 1)
+`,
+	"expect.sky": `
+def test_expect_all(t):
+	t.expect.equal(1, 2)
+	t.expect(False)
+	t.expect.equal(3, 3)
+	t.assert.equal(4, 5)
+	t.expect.equal(6, 7)
+
+def test_expect_then_error(t):
+	t.expect.equal(1, 2)
+	t.someundefinedfunc()
+`,
+	"check.sky": `
+test_proto = proto.package("skycfg.test_proto")
+
+def roundtrip(msg):
+	decoded = proto.decode_text(test_proto.MessageV3, proto.encode_text(msg))
+	return proto.encode_text(decoded) == proto.encode_text(msg)
+
+def small_int32(msg):
+	return msg.f_int32 < 50
+
+def test_check_roundtrip(t):
+	t.check(roundtrip, t.check.message(test_proto.MessageV3), runs = 50)
+
+def test_check_falsified(t):
+	t.check(small_int32, t.check.message(test_proto.MessageV3, max_depth = 1), seed = 5)
+`,
+	"descriptor_set.sky": `
+dynamic = proto.package("skycfg.dynamic")
+
+def main(ctx):
+	return [dynamic.Example(
+		name = "example",
+		timeout = "30s",
+		color = dynamic.Example.Color.BLUE,
+		inner = dynamic.Example.Inner(values = ["a", "b"]),
+	)]
+`,
+	"validation.sky": `
+pb = proto.package("skycfg.test_proto")
+
+def main(ctx):
+	msg = pb.ValidatedMessage(name = "web", replicas = 3)
+	msg.children.append(pb.ValidatedMessage(name = "worker"))
+	return [msg]
+
+def invalid(ctx):
+	msg = pb.ValidatedMessage(name = "web")
+	msg.replicas = 20
+	msg.children.append(pb.ValidatedMessage(name = "Worker"))
+	msg.by_name["db"] = pb.ValidatedMessage(replicas = 1)
+	return [pb.ValidatedMessage(name = "ok"), msg]
+
+TOPLEVEL = pb.ValidatedMessage(name = "web", replicas = 20)
+
+def toplevel(ctx):
+	return [TOPLEVEL]
+`,
+	"strict.sky": `
+pb = proto.package("skycfg.test_proto")
+
+def main(ctx):
+	return [pb.MessageV3(f_float32 = 1.5)]
+
+def lossy(ctx):
+	return [pb.MessageV3(f_float32 = 1e300)]
+`,
+	"defaults.sky": `
+pb = proto.package("skycfg.test_proto")
+
+def main(ctx):
+	return [pb.MessageV3(f_string = "a"), proto.set_defaults(pb.MessageV3(f_int32 = 2))]
+
+def register(ctx):
+	proto.register_defaults(pb.MessageV3, {"f_int64": 4})
+	return []
+
+def test_register(t):
+	t.mock.load_module("defaults_register.sky")
+`,
+	"defaults_register.sky": `
+pb = proto.package("skycfg.test_proto")
+
+proto.register_defaults(pb.MessageV3, {"f_int64": 4})
+`,
+	"enums.sky": `
+pb = proto.package("skycfg.test_proto")
+
+def main(ctx):
+	return [pb.MessageV3(f_toplevel_enum = "TOPLEVEL_ENUM_V3_B", f_nested_enum = 1)]
+`,
+	"mock/config.sky": `
+load("mock/lib.sky", "digest")
+
+def test_mock_global(t):
+	t.assert.equal(digest("hello"), "fake_md5")
+
+def test_mock_module(t):
+	fake_digest = t.mock.function(return_value = "fake_digest")
+	t.mock.module("mock/lib.sky", digest = fake_digest)
+	user = t.mock.load_module("mock/user.sky")
+	t.assert.equal(user.render("hello"), "fake_digest")
+	t.assert.equal(fake_digest.call_count, 1)
+	t.assert.equal(fake_digest.calls[0].args, ("hello",))
+`,
+	"mock/lib.sky": `
+def digest(s):
+	return hash.md5(s)
+`,
+	"mock/user.sky": `
+load("mock/lib.sky", "digest")
+
+def render(s):
+	return digest(s)
+`,
+	"coverage/main.sky": `
+"""Module docstring."""
+load("coverage/lib.sky", "double")
+
+def main(ctx):
+	"""Function docstring."""
+	if ctx.vars.get("double"):
+		return [str(double(1))]
+	return ["1"]
+
+def test_double(t):
+	t.assert.equal(double(2), 4)
+`,
+	"coverage/lib.sky": `
+def double(x):
+	return x * 2
+
+def unused():
+	pass
 `,
 	"print/on_load.sky": `
 print("hello world")
@@ -836,7 +1014,7 @@ func TestSkycfgTesting(t *testing.T) {
 
 	tests := config.Tests()
 	if len(tests) != len(cases) {
-		t.Error("Expected %d tests but found %d", len(cases), len(tests))
+		t.Errorf("Expected %d tests but found %d", len(cases), len(tests))
 	}
 
 	for _, test := range tests {
@@ -895,6 +1073,758 @@ func TestSkycfgTesting(t *testing.T) {
 	}
 }
 
+func TestSkycfgTestDiscovery(t *testing.T) {
+	loader := &testLoader{}
+	ctx := context.Background()
+
+	type discoveredTest struct {
+		name   string
+		module string
+		line   int32
+	}
+
+	cases := []struct {
+		name    string
+		options []skycfg.LoadOption
+		want    []discoveredTest
+	}{
+		{
+			name: "all modules",
+			want: []discoveredTest{
+				{"test_shared", "discovery/shared.sky", 5},
+				{"test_defaults", "discovery/lib_a.sky", 7},
+				{"test_defaults", "discovery/root.sky", 5},
+			},
+		},
+		{
+			name:    "root only",
+			options: []skycfg.LoadOption{skycfg.WithRootTestsOnly()},
+			want: []discoveredTest{
+				{"test_defaults", "discovery/root.sky", 5},
+			},
+		},
+		{
+			name:    "path prefix",
+			options: []skycfg.LoadOption{skycfg.WithTestPathPrefix("discovery/lib_")},
+			want: []discoveredTest{
+				{"test_defaults", "discovery/lib_a.sky", 7},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]skycfg.LoadOption{skycfg.WithFileReader(loader)}, tc.options...)
+			config, err := skycfg.Load(ctx, "discovery/root.sky", opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []discoveredTest
+			for _, test := range config.Tests() {
+				if test.Position().Filename() != test.Module() {
+					t.Errorf("%s: position %s is not in module %q", test.Name(), test.Position(), test.Module())
+				}
+				got = append(got, discoveredTest{test.Name(), test.Module(), test.Position().Line})
+
+				result, err := test.Run(ctx)
+				if err != nil {
+					t.Fatalf("%s (%s): %v", test.Name(), test.Module(), err)
+				}
+				if result.Failure != nil {
+					t.Errorf("%s (%s): %v", test.Name(), test.Module(), result.Failure)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("discovered tests differed\nExpected: %v\nGot     : %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSkycfgTestingExpect(t *testing.T) {
+	loader := &testLoader{}
+	ctx := context.Background()
+
+	config, err := skycfg.Load(ctx, "expect.sky", skycfg.WithFileReader(loader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := make(map[string]*skycfg.Test)
+	for _, test := range config.Tests() {
+		tests[test.Name()] = test
+	}
+
+	result, err := tests["test_expect_all"].Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFailures := []string{
+		"[expect.sky:3:16] assertion failed: 1 (type: int) == 2 (type: int)",
+		"[expect.sky:4:10] assertion failed",
+		"[expect.sky:6:16] assertion failed: 4 (type: int) == 5 (type: int)",
+	}
+	if len(result.Failures) != len(wantFailures) {
+		t.Fatalf("Expected %d failures, found %d: %v", len(wantFailures), len(result.Failures), result.Failures)
+	}
+	for ii, want := range wantFailures {
+		if got := result.Failures[ii].Error(); !strings.HasPrefix(got, want) {
+			t.Errorf("Expected failure %d to start with %q, got %q", ii, want, got)
+		}
+	}
+	if result.Failure == nil || result.Failure.Error() != result.Failures[0].Error() {
+		t.Errorf("Expected Failure to be the first of Failures, got %v", result.Failure)
+	}
+
+	if _, err := tests["test_expect_then_error"].Run(ctx); err == nil {
+		t.Error("Expected execution error after a failed expectation, got nil")
+	}
+}
+
+func TestSkycfgTestingCheck(t *testing.T) {
+	loader := &testLoader{}
+	ctx := context.Background()
+
+	config, err := skycfg.Load(ctx, "check.sky", skycfg.WithFileReader(loader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := make(map[string]*skycfg.Test)
+	for _, test := range config.Tests() {
+		tests[test.Name()] = test
+	}
+
+	result, err := tests["test_check_roundtrip"].Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failure != nil {
+		t.Errorf("Expected property to hold, got failure: %v", result.Failure)
+	}
+
+	result, err = tests["test_check_falsified"].Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Failures) != 1 {
+		t.Fatalf("Expected 1 failure, found %d: %v", len(result.Failures), result.Failures)
+	}
+	// Shrinking clears every field that doesn't contribute to the failure.
+	want := regexp.MustCompile(`property small_int32 falsified after \d+ runs \(seed 5\) by \(<skycfg.test_proto.MessageV3 f_int32:\d+>,\): property returned False`)
+	if got := result.Failure.Error(); !want.MatchString(got) {
+		t.Errorf("Expected failure to report a shrunk message, got %q", got)
+	}
+}
+
+func dynamicDescriptorSet(t *testing.T) []byte {
+	t.Helper()
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(durationpb.File_google_protobuf_duration_proto),
+		{
+			Name:       proto.String("skycfg/dynamic.proto"),
+			Package:    proto.String("skycfg.dynamic"),
+			Dependency: []string{"google/protobuf/duration.proto"},
+			Syntax:     proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Example"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("name"), Number: proto.Int32(1), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), JsonName: proto.String("name")},
+					{Name: proto.String("timeout"), Number: proto.Int32(2), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".google.protobuf.Duration"), JsonName: proto.String("timeout")},
+					{Name: proto.String("color"), Number: proto.Int32(3), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(), TypeName: proto.String(".skycfg.dynamic.Example.Color"), JsonName: proto.String("color")},
+					{Name: proto.String("inner"), Number: proto.Int32(4), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".skycfg.dynamic.Example.Inner"), JsonName: proto.String("inner")},
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("Inner"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						{Name: proto.String("values"), Number: proto.Int32(1), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), JsonName: proto.String("values")},
+					},
+				}},
+				EnumType: []*descriptorpb.EnumDescriptorProto{{
+					Name: proto.String("Color"),
+					Value: []*descriptorpb.EnumValueDescriptorProto{
+						{Name: proto.String("RED"), Number: proto.Int32(0)},
+						{Name: proto.String("BLUE"), Number: proto.Int32(1)},
+					},
+				}},
+			}},
+		},
+	}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSkycfgDescriptorSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dynamic.pb")
+	if err := ioutil.WriteFile(path, dynamicDescriptorSet(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	config, err := skycfg.Load(ctx, "descriptor_set.sky",
+		skycfg.WithFileReader(&testLoader{}),
+		skycfg.WithProtoDescriptorSetFiles(path),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := config.Main(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(msgs))
+	}
+
+	got := prototext.MarshalOptions{}.Format(msgs[0])
+	want := `name:"example" timeout:{seconds:30} color:BLUE inner:{values:"a" values:"b"}`
+	if removeSpaces(got) != removeSpaces(want) {
+		t.Errorf("Unexpected message\nwant: %s\ngot : %s", want, got)
+	}
+	if name := msgs[0].ProtoReflect().Descriptor().FullName(); name != "skycfg.dynamic.Example" {
+		t.Errorf("Expected message of type skycfg.dynamic.Example, got %s", name)
+	}
+
+	// The registry can also be constructed directly.
+	registry, err := skycfg.NewDescriptorSetRegistry(dynamicDescriptorSet(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.UnstableProtobufTypes().FindMessageByName("skycfg.dynamic.Example.Inner"); err != nil {
+		t.Errorf("Expected nested message to be registered: %v", err)
+	}
+	if _, err := registry.UnstableProtobufTypes().FindMessageByName("skycfg.test_proto.MessageV3"); err != nil {
+		t.Errorf("Expected compiled types to be registered: %v", err)
+	}
+
+	_, err = skycfg.NewDescriptorSetRegistry([]byte("not a descriptor set"))
+	if err == nil || !strings.HasPrefix(err.Error(), "NewDescriptorSetRegistry: descriptor set 0: invalid FileDescriptorSet") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+
+	_, err = skycfg.Load(ctx, "descriptor_set.sky",
+		skycfg.WithFileReader(&testLoader{}),
+		skycfg.WithProtoDescriptorSetFiles(filepath.Join(t.TempDir(), "missing.pb")),
+	)
+	if err == nil {
+		t.Error("Expected error loading missing descriptor set file")
+	}
+}
+
+type testProtoFileReader map[string]string
+
+func (r testProtoFileReader) ReadProtoFile(ctx context.Context, importPath string) ([]byte, error) {
+	src, ok := r[importPath]
+	if !ok {
+		return nil, fmt.Errorf("%s: not found", importPath)
+	}
+	return []byte(src), nil
+}
+
+var testProtoSources = testProtoFileReader{
+	"skycfg/dynamic/example.proto": `
+syntax = "proto3";
+package skycfg.dynamic;
+
+import "google/protobuf/duration.proto";
+import "skycfg/dynamic/label.proto";
+
+message Example {
+  enum Color {
+    RED = 0;
+    BLUE = 1;
+  }
+  message Inner {
+    repeated string values = 1;
+  }
+  string name = 1;
+  google.protobuf.Duration timeout = 2;
+  Color color = 3;
+  Inner inner = 4;
+  map<string, Label> labels = 5;
+}
+`,
+	"skycfg/dynamic/label.proto": `
+syntax = "proto3";
+package skycfg.dynamic;
+
+message Label {
+  string value = 1;
+}
+`,
+}
+
+func TestSkycfgProtoSources(t *testing.T) {
+	ctx := context.Background()
+	config, err := skycfg.Load(ctx, "descriptor_set.sky",
+		skycfg.WithFileReader(&testLoader{}),
+		skycfg.WithProtoSourceFiles(testProtoSources, "skycfg/dynamic/example.proto"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := config.Main(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(msgs))
+	}
+	got := prototext.MarshalOptions{}.Format(msgs[0])
+	want := `name:"example" timeout:{seconds:30} color:BLUE inner:{values:"a" values:"b"}`
+	if removeSpaces(got) != removeSpaces(want) {
+		t.Errorf("Unexpected message\nwant: %s\ngot : %s", want, got)
+	}
+
+	// Sources can also be read from the filesystem.
+	dir := t.TempDir()
+	for name, src := range testProtoSources {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry, err := skycfg.NewProtoSourceRegistry(ctx,
+		skycfg.LocalProtoFileReader(t.TempDir(), dir),
+		"skycfg/dynamic/example.proto",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.UnstableProtobufTypes().FindMessageByName("skycfg.dynamic.Label"); err != nil {
+		t.Errorf("Expected imported message to be registered: %v", err)
+	}
+
+	_, err = skycfg.NewProtoSourceRegistry(ctx, testProtoFileReader{
+		"broken.proto": "syntax = \"proto3\";\nimport \"missing.proto\";",
+	}, "broken.proto")
+	if err == nil || err.Error() != "NewProtoSourceRegistry: missing.proto: not found (imported by broken.proto)" {
+		t.Errorf("Expected missing import error, got %v", err)
+	}
+
+	_, err = skycfg.Load(ctx, "descriptor_set.sky",
+		skycfg.WithFileReader(&testLoader{}),
+		skycfg.WithProtoSourceFiles(testProtoFileReader{
+			"broken.proto": "message Broken {\n  int32 field = 1;\n}",
+		}, "broken.proto"),
+	)
+	if err == nil || err.Error() != `broken.proto:2:3: expected field label, got "int32"` {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+}
+
+func TestSkycfgValidation(t *testing.T) {
+	ctx := context.Background()
+	config, err := skycfg.Load(ctx, "validation.sky", skycfg.WithFileReader(&testLoader{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validators := []skycfg.ExecOption{
+		skycfg.WithValidator(skycfg.RequiredFieldsValidator()),
+		skycfg.WithValidator(skycfg.RuleValidator(pb.E_Rule)),
+	}
+
+	msgs, err := config.Main(ctx, validators...)
+	if err != nil {
+		t.Fatalf("Expected valid messages, got %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(msgs))
+	}
+
+	_, err = config.Main(ctx, append(validators, skycfg.WithEntryPoint("invalid"))...)
+	validationErr, ok := err.(*skycfg.ValidationError)
+	if !ok {
+		t.Fatalf("Expected *skycfg.ValidationError, got %v", err)
+	}
+	if len(validationErr.Messages) != 1 || validationErr.Messages[0].Index != 1 {
+		t.Fatalf("Expected only message 1 to be invalid, got %v", validationErr)
+	}
+	want := strings.Join([]string{
+		`invalid skycfg.test_proto.ValidatedMessage: validation.sky:13:41: by_name["db"].name: required field is not set`,
+		`invalid skycfg.test_proto.ValidatedMessage: validation.sky:11:5: replicas: rule "value <= 10": got False`,
+		`invalid skycfg.test_proto.ValidatedMessage: validation.sky:12:41: children[0].name: rule "matches('^[a-z][a-z0-9-]*$', value)": got False`,
+	}, "\n")
+	if got := err.Error(); got != want {
+		t.Errorf("Unexpected error\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestSkycfgValidationFieldPositions(t *testing.T) {
+	ctx := context.Background()
+	validator := skycfg.WithValidator(skycfg.RuleValidator(pb.E_Rule))
+	for _, test := range []struct {
+		name string
+		opts []skycfg.LoadOption
+		want string
+	}{
+		{
+			name: "default",
+			want: `invalid skycfg.test_proto.ValidatedMessage: replicas: rule "value <= 10": got False`,
+		},
+		{
+			name: "WithFieldPositions",
+			opts: []skycfg.LoadOption{skycfg.WithFieldPositions()},
+			want: `invalid skycfg.test_proto.ValidatedMessage: validation.sky:16:31: replicas: rule "value <= 10": got False`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]skycfg.LoadOption{skycfg.WithFileReader(&testLoader{})}, test.opts...)
+			config, err := skycfg.Load(ctx, "validation.sky", opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = config.Main(ctx, validator, skycfg.WithEntryPoint("toplevel"))
+			if err == nil || err.Error() != test.want {
+				t.Errorf("Unexpected error\nwant: %s\ngot:  %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestSkycfgStrictProtoConversion(t *testing.T) {
+	ctx := context.Background()
+	config, err := skycfg.Load(ctx, "strict.sky", skycfg.WithFileReader(&testLoader{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := config.Main(ctx, skycfg.WithStrictProtoConversion())
+	if err != nil {
+		t.Fatalf("Expected valid messages, got %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(msgs))
+	}
+
+	// Without strict conversion the value silently overflows.
+	if _, err := config.Main(ctx, skycfg.WithEntryPoint("lossy")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = config.Main(ctx, skycfg.WithEntryPoint("lossy"), skycfg.WithStrictProtoConversion())
+	want := `"lossy" returned a protobuf that can't be converted: skycfg.test_proto.MessageV3: f_float32: ValueError: value 1e+300 is not exactly representable as type "float".`
+	if err == nil || err.Error() != want {
+		t.Errorf("Unexpected error\nwant: %s\ngot:  %v", want, err)
+	}
+}
+
+func TestSkycfgProtoDefaults(t *testing.T) {
+	ctx := context.Background()
+	config, err := skycfg.Load(ctx, "defaults.sky",
+		skycfg.WithFileReader(&testLoader{}),
+		skycfg.WithProtoDefaults(&pb.MessageV3{FInt32: 1, FInt64: 3}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Defaults can't be registered by main(), so one execution of the config
+	// can't change the messages constructed by the next.
+	_, err = config.Main(ctx, skycfg.WithEntryPoint("register"))
+	wantErr := "proto.register_defaults: defaults can only be registered while loading a module, not by a function called after loading"
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("Unexpected error\nwant: %s\ngot:  %v", wantErr, err)
+	}
+
+	// Nor by modules that tests load after the config was loaded.
+	tests := config.Tests()
+	if len(tests) != 1 {
+		t.Fatalf("Expected 1 test, got %d", len(tests))
+	}
+	_, err = tests[0].Run(ctx)
+	wantErr = "proto.register_defaults: defaults can't be registered by a module loaded after the config"
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("Unexpected error\nwant: %s\ngot:  %v", wantErr, err)
+	}
+
+	msgs, err := config.Main(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []proto.Message{
+		&pb.MessageV3{FInt32: 1, FInt64: 3, FString: "a"},
+		&pb.MessageV3{FInt32: 2, FInt64: 3},
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("Expected %d messages, got %d", len(want), len(msgs))
+	}
+	for ii := range want {
+		if !proto.Equal(want[ii], msgs[ii]) {
+			t.Errorf("Unexpected message %d\nwant: %v\ngot:  %v", ii, want[ii], msgs[ii])
+		}
+	}
+}
+
+func TestSkycfgProtoEnumConversion(t *testing.T) {
+	ctx := context.Background()
+	config, err := skycfg.Load(ctx, "enums.sky", skycfg.WithFileReader(&testLoader{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Main(ctx); err == nil {
+		t.Fatal("Expected error assigning enum name without WithProtoEnumConversion")
+	}
+
+	config, err = skycfg.Load(ctx, "enums.sky",
+		skycfg.WithFileReader(&testLoader{}),
+		skycfg.WithProtoEnumConversion(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := config.Main(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.MessageV3{
+		FToplevelEnum: pb.ToplevelEnumV3_TOPLEVEL_ENUM_V3_B,
+		FNestedEnum:   pb.MessageV3_NESTED_ENUM_B,
+	}
+	if len(msgs) != 1 || !proto.Equal(want, msgs[0]) {
+		t.Errorf("Unexpected messages\nwant: %v\ngot:  %v", want, msgs)
+	}
+}
+
+func removeSpaces(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+func TestSkycfgTestingMocks(t *testing.T) {
+	loader := &testLoader{}
+	ctx := context.Background()
+
+	shout := starlark.NewBuiltin("shout", nil)
+	config, err := skycfg.Load(ctx, "mock/config.sky",
+		skycfg.WithFileReader(loader),
+		skycfg.WithGlobals(starlark.StringDict{
+			"greeting": starlark.String("hello"),
+			"shout":    shout,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tests replace globals by executing modules again, so the config's
+	// own builtins are used as-is.
+	if got := config.Globals()["shout"]; got != shout {
+		t.Errorf("Expected predeclared builtin to be unchanged, got %v", got)
+	}
+	tests := make(map[string]*skycfg.Test)
+	for _, test := range config.Tests() {
+		tests[test.Name()] = test
+	}
+
+	md5 := mockmodule.NewFunction("md5", starlark.String("fake_md5"))
+	hash := &starlarkstruct.Module{
+		Name:    "hash",
+		Members: starlark.StringDict{"md5": md5},
+	}
+
+	// Replaced globals are only visible to the test run that replaced them,
+	// even if other runs are concurrent.
+	var wg sync.WaitGroup
+	var mocked, unmocked *skycfg.TestResult
+	var mockedErr, unmockedErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		mocked, mockedErr = tests["test_mock_global"].Run(ctx, skycfg.WithTestGlobals(starlark.StringDict{
+			"hash": hash,
+		}))
+	}()
+	go func() {
+		defer wg.Done()
+		unmocked, unmockedErr = tests["test_mock_global"].Run(ctx)
+	}()
+	wg.Wait()
+	if mockedErr != nil {
+		t.Fatal(mockedErr)
+	}
+	if mocked.Failure != nil {
+		t.Error(mocked.Failure)
+	}
+	if calls := md5.Calls(); len(calls) != 1 || calls[0].Args.String() != `("hello",)` {
+		t.Errorf("Expected one call of md5 with (\"hello\",), got %v", calls)
+	}
+	if unmockedErr != nil {
+		t.Fatal(unmockedErr)
+	}
+	if unmocked.Failure == nil {
+		t.Error("Expected test to fail without the mocked global")
+	}
+	if config.Globals()["hash"] == hash {
+		t.Error("Replaced global was visible outside of the test run")
+	}
+
+	_, err = tests["test_mock_global"].Run(ctx, skycfg.WithTestGlobals(starlark.StringDict{
+		"greeting": starlark.String("hi"),
+	}))
+	if err == nil || err.Error() != `cannot replace "greeting": can't replace a string` {
+		t.Errorf("Expected error for replacing a string global, got %v", err)
+	}
+
+	_, err = tests["test_mock_global"].Run(ctx, skycfg.WithTestGlobals(starlark.StringDict{
+		"no_such_global": starlark.None,
+	}))
+	if err == nil || err.Error() != `cannot replace "no_such_global": not a predeclared global` {
+		t.Errorf("Expected error for replacing unknown global, got %v", err)
+	}
+
+	result, err := tests["test_mock_module"].Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failure != nil {
+		t.Error(result.Failure)
+	}
+}
+
+func TestSkycfgCoverage(t *testing.T) {
+	loader := &testLoader{}
+	ctx := context.Background()
+
+	loadCoverage := skycfg.NewCoverage()
+	config, err := skycfg.Load(ctx, "coverage/main.sky",
+		skycfg.WithFileReader(loader),
+		skycfg.WithCoverage(loadCoverage),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc := config.Locals()["main"].(*starlark.Function).Doc(); doc != "Function docstring." {
+		t.Errorf("Instrumentation changed docstring to %q", doc)
+	}
+
+	runCoverage := skycfg.NewCoverage()
+	if _, err := config.MainNonProtobuf(ctx, skycfg.WithCoverage(runCoverage)); err != nil {
+		t.Fatal(err)
+	}
+	result, err := config.Tests()[0].Run(ctx, skycfg.WithCoverage(runCoverage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failure != nil {
+		t.Fatal(result.Failure)
+	}
+
+	wantLoad := map[string]map[int]uint64{
+		"coverage/lib.sky":  {2: 1, 3: 0, 5: 1, 6: 0},
+		"coverage/main.sky": {3: 1, 5: 1, 7: 0, 8: 0, 9: 0, 11: 1, 12: 0},
+	}
+	wantRun := map[string]map[int]uint64{
+		"coverage/lib.sky":  {2: 0, 3: 1, 5: 0, 6: 0},
+		"coverage/main.sky": {3: 0, 5: 0, 7: 1, 8: 0, 9: 1, 11: 0, 12: 1},
+	}
+	for _, check := range []struct {
+		name string
+		cov  *skycfg.Coverage
+		want map[string]map[int]uint64
+	}{
+		{"load", loadCoverage, wantLoad},
+		{"run", runCoverage, wantRun},
+	} {
+		got := make(map[string]map[int]uint64)
+		for _, module := range check.cov.Modules() {
+			got[module] = check.cov.Lines(module)
+		}
+		if !reflect.DeepEqual(got, check.want) {
+			t.Errorf("%s: coverage differed\nExpected: %v\nGot     : %v", check.name, check.want, got)
+		}
+	}
+
+	var profile strings.Builder
+	if err := runCoverage.WriteGoProfile(&profile); err != nil {
+		t.Fatal(err)
+	}
+	wantProfile := `mode: count
+coverage/lib.sky:2.1,2.15 1 0
+coverage/lib.sky:3.1,3.14 1 1
+coverage/lib.sky:5.1,5.14 1 0
+coverage/lib.sky:6.1,6.6 1 0
+coverage/main.sky:3.1,3.35 1 0
+coverage/main.sky:5.1,5.15 1 0
+coverage/main.sky:7.1,7.28 1 1
+coverage/main.sky:8.1,8.26 1 0
+coverage/main.sky:9.1,9.14 1 1
+coverage/main.sky:11.1,11.20 1 0
+coverage/main.sky:12.1,12.30 1 1
+`
+	if profile.String() != wantProfile {
+		t.Errorf("Go profile differed\nExpected: %s\nGot     : %s", wantProfile, profile.String())
+	}
+
+	var lcov strings.Builder
+	if err := runCoverage.WriteLCOV(&lcov); err != nil {
+		t.Fatal(err)
+	}
+	wantLCOV := `TN:
+SF:coverage/lib.sky
+DA:2,0
+DA:3,1
+DA:5,0
+DA:6,0
+LF:4
+LH:1
+end_of_record
+TN:
+SF:coverage/main.sky
+DA:3,0
+DA:5,0
+DA:7,1
+DA:8,0
+DA:9,1
+DA:11,0
+DA:12,1
+LF:7
+LH:3
+end_of_record
+`
+	if lcov.String() != wantLCOV {
+		t.Errorf("LCOV differed\nExpected: %s\nGot     : %s", wantLCOV, lcov.String())
+	}
+
+	// Concurrent executions record into their own coverage only.
+	var wg sync.WaitGroup
+	covs := make([]*skycfg.Coverage, 4)
+	for ii := range covs {
+		covs[ii] = skycfg.NewCoverage()
+		wg.Add(2)
+		go func(cov *skycfg.Coverage) {
+			defer wg.Done()
+			if _, err := config.MainNonProtobuf(ctx, skycfg.WithCoverage(cov)); err != nil {
+				t.Error(err)
+			}
+		}(covs[ii])
+		go func() {
+			defer wg.Done()
+			if _, err := config.MainNonProtobuf(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, cov := range covs {
+		if got := cov.Lines("coverage/main.sky")[9]; got != 1 {
+			t.Errorf("Expected line 9 to be executed once, got %d", got)
+		}
+	}
+
+	uninstrumented, err := skycfg.Load(ctx, "coverage/main.sky", skycfg.WithFileReader(loader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = uninstrumented.MainNonProtobuf(ctx, skycfg.WithCoverage(skycfg.NewCoverage()))
+	if err == nil || err.Error() != "WithCoverage: config was loaded without coverage enabled" {
+		t.Errorf("Expected error for uninstrumented config, got %v", err)
+	}
+}
+
 type flattenStringTestCase struct {
 	inputList      *starlark.List
 	expectedOutput []string
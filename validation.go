@@ -0,0 +1,407 @@
+// Copyright 2026 The Skycfg Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package skycfg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/stripe/skycfg/go/protomodule"
+)
+
+// A Validator checks the Protobuf messages returned by a config's main
+// function. See WithValidator.
+type Validator interface {
+	// Validate returns the violations found in msg, or nil if it's valid.
+	Validate(msg proto.Message) []*Violation
+}
+
+// A Violation describes a field that failed validation.
+type Violation struct {
+	// Path of the field within the validated message, such as
+	// "spec.ports[0].name" or `labels["app"]`. Empty if the violation
+	// applies to the message itself.
+	Path    string
+	Message string
+
+	// Pos is the position in the config at which the field was set. If the
+	// field wasn't set from Starlark, this is the position of the nearest
+	// enclosing message that was. Set by Main. Fields set while loading
+	// modules only have positions if loaded with WithFieldPositions.
+	Pos syntax.Position
+}
+
+func (v *Violation) Error() string {
+	var b strings.Builder
+	if v.Pos.IsValid() {
+		b.WriteString(v.Pos.String())
+		b.WriteString(": ")
+	}
+	if v.Path != "" {
+		b.WriteString(v.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(v.Message)
+	return b.String()
+}
+
+// A ValidationError is returned by Main if any returned message fails
+// validation.
+type ValidationError struct {
+	// Violations found in each invalid message, in the order returned.
+	Messages []*InvalidMessage
+}
+
+// An InvalidMessage is a message returned by main that failed validation.
+type InvalidMessage struct {
+	// Index of the message in the list returned by main, after flattening.
+	Index      int
+	Message    proto.Message
+	Violations []*Violation
+}
+
+func (e *ValidationError) Error() string {
+	var lines []string
+	for _, invalid := range e.Messages {
+		for _, violation := range invalid.Violations {
+			lines = append(lines, fmt.Sprintf("invalid %s: %s", invalid.Message.ProtoReflect().Descriptor().FullName(), violation))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WithValidator checks each message returned by main() with a Validator.
+// If any message is invalid, Main returns a *ValidationError.
+//
+// Multiple validators may be used, and are run in order.
+func WithValidator(validator Validator) ExecOption {
+	return fnExecOption(func(opts *execOptions) {
+		opts.validators = append(opts.validators, validator)
+	})
+}
+
+// WithFieldPositions records the positions at which fields are set while
+// modules are loaded, so that violations in messages constructed at the top
+// level of a module have positions. Positions of fields set by main() are
+// recorded whenever validators are used.
+func WithFieldPositions() LoadOption {
+	return fnLoadOption(func(opts *loadOptions) {
+		opts.fieldPositions = true
+	})
+}
+
+// validateMessages runs validators over messages, using the Starlark values
+// the messages were converted from to find the positions of violations.
+func validateMessages(validators []Validator, values []starlark.Value, msgs []proto.Message) error {
+	var invalid []*InvalidMessage
+	for ii, msg := range msgs {
+		var violations []*Violation
+		for _, validator := range validators {
+			violations = append(violations, validator.Validate(msg)...)
+		}
+		if len(violations) == 0 {
+			continue
+		}
+		positions := protomodule.FieldPositions(values[ii])
+		for _, violation := range violations {
+			if !violation.Pos.IsValid() {
+				violation.Pos = fieldPosition(positions, violation.Path)
+			}
+		}
+		invalid = append(invalid, &InvalidMessage{
+			Index:      ii,
+			Message:    msg,
+			Violations: violations,
+		})
+	}
+	if len(invalid) > 0 {
+		return &ValidationError{Messages: invalid}
+	}
+	return nil
+}
+
+// fieldPosition returns the position of path, or of its nearest parent.
+func fieldPosition(positions map[string]syntax.Position, path string) syntax.Position {
+	for {
+		if pos, ok := positions[path]; ok {
+			return pos
+		}
+		if path == "" {
+			return syntax.Position{}
+		}
+		if idx := strings.LastIndexAny(path, ".["); idx >= 0 {
+			path = path[:idx]
+		} else {
+			path = ""
+		}
+	}
+}
+
+// walkFields calls fn for each field of msg and of its nested messages,
+// including unset fields. Nested messages are only visited if set.
+func walkFields(prefix string, msg protoreflect.Message, fn func(path string, msg protoreflect.Message, field protoreflect.FieldDescriptor)) {
+	fields := msg.Descriptor().Fields()
+	for ii := 0; ii < fields.Len(); ii++ {
+		field := fields.Get(ii)
+		path := string(field.Name())
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		fn(path, msg, field)
+		if field.Message() == nil || !msg.Has(field) {
+			continue
+		}
+		value := msg.Get(field)
+		switch {
+		case field.IsList():
+			list := value.List()
+			for jj := 0; jj < list.Len(); jj++ {
+				walkFields(fmt.Sprintf("%s[%d]", path, jj), list.Get(jj).Message(), fn)
+			}
+		case field.IsMap():
+			if field.MapValue().Message() == nil {
+				continue
+			}
+			value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+				walkFields(path+"["+mapKeyPath(key)+"]", value.Message(), fn)
+				return true
+			})
+		default:
+			walkFields(path, value.Message(), fn)
+		}
+	}
+}
+
+// mapKeyPath formats a map key within a field path, matching the paths of
+// protomodule.FieldPositions.
+func mapKeyPath(key protoreflect.MapKey) string {
+	if s, ok := key.Interface().(string); ok {
+		return strconv.Quote(s)
+	}
+	return key.String()
+}
+
+type requiredFieldsValidator struct{}
+
+// RequiredFieldsValidator returns a Validator that reports required fields
+// of proto2 messages that aren't set.
+func RequiredFieldsValidator() Validator {
+	return requiredFieldsValidator{}
+}
+
+func (requiredFieldsValidator) Validate(msg proto.Message) []*Violation {
+	var violations []*Violation
+	walkFields("", msg.ProtoReflect(), func(path string, msg protoreflect.Message, field protoreflect.FieldDescriptor) {
+		if field.Cardinality() == protoreflect.Required && !msg.Has(field) {
+			violations = append(violations, &Violation{
+				Path:    path,
+				Message: "required field is not set",
+			})
+		}
+	})
+	return violations
+}
+
+type ruleValidator struct {
+	option protoreflect.ExtensionType
+
+	// Rules of each field, compiled when the field is first validated.
+	mu    sync.Mutex
+	rules map[protoreflect.FieldDescriptor][]*compiledRule
+}
+
+type compiledRule struct {
+	src string
+	fn  starlark.Callable
+	err error // set if the rule failed to compile
+}
+
+// RuleValidator returns a Validator that checks rule expressions set in an
+// option of each field. The option must be an extension of
+// google.protobuf.FieldOptions with type string, or repeated string:
+//
+//	extend google.protobuf.FieldOptions {
+//	  repeated string rule = 50000;
+//	}
+//
+//	message Service {
+//	  optional int32 replicas = 1 [(rule) = "value >= 1", (rule) = "value <= 10"];
+//	}
+//
+// Each rule is a Starlark expression that must evaluate to True. The field's
+// value is available as `value`, and `matches(pattern, s)` reports whether a
+// string contains a match of a regular expression.
+//
+// Rules are checked for fields that are set, and for repeated, map, and
+// scalar fields without presence.
+func RuleValidator(option protoreflect.ExtensionType) Validator {
+	desc := option.TypeDescriptor()
+	if desc.ContainingMessage().FullName() != "google.protobuf.FieldOptions" || desc.Kind() != protoreflect.StringKind {
+		panic(fmt.Sprintf("RuleValidator: %s is not a string extension of google.protobuf.FieldOptions", desc.FullName()))
+	}
+	return &ruleValidator{
+		option: option,
+		rules:  make(map[protoreflect.FieldDescriptor][]*compiledRule),
+	}
+}
+
+func (v *ruleValidator) Validate(msg proto.Message) []*Violation {
+	var violations []*Violation
+	walkFields("", msg.ProtoReflect(), func(path string, msg protoreflect.Message, field protoreflect.FieldDescriptor) {
+		rules := v.fieldRules(field)
+		if len(rules) == 0 {
+			return
+		}
+		if field.HasPresence() && !msg.Has(field) {
+			return
+		}
+		value, err := protomodule.FieldValue(msg, field)
+		if err != nil {
+			violations = append(violations, &Violation{Path: path, Message: err.Error()})
+			return
+		}
+		value.Freeze()
+		for _, rule := range rules {
+			if err := rule.check(value); err != nil {
+				violations = append(violations, &Violation{
+					Path:    path,
+					Message: fmt.Sprintf("rule %q: %v", rule.src, err),
+				})
+			}
+		}
+	})
+	return violations
+}
+
+// fieldRules returns the compiled rules of a field.
+func (v *ruleValidator) fieldRules(field protoreflect.FieldDescriptor) []*compiledRule {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if rules, ok := v.rules[field]; ok {
+		return rules
+	}
+	var rules []*compiledRule
+	for _, src := range v.ruleSources(field) {
+		fn, err := compileRule(src)
+		rules = append(rules, &compiledRule{src: src, fn: fn, err: err})
+	}
+	v.rules[field] = rules
+	return rules
+}
+
+func (v *ruleValidator) ruleSources(field protoreflect.FieldDescriptor) []string {
+	options := field.Options()
+	if options == nil || !proto.HasExtension(options, v.option) {
+		return nil
+	}
+	switch rules := proto.GetExtension(options, v.option).(type) {
+	case string:
+		return []string{rules}
+	case []string:
+		return rules
+	}
+	return nil
+}
+
+var ruleGlobals = starlark.StringDict{
+	"matches": ruleMatches,
+}
+
+// compileRule returns a function of a field's value that evaluates a rule
+// expression, by wrapping the expression in a function definition.
+func compileRule(rule string) (starlark.Callable, error) {
+	expr, err := syntax.ParseExpr("rule", rule, 0)
+	if err != nil {
+		return nil, err
+	}
+	pos, _ := expr.Span()
+	f := &syntax.File{
+		Path: "rule",
+		Stmts: []syntax.Stmt{&syntax.DefStmt{
+			Def:    pos,
+			Name:   &syntax.Ident{NamePos: pos, Name: "rule"},
+			Params: []syntax.Expr{&syntax.Ident{NamePos: pos, Name: "value"}},
+			Body:   []syntax.Stmt{&syntax.ReturnStmt{Return: pos, Result: expr}},
+		}},
+	}
+	prog, err := starlark.FileProgram(f, ruleGlobals.Has)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := prog.Init(&starlark.Thread{Name: "rule"}, ruleGlobals)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+	return globals["rule"].(starlark.Callable), nil
+}
+
+func (r *compiledRule) check(value starlark.Value) error {
+	if r.err != nil {
+		return r.err
+	}
+	thread := &starlark.Thread{Name: "rule"}
+	result, err := starlark.Call(thread, r.fn, starlark.Tuple{value}, nil)
+	if err != nil {
+		return err
+	}
+	if result != starlark.True {
+		return fmt.Errorf("got %s", result)
+	}
+	return nil
+}
+
+var ruleMatches = starlark.NewBuiltin("matches", func(
+	t *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &pattern, &s); err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return starlark.Bool(re.MatchString(s)), nil
+})
+
+// rulePatterns caches patterns compiled by matches(), which is called once
+// per validated value.
+var rulePatterns sync.Map // map[string]*regexp.Regexp
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := rulePatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	cached, _ := rulePatterns.LoadOrStore(pattern, re)
+	return cached.(*regexp.Regexp), nil
+}